@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/afrancoc2000/application-helper-ai/internal/config"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// secretSettings are masked when the settings are shown.
+var secretSettings = map[string]bool{
+	config.OpenaiApiKeyLabel:      true,
+	config.AzureClientSecretLabel: true,
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect, change and validate the settings",
+	Long: `The settings are read from the flags, the environment variables and the
+		config file, in that order. These commands show where every setting comes
+		from and change the config file, a profile is changed with --profile.`,
+}
+
+var configViewCmd = &cobra.Command{
+	Use:   "view",
+	Short: "Show the effective settings and where they come from",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file, profile, err := applyConfigFile(&viperConfig)
+		if err != nil {
+			return err
+		}
+
+		out := cmd.OutOrStdout()
+		if file != nil {
+			fmt.Fprintf(out, "Config file: %s\n", file.Path)
+		} else {
+			fmt.Fprintln(out, "Config file: none")
+		}
+		if profile != "" {
+			fmt.Fprintf(out, "Profile:     %s\n", profile)
+		}
+		fmt.Fprintln(out)
+
+		writer := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "SETTING\tVALUE\tSOURCE")
+		for _, setting := range settings {
+			if setting.label == config.ConfigFileLabel || setting.label == config.ProfileLabel {
+				continue
+			}
+			value := formatSetting(viperConfig.Get(setting.label))
+			if secretSettings[setting.label] {
+				value = mask(value)
+			}
+			fmt.Fprintf(writer, "%s\t%s\t%s\n", setting.label, value, settingSource(setting.label, setting.variable, file, profile))
+		}
+		return writer.Flush()
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <setting> <value>...",
+	Short: "Save a setting in the config file",
+	Long: `Saves a setting, named as its flag, in the config file, or in the profile
+		given with --profile. The file is created in the application config
+		directory when there's none. Lists, like header, take several values.`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := editedConfigFile()
+		if err != nil {
+			return err
+		}
+		profile := cmd.Flag(config.ProfileLabel).Value.String()
+
+		err = config.SetSetting(path, profile, args[0], args[1:])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Set %s in %s\n", args[0], describeTarget(path, profile))
+		return nil
+	},
+}
+
+var configUnsetCmd = &cobra.Command{
+	Use:   "unset <setting>",
+	Short: "Remove a setting from the config file",
+	Long: `Removes a setting from the config file, or from the profile given with
+		--profile, so the setting shared by every profile or the default is used.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := editedConfigFile()
+		if err != nil {
+			return err
+		}
+		profile := cmd.Flag(config.ProfileLabel).Value.String()
+
+		err = config.UnsetSetting(path, profile, args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Unset %s in %s\n", args[0], describeTarget(path, profile))
+		return nil
+	},
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the config file and the settings of its profiles",
+	Long: `Checks the settings of the config file and of every profile, or only the
+		one given with --profile, as a generation would read them, including that
+		the deployment names are in the model catalog.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path := viperConfig.GetString(config.ConfigFileLabel)
+		if path == "" {
+			path = config.DefaultFile()
+		}
+		if path == "" {
+			return fmt.Errorf("there's no config file, create one with the config set command or set it with --%s", config.ConfigFileLabel)
+		}
+		file, err := config.LoadFile(path)
+		if err != nil {
+			return err
+		}
+
+		profiles := file.ProfileNames()
+		if profile := viperConfig.GetString(config.ProfileLabel); profile != "" {
+			profiles = []string{profile}
+		} else if len(profiles) == 0 {
+			profiles = []string{""}
+		}
+
+		out := cmd.OutOrStdout()
+		invalid := 0
+		for _, profile := range profiles {
+			name := "shared settings"
+			if profile != "" {
+				name = fmt.Sprintf("profile %s", profile)
+			}
+			if err := validateProfile(file, profile); err != nil {
+				fmt.Fprintf(out, "%s: %s\n", name, err)
+				invalid++
+				continue
+			}
+			fmt.Fprintf(out, "%s: ok\n", name)
+		}
+		if invalid > 0 {
+			return fmt.Errorf("%s has %d invalid profiles out of %d", file.Path, invalid, len(profiles))
+		}
+		return nil
+	},
+}
+
+func init() {
+	configCmd.AddCommand(configViewCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configUnsetCmd)
+	configCmd.AddCommand(configValidateCmd)
+	RootCmd.AddCommand(configCmd)
+}
+
+// validateProfile reads the settings of a profile like a generation does,
+// with the flags and environment variables overriding them.
+func validateProfile(file *config.File, profile string) error {
+	settings, err := file.Resolve(profile)
+	if err != nil {
+		return err
+	}
+
+	v := viper.New()
+	bindSettings(v)
+	for label, value := range settings {
+		v.SetDefault(label, value)
+	}
+	return (&config.AppConfig{}).Initialize(*v)
+}
+
+// settingSource describes where the effective value of a setting comes from.
+func settingSource(label string, variable string, file *config.File, profile string) string {
+	if flag := RootCmd.Flags().Lookup(label); flag != nil && flag.Changed {
+		return "flag --" + label
+	}
+	if value, ok := os.LookupEnv(variable); variable != "" && ok && value != "" {
+		return "env " + variable
+	}
+	if file != nil {
+		if _, ok := file.Profiles[profile][label]; ok {
+			return "profile " + profile
+		}
+		if _, ok := file.Settings[label]; ok {
+			return "config file"
+		}
+	}
+	return "default"
+}
+
+// editedConfigFile returns the config file changed by the config commands,
+// which is created in the config directory when the user hasn't got one.
+func editedConfigFile() (string, error) {
+	if path := viperConfig.GetString(config.ConfigFileLabel); path != "" {
+		return path, nil
+	}
+	if path := config.DefaultFile(); path != "" {
+		return path, nil
+	}
+	return config.NewFilePath()
+}
+
+func describeTarget(path string, profile string) string {
+	if profile == "" {
+		return path
+	}
+	return fmt.Sprintf("the profile %s of %s", profile, path)
+}
+
+func formatSetting(value interface{}) string {
+	if list, ok := value.([]string); ok {
+		return strings.Join(list, ", ")
+	}
+	return fmt.Sprint(value)
+}
+
+// mask hides a secret, keeping its last characters to tell it apart from
+// other ones.
+func mask(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	if len(secret) <= 8 {
+		return "****"
+	}
+	return "****" + secret[len(secret)-4:]
+}
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/afrancoc2000/application-helper-ai/internal/config"
+	"github.com/afrancoc2000/application-helper-ai/internal/keyring"
+	"github.com/spf13/cobra"
+)
+
+var loginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Save the API key of a profile in the keyring",
+	Long: `Saves the API key in the system keyring, or in a file encrypted with a
+		passphrase when there's none, so it doesn't have to be passed in the
+		openaiApiKey flag or the OPENAI_API_KEY environment variable. The key is
+		saved for the profile given with --profile, or the default profile of the
+		config file. It is read from the standard input when it isn't a terminal,
+		like in: application-ai login < key.txt`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, profile, err := openKeyring()
+		if err != nil {
+			return err
+		}
+
+		key, err := readAPIKey(cmd.InOrStdin())
+		if err != nil {
+			return err
+		}
+		err = store.Set(profile, key)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Saved the API key of the profile %s in %s\n", keyring.ProfileKey(profile), store)
+		return nil
+	},
+}
+
+var logoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Remove the API key of a profile from the keyring",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, profile, err := openKeyring()
+		if err != nil {
+			return err
+		}
+
+		err = store.Delete(profile)
+		if errors.Is(err, keyring.ErrNotFound) {
+			return fmt.Errorf("there's no API key saved for the profile %s in %s", keyring.ProfileKey(profile), store)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Removed the API key of the profile %s from %s\n", keyring.ProfileKey(profile), store)
+		return nil
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(loginCmd)
+	RootCmd.AddCommand(logoutCmd)
+}
+
+// openKeyring returns the keyring of the settings and the selected profile.
+func openKeyring() (keyring.Store, string, error) {
+	_, profile, err := applyConfigFile(&viperConfig)
+	if err != nil {
+		return nil, "", err
+	}
+	backend, err := keyring.ParseBackend(viperConfig.GetString(config.KeyringLabel))
+	if err != nil {
+		return nil, "", err
+	}
+	store, err := config.OpenKeyring(backend)
+	if err != nil {
+		return nil, "", err
+	}
+	return store, profile, nil
+}
+
+// readAPIKey asks for the key without showing it, or reads it from the input
+// when it isn't a terminal.
+func readAPIKey(input io.Reader) (string, error) {
+	if file, ok := input.(*os.File); ok {
+		if info, err := file.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+			return keyring.PromptSecret("API key")
+		}
+	}
+
+	content, err := io.ReadAll(input)
+	if err != nil {
+		return "", err
+	}
+	key := strings.TrimSpace(string(content))
+	if key == "" {
+		return "", errors.New("the API key can't be empty")
+	}
+	return key, nil
+}
@@ -2,11 +2,18 @@ package cmd
 
 import (
 	"fmt"
+	"strings"
+	"time"
+
 	fileSystem "github.com/afrancoc2000/application-helper-ai/internal/file_system"
 
 	"github.com/afrancoc2000/application-helper-ai/internal/appai"
+	"github.com/afrancoc2000/application-helper-ai/internal/auth"
 	"github.com/afrancoc2000/application-helper-ai/internal/config"
+	"github.com/afrancoc2000/application-helper-ai/internal/keyring"
 	"github.com/afrancoc2000/application-helper-ai/internal/openai"
+	"github.com/afrancoc2000/application-helper-ai/internal/session"
+	"github.com/afrancoc2000/application-helper-ai/internal/usage"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -24,25 +31,60 @@ var RootCmd = &cobra.Command{
 		the files defined`,
 	Version:      version,
 	SilenceUsage: true,
+	// the prompt isn't a subcommand, cobra rejects unknown ones by default
+	Args: cobra.ArbitraryArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
 
-		if len(args) == 0 {
+		_, _, err := applyConfigFile(&viperConfig)
+		if err != nil {
+			return err
+		}
+
+		sessions, err := session.DefaultStore()
+		if err != nil {
+			return err
+		}
+
+		var current *session.Session
+		if resume := viperConfig.GetString(config.ResumeLabel); resume != "" {
+			current, err = sessions.Load(resume)
+			if err != nil {
+				return err
+			}
+			// flags and environment variables still override the saved settings,
+			// which override the config file
+			for label, value := range current.Config.Settings() {
+				viperConfig.SetDefault(label, value)
+			}
+		} else if len(args) == 0 {
 			return fmt.Errorf("prompt must be provided")
 		}
 
-		err := appConfig.Initialize(viperConfig)
+		err = appConfig.Initialize(viperConfig)
 		if err != nil {
 			return err
 		}
+		if current == nil {
+			current = session.New(appConfig)
+		}
 
 		client, err := openai.NewAIClient(appConfig)
 		if err != nil {
 			return err
 		}
 
-		fileFactory := fileSystem.NewFileFactory()
+		fileFactory := fileSystem.NewFileFactory(appConfig.OutputDir, appConfig.ConflictPolicy, appai.ConflictPrompt)
 
-		generator, err := appai.NewGenerator(appConfig, client, fileFactory)
+		// replayed answers aren't billed so they are kept out of the usage log
+		var usageLog *usage.Log
+		if appConfig.ReplayCassette == "" {
+			usageLog, err = usage.DefaultLog()
+			if err != nil {
+				return err
+			}
+		}
+
+		generator, err := appai.NewGenerator(appConfig, client, fileFactory, sessions, current, usageLog)
 		if err != nil {
 			return err
 		}
@@ -95,45 +137,243 @@ func init() {
 		"c",
 		"",
 		"The text context for the OpenAI service to know what kind of app to generate.")
+
+	RootCmd.PersistentFlags().String(
+		config.ProviderLabel,
+		"",
+		fmt.Sprintf("The provider used to generate the files, one of: %s. Defaults to azure when an Azure endpoint is set and openai otherwise.", strings.Join(openai.Providers(), ", ")))
+
+	RootCmd.PersistentFlags().String(
+		config.BaseURLLabel,
+		"",
+		"The base URL of an OpenAI compatible API. Defaults to the provider's public endpoint, or http://localhost:11434/v1 for ollama.")
+
+	RootCmd.PersistentFlags().String(
+		config.ModelCatalogLabel,
+		"",
+		"A YAML file with models and deployment names to add to the built-in model catalog. Defaults to models.yaml in the application config directory.")
+
+	RootCmd.PersistentFlags().StringP(
+		config.OutputDirLabel,
+		"o",
+		".",
+		"The directory where the files are created, files outside of it are never written. Defaults to the current directory.")
+
+	RootCmd.PersistentFlags().Bool(
+		config.DryRunLabel,
+		false,
+		"Show the files that would be created and how they differ from the ones on disk without writing anything. Defaults to false.")
+
+	RootCmd.PersistentFlags().String(
+		config.ConflictPolicyLabel,
+		"",
+		"What to do with generated files that already exist: fail, skip, overwrite, backup or prompt-per-file. Defaults to prompt-per-file, or fail when confirmation is skipped.")
+
+	RootCmd.PersistentFlags().String(
+		config.ResumeLabel,
+		"",
+		"The ID of a saved session to continue, the prompt is optional when resuming. Run the sessions list command to see the saved sessions.")
+
+	RootCmd.PersistentFlags().Int(
+		config.RepairAttemptsLabel,
+		2,
+		"How many times the model is asked to correct an answer that can't be parsed before giving up. Defaults to 2.")
+
+	RootCmd.PersistentFlags().Bool(
+		config.StructuredOutputLabel,
+		true,
+		"Whether to receive the files as function call arguments with the chat models that support it, instead of parsing them from text. Defaults to true.")
+
+	RootCmd.PersistentFlags().Int(
+		config.MaxRetriesLabel,
+		3,
+		"How many times a request that failed with a rate limit, a server or a network error is retried. Defaults to 3.")
+
+	RootCmd.PersistentFlags().Duration(
+		config.RetryDelayLabel,
+		time.Second,
+		"The wait before the first retry, doubled after every retry. Defaults to 1s.")
+
+	RootCmd.PersistentFlags().Duration(
+		config.RetryMaxDelayLabel,
+		time.Minute,
+		"The longest wait between retries, a request is not retried when the API asks to wait longer. Defaults to 1m.")
+
+	RootCmd.PersistentFlags().String(
+		config.RecordCassetteLabel,
+		"",
+		"A file where every query and its answer are recorded, so the generation can be replayed offline with the replay flag.")
+
+	RootCmd.PersistentFlags().String(
+		config.ReplayCassetteLabel,
+		"",
+		"A file recorded with the record flag whose answers are used instead of calling the API, no API key is needed.")
+
+	RootCmd.PersistentFlags().String(
+		config.ProxyLabel,
+		"",
+		"The URL of the HTTP proxy used to call the API, like http://proxy.example.com:8080. Defaults to the HTTPS_PROXY and HTTP_PROXY environment variables.")
+
+	RootCmd.PersistentFlags().String(
+		config.CABundleLabel,
+		"",
+		"A PEM file with certificate authorities trusted besides the system ones, for gateways with an internal certificate.")
+
+	RootCmd.PersistentFlags().StringArray(
+		config.HeadersLabel,
+		[]string{},
+		"A header sent with every request to the API, like \"X-Gateway-Key: 1234\". Can be repeated.")
+
+	RootCmd.PersistentFlags().Duration(
+		config.TimeoutLabel,
+		0,
+		"How long a request to the API can take, including reading the answer. Defaults to 1m, or 5m for ollama.")
+
+	RootCmd.PersistentFlags().String(
+		config.AzureAuthLabel,
+		"",
+		fmt.Sprintf("How to authenticate with Azure OpenAI, one of: %s. Defaults to key, which uses the API key.", strings.Join(auth.Methods(), ", ")))
+
+	RootCmd.PersistentFlags().String(
+		config.AzureTenantIDLabel,
+		"",
+		"The Azure AD tenant of the service principal used by the client-credentials authentication.")
+
+	RootCmd.PersistentFlags().String(
+		config.AzureClientIDLabel,
+		"",
+		"The client ID of the service principal used by the client-credentials authentication, or of the user assigned managed identity.")
+
+	RootCmd.PersistentFlags().String(
+		config.AzureClientSecretLabel,
+		"",
+		"The secret of the service principal used by the client-credentials authentication.")
+
+	RootCmd.PersistentFlags().String(
+		config.AzureAuthorityHostLabel,
+		"",
+		"The Azure AD host tokens are requested from. Defaults to https://login.microsoftonline.com.")
+
+	RootCmd.PersistentFlags().String(
+		config.AzureTokenCacheLabel,
+		"",
+		"The token cache of the Azure CLI used by the azure-cli authentication. Defaults to ~/.azure/msal_token_cache.json.")
+
+	RootCmd.PersistentFlags().String(
+		config.ConfigFileLabel,
+		"",
+		"A YAML or TOML file with the settings, named as the flags, and profiles. Defaults to config.yaml, config.yml or config.toml in the application config directory.")
+
+	RootCmd.PersistentFlags().String(
+		config.ProfileLabel,
+		"",
+		"The profile of the config file to use, its settings override the ones shared by every profile. Defaults to the profile set in the file.")
+
+	RootCmd.PersistentFlags().String(
+		config.KeyringLabel,
+		"",
+		fmt.Sprintf("Where the API keys saved with the login command are kept, one of: %s. Defaults to auto, the system keyring when there's one and an encrypted file otherwise.", strings.Join(keyring.Backends(), ", ")))
+}
+
+// settings are the flags bound to the configuration, with the environment
+// variable that sets them when the flag isn't used.
+var settings = []struct {
+	label    string
+	variable string
+}{
+	{config.OpenaiApiKeyLabel, "OPENAI_API_KEY"},
+	{config.OpenaiDeploymentNameLabel, "OPENAI_DEPLOYMENT_NAME"},
+	{config.MaxTokensLabel, "MAX_TOKENS"},
+	{config.AzureOpenaiEndpointLabel, "AZURE_OPENAI_ENDPOINT"},
+	{config.SkipConfirmationLabel, "SKIP_CONFIRMATION"},
+	{config.TemperatureLabel, "TEMPERATURE"},
+	{config.ChatContextLabel, "CHAT_CONTEXT"},
+	{config.ProviderLabel, "AI_PROVIDER"},
+	{config.BaseURLLabel, "OPENAI_BASE_URL"},
+	{config.ModelCatalogLabel, "MODEL_CATALOG"},
+	{config.OutputDirLabel, "OUTPUT_DIR"},
+	{config.DryRunLabel, "DRY_RUN"},
+	{config.ConflictPolicyLabel, "CONFLICT_POLICY"},
+	{config.ResumeLabel, ""},
+	{config.RepairAttemptsLabel, "REPAIR_ATTEMPTS"},
+	{config.StructuredOutputLabel, "STRUCTURED_OUTPUT"},
+	{config.MaxRetriesLabel, "MAX_RETRIES"},
+	{config.RetryDelayLabel, "RETRY_DELAY"},
+	{config.RetryMaxDelayLabel, "RETRY_MAX_DELAY"},
+	{config.RecordCassetteLabel, "RECORD_CASSETTE"},
+	{config.ReplayCassetteLabel, "REPLAY_CASSETTE"},
+	{config.ProxyLabel, "OPENAI_PROXY"},
+	{config.CABundleLabel, "OPENAI_CA_BUNDLE"},
+	{config.HeadersLabel, "OPENAI_HEADERS"},
+	{config.TimeoutLabel, "OPENAI_TIMEOUT"},
+	{config.AzureAuthLabel, "AZURE_AUTH"},
+	{config.AzureTenantIDLabel, "AZURE_TENANT_ID"},
+	{config.AzureClientIDLabel, "AZURE_CLIENT_ID"},
+	{config.AzureClientSecretLabel, "AZURE_CLIENT_SECRET"},
+	{config.AzureAuthorityHostLabel, "AZURE_AUTHORITY_HOST"},
+	{config.AzureTokenCacheLabel, "AZURE_TOKEN_CACHE"},
+	{config.ConfigFileLabel, "APPLICATION_AI_CONFIG"},
+	{config.ProfileLabel, "APPLICATION_AI_PROFILE"},
+	{config.KeyringLabel, "APPLICATION_AI_KEYRING"},
 }
 
 func initConfig() {
-	viperConfig.SetEnvPrefix("")
-
-	err := viperConfig.BindEnv(config.OpenaiApiKeyLabel, "OPENAI_API_KEY")
-	logIfError(err)
-	err = viperConfig.BindEnv(config.OpenaiDeploymentNameLabel, "OPENAI_DEPLOYMENT_NAME")
-	logIfError(err)
-	err = viperConfig.BindEnv(config.MaxTokensLabel, "MAX_TOKENS")
-	logIfError(err)
-	err = viperConfig.BindEnv(config.AzureOpenaiEndpointLabel, "AZURE_OPENAI_ENDPOINT")
-	logIfError(err)
-	err = viperConfig.BindEnv(config.SkipConfirmationLabel, "SKIP_CONFIRMATION")
-	logIfError(err)
-	err = viperConfig.BindEnv(config.TemperatureLabel, "TEMPERATURE")
-	logIfError(err)
-	err = viperConfig.BindEnv(config.ChatContextLabel, "CHAT_CONTEXT")
-	logIfError(err)
-
-	err = viperConfig.BindPFlag(config.OpenaiApiKeyLabel, RootCmd.Flags().Lookup(config.OpenaiApiKeyLabel))
-	logIfError(err)
-	err = viperConfig.BindPFlag(config.OpenaiDeploymentNameLabel, RootCmd.Flags().Lookup(config.OpenaiDeploymentNameLabel))
-	logIfError(err)
-	err = viperConfig.BindPFlag(config.MaxTokensLabel, RootCmd.Flags().Lookup(config.MaxTokensLabel))
-	logIfError(err)
-	err = viperConfig.BindPFlag(config.AzureOpenaiEndpointLabel, RootCmd.Flags().Lookup(config.AzureOpenaiEndpointLabel))
-	logIfError(err)
-	err = viperConfig.BindPFlag(config.SkipConfirmationLabel, RootCmd.Flags().Lookup(config.SkipConfirmationLabel))
-	logIfError(err)
-	err = viperConfig.BindPFlag(config.TemperatureLabel, RootCmd.Flags().Lookup(config.TemperatureLabel))
-	logIfError(err)
-	err = viperConfig.BindPFlag(config.ChatContextLabel, RootCmd.Flags().Lookup(config.ChatContextLabel))
-	logIfError(err)
+	// the settings of a previous execution, like the ones of a config file,
+	// are cleared
+	viperConfig = *viper.New()
+	bindSettings(&viperConfig)
+}
 
+// bindSettings binds the flags and environment variables to a configuration.
+func bindSettings(v *viper.Viper) {
+	v.SetEnvPrefix("")
+	for _, setting := range settings {
+		if setting.variable != "" {
+			err := v.BindEnv(setting.label, setting.variable)
+			logIfError(err)
+		}
+		err := v.BindPFlag(setting.label, RootCmd.Flags().Lookup(setting.label))
+		logIfError(err)
+	}
+}
+
+// applyConfigFile uses the settings of the config file and of the selected
+// profile as defaults, so flags and environment variables override them. It
+// returns the file, nil when there's none, and the name of the profile.
+func applyConfigFile(v *viper.Viper) (*config.File, string, error) {
+	path := v.GetString(config.ConfigFileLabel)
+	if path == "" {
+		path = config.DefaultFile()
+	}
+	profile := v.GetString(config.ProfileLabel)
+	if path == "" {
+		if profile != "" {
+			return nil, "", fmt.Errorf("the profile %q can't be used without a config file, create one or set it with --%s", profile, config.ConfigFileLabel)
+		}
+		return nil, "", nil
+	}
+
+	file, err := config.LoadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	if profile == "" {
+		profile = file.Profile
+	}
+	settings, err := file.Resolve(profile)
+	if err != nil {
+		return nil, "", err
+	}
+	for label, value := range settings {
+		v.SetDefault(label, value)
+	}
+	// the API key saved with login is looked up for the profile
+	v.SetDefault(config.ProfileLabel, profile)
+	return file, profile, nil
 }
 
 func logIfError(err error) {
 	if err != nil {
 		fmt.Printf("There was an error binding to viper: %s\n", err.Error())
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/afrancoc2000/application-helper-ai/internal/session"
+	"github.com/spf13/cobra"
+)
+
+const timeFormat = "2006-01-02 15:04:05"
+
+var sessionsCmd = &cobra.Command{
+	Use:   "sessions",
+	Short: "List and inspect the saved generation sessions",
+	Long: `Every generation is saved as a session with its prompts, answers and
+		generated files, so it can be continued later with the --resume flag.`,
+}
+
+var sessionsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the saved sessions, the most recent first",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sessions, err := session.DefaultStore()
+		if err != nil {
+			return err
+		}
+
+		saved, err := sessions.List()
+		if err != nil {
+			return err
+		}
+		if len(saved) == 0 {
+			fmt.Println("There are no saved sessions.")
+			return nil
+		}
+
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "ID\tUPDATED\tTURNS\tPROMPT")
+		for _, saved := range saved {
+			fmt.Fprintf(writer, "%s\t%s\t%d\t%s\n", saved.ID, saved.UpdatedAt.Local().Format(timeFormat), len(saved.Turns), shorten(saved.Title(), 60))
+		}
+		return writer.Flush()
+	},
+}
+
+var sessionsShowCmd = &cobra.Command{
+	Use:   "show <id>",
+	Short: "Show the settings, prompts and generated files of a session",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sessions, err := session.DefaultStore()
+		if err != nil {
+			return err
+		}
+
+		saved, err := sessions.Load(args[0])
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Session:    %s\n", saved.ID)
+		fmt.Printf("Created:    %s\n", saved.CreatedAt.Local().Format(timeFormat))
+		fmt.Printf("Updated:    %s\n", saved.UpdatedAt.Local().Format(timeFormat))
+		fmt.Printf("Provider:   %s\n", saved.Config.Provider)
+		fmt.Printf("Deployment: %s\n", saved.Config.OpenaiDeploymentName)
+		fmt.Printf("Output dir: %s\n", saved.Config.OutputDir)
+		if saved.Config.ChatContext != "" {
+			fmt.Printf("Context:    %s\n", saved.Config.ChatContext)
+		}
+		fmt.Printf("Usage:      %s\n", saved.Usage())
+
+		for index, turn := range saved.Turns {
+			status := "not applied"
+			if turn.Applied {
+				status = "applied"
+			}
+			if turn.RepairRounds > 0 {
+				status = fmt.Sprintf("%s, %d repair rounds", status, turn.RepairRounds)
+			}
+			if turn.PromptTokens > 0 || turn.CompletionTokens > 0 {
+				status = fmt.Sprintf("%s, %d tokens", status, turn.PromptTokens+turn.CompletionTokens)
+			}
+			fmt.Printf("\n%d. %s (%s, %s)\n", index+1, turn.Prompt, turn.CreatedAt.Local().Format(timeFormat), status)
+			for _, file := range turn.Files {
+				fmt.Printf("     %s%s\n", file.Path, file.Name)
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	sessionsCmd.AddCommand(sessionsListCmd)
+	sessionsCmd.AddCommand(sessionsShowCmd)
+	RootCmd.AddCommand(sessionsCmd)
+}
+
+func shorten(text string, length int) string {
+	runes := []rune(text)
+	if len(runes) <= length {
+		return text
+	}
+	return string(runes[:length-3]) + "..."
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/afrancoc2000/application-helper-ai/internal/config"
+	fileSystem "github.com/afrancoc2000/application-helper-ai/internal/file_system"
+	"github.com/spf13/cobra"
+)
+
+var undoCmd = &cobra.Command{
+	Use:   "undo",
+	Short: "Undo the last time files were applied in the output directory",
+	Long: `Restores the output directory to its state before the last apply,
+		deleting the files that were created and restoring the previous content
+		of the ones that were overwritten. Nothing is done if any of the applied
+		files was modified after the apply.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		outputDir := viperConfig.GetString(config.OutputDirLabel)
+		if outputDir == "" {
+			outputDir = "."
+		}
+
+		entry, err := fileSystem.Undo(outputDir)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Undid the apply of %s:\n", entry.CreatedAt.Local().Format("2006-01-02 15:04:05"))
+		for _, file := range entry.Files {
+			fmt.Printf("  %-11s %s\n", undoneAction(file.Action), file.Path)
+		}
+		return nil
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(undoCmd)
+}
+
+func undoneAction(action fileSystem.FileAction) string {
+	switch action {
+	case fileSystem.OverwrittenFile, fileSystem.BackedUpFile:
+		return "restored"
+	default:
+		return "deleted"
+	}
+}
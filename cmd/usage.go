@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/afrancoc2000/application-helper-ai/internal/usage"
+	"github.com/spf13/cobra"
+)
+
+const (
+	sinceLabel = "since"
+	byLabel    = "by"
+)
+
+var usageCmd = &cobra.Command{
+	Use:   "usage",
+	Short: "Report the tokens used and what they cost over time",
+	Long: `Every generation adds the tokens it used and their cost, priced with the
+		prices of the model catalog, to the usage log in the application config directory.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		since, err := usage.ParseSince(cmd.Flag(sinceLabel).Value.String(), time.Now())
+		if err != nil {
+			return err
+		}
+		grouping, err := usage.ParseGrouping(cmd.Flag(byLabel).Value.String())
+		if err != nil {
+			return err
+		}
+
+		log, err := usage.DefaultLog()
+		if err != nil {
+			return err
+		}
+		records, err := log.Read()
+		if err != nil {
+			return err
+		}
+
+		totals := usage.Summarize(records, since, grouping)
+		if len(totals) == 0 {
+			fmt.Println("There is no usage recorded for this period.")
+			return nil
+		}
+
+		overall := usage.Total{Key: "TOTAL"}
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintf(writer, "%s\tTURNS\tPROMPT\tCOMPLETION\tCOST\n", strings.ToUpper(string(grouping)))
+		for _, total := range totals {
+			printTotal(writer, total)
+			overall.Combine(total)
+		}
+		printTotal(writer, overall)
+		return writer.Flush()
+	},
+}
+
+func init() {
+	usageCmd.Flags().String(
+		sinceLabel,
+		"",
+		"Only report the usage since a date like 2024-05-01 or a number of days like 30d. Defaults to all the recorded usage.")
+	usageCmd.Flags().String(
+		byLabel,
+		string(usage.ByDay),
+		fmt.Sprintf("How to group the usage, one of: %s.", strings.Join(usage.Groupings(), ", ")))
+	RootCmd.AddCommand(usageCmd)
+}
+
+func printTotal(writer *tabwriter.Writer, total usage.Total) {
+	fmt.Fprintf(writer, "%s\t%d\t%d\t%d\t%s\n", total.Key, total.Turns, total.PromptTokens, total.CompletionTokens, total.FormatCost())
+}
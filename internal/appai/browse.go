@@ -0,0 +1,72 @@
+package appai
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/afrancoc2000/application-helper-ai/internal/models"
+	"github.com/afrancoc2000/application-helper-ai/internal/tui"
+)
+
+// filesBrowser shows the generated files until the user chooses what to do
+// with them.
+type filesBrowser func(options tui.Options) (tui.Result, error)
+
+// browseTerminal shows the files in the full screen interface of the terminal.
+func browseTerminal(options tui.Options) (tui.Result, error) {
+	return tui.Run(options, os.Stdin, os.Stdout)
+}
+
+// browseFiles shows the files in the terminal interface and returns the action
+// chosen with the files to apply. Editing or regenerating a file goes back to
+// the interface once it is done, keeping the files accepted.
+func (c *Generator) browseFiles(ctx context.Context, files []models.AppFile) (string, []models.AppFile, error) {
+	files = append([]models.AppFile{}, files...)
+	options := tui.Options{}
+	for {
+		changes, err := c.fileFactory.CompareFiles(files)
+		if err != nil {
+			return doNotApply, nil, err
+		}
+		options.Changes = changes
+
+		result, err := c.browse(options)
+		if err != nil {
+			return doNotApply, nil, err
+		}
+		options = tui.Options{Accepted: result.Accepted, Selected: result.Selected}
+
+		switch result.Action {
+		case tui.ApplyAction:
+			accepted := []models.AppFile{}
+			for index, file := range files {
+				if result.Accepted[index] {
+					accepted = append(accepted, file)
+				}
+			}
+			return apply, accepted, nil
+		case tui.RefineAction:
+			return result.Prompt, files, nil
+		case tui.QuitAction:
+			return doNotApply, files, nil
+		case tui.EditAction:
+			content, err := c.editor(files[result.Selected])
+			if err != nil {
+				options.Status = fmt.Sprintf("Couldn't edit the file: %s", err)
+				continue
+			}
+			files[result.Selected].Content = content
+		case tui.RegenerateAction:
+			regenerated, err := c.regenerateFile(ctx, os.Stdout, files, result.Selected, result.Prompt)
+			if err != nil {
+				if ctx.Err() != nil {
+					return doNotApply, nil, err
+				}
+				options.Status = fmt.Sprintf("Couldn't regenerate the file: %s", err)
+				continue
+			}
+			files = regenerated
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package appai
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/afrancoc2000/application-helper-ai/internal/config"
+	fileSystem "github.com/afrancoc2000/application-helper-ai/internal/file_system"
+	"github.com/afrancoc2000/application-helper-ai/internal/models"
+	"github.com/afrancoc2000/application-helper-ai/internal/session"
+	"github.com/afrancoc2000/application-helper-ai/internal/tui"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBrowse(t *testing.T) {
+	Convey("Browse", t, func() {
+
+		dir := t.TempDir()
+		client := &fakeClient{}
+		gpt4, _ := models.DeploymentFromName("gpt-4")
+		current := session.New(config.AppConfig{})
+		files := []models.AppFile{
+			{Name: "index.html", Path: "./", Content: "<h1>Hello</h1>"},
+			{Name: "style.css", Path: "./", Content: "h1 {}"},
+		}
+		current.AddTurn("Create a page", "[]", files)
+
+		// results are what the user chose every time the interface is shown
+		results := []tui.Result{}
+		shown := []tui.Options{}
+		generator := &Generator{
+			appConfig:   config.AppConfig{RepairAttempts: 2, OpenaiDeployment: gpt4},
+			client:      client,
+			fileFactory: fileSystem.NewFileFactory(dir, fileSystem.OverwriteOnConflict, nil),
+			sessions:    session.NewStore(filepath.Join(dir, "sessions")),
+			session:     current,
+			editor: func(file models.AppFile) (string, error) {
+				return file.Content + " edited", nil
+			},
+			browse: func(options tui.Options) (tui.Result, error) {
+				shown = append(shown, options)
+				result := results[0]
+				results = results[1:]
+				return result, nil
+			},
+		}
+
+		Convey("Returns the accepted files", func() {
+			results = []tui.Result{{Action: tui.ApplyAction, Accepted: []bool{false, true}}}
+
+			action, accepted, err := generator.browseFiles(context.Background(), files)
+			So(err, ShouldBeNil)
+			So(action, ShouldEqual, apply)
+			So(accepted, ShouldResemble, []models.AppFile{files[1]})
+			So(shown[0].Changes, ShouldHaveLength, 2)
+			So(shown[0].Accepted, ShouldBeNil)
+		})
+
+		Convey("Returns the refinement of the query", func() {
+			results = []tui.Result{{Action: tui.RefineAction, Accepted: []bool{true, true}, Prompt: "Add a footer"}}
+
+			action, _, err := generator.browseFiles(context.Background(), files)
+			So(err, ShouldBeNil)
+			So(action, ShouldEqual, "Add a footer")
+		})
+
+		Convey("Quits without applying", func() {
+			results = []tui.Result{{Action: tui.QuitAction, Accepted: []bool{true, true}}}
+
+			action, _, err := generator.browseFiles(context.Background(), files)
+			So(err, ShouldBeNil)
+			So(action, ShouldEqual, doNotApply)
+		})
+
+		Convey("Goes back to the interface after editing a file", func() {
+			results = []tui.Result{
+				{Action: tui.EditAction, Accepted: []bool{true, false}, Selected: 1},
+				{Action: tui.ApplyAction, Accepted: []bool{true, true}, Selected: 1},
+			}
+
+			action, accepted, err := generator.browseFiles(context.Background(), files)
+			So(err, ShouldBeNil)
+			So(action, ShouldEqual, apply)
+			So(accepted[1].Content, ShouldEqual, "h1 {} edited")
+			// the generated files are left as they were
+			So(files[1].Content, ShouldEqual, "h1 {}")
+
+			So(shown, ShouldHaveLength, 2)
+			So(shown[1].Accepted, ShouldResemble, []bool{true, false})
+			So(shown[1].Selected, ShouldEqual, 1)
+			So(shown[1].Changes[1].File.Content, ShouldEqual, "h1 {} edited")
+		})
+
+		Convey("Shows why a file couldn't be edited", func() {
+			generator.editor = func(file models.AppFile) (string, error) {
+				return "", errors.New("no editor")
+			}
+			results = []tui.Result{
+				{Action: tui.EditAction, Accepted: []bool{true, true}},
+				{Action: tui.QuitAction, Accepted: []bool{true, true}},
+			}
+
+			_, _, err := generator.browseFiles(context.Background(), files)
+			So(err, ShouldBeNil)
+			So(shown[1].Status, ShouldEqual, "Couldn't edit the file: no editor")
+		})
+
+		Convey("Regenerates a file as a new turn", func() {
+			client.answers = []string{`[{"fileName":"style.css","filePath":"./","fileContent":"h1 { color: red; }"}]`}
+			results = []tui.Result{
+				{Action: tui.RegenerateAction, Accepted: []bool{true, true}, Selected: 1, Prompt: "Make the title red."},
+				{Action: tui.ApplyAction, Accepted: []bool{true, true}},
+			}
+
+			action, accepted, err := generator.browseFiles(context.Background(), files)
+			So(err, ShouldBeNil)
+			So(action, ShouldEqual, apply)
+			So(accepted[1].Content, ShouldEqual, "h1 { color: red; }")
+			So(client.prompts[0], ShouldEndWith, "Make the title red.")
+			So(current.Turns, ShouldHaveLength, 2)
+			So(shown[1].Changes[1].File.Content, ShouldEqual, "h1 { color: red; }")
+		})
+	})
+}
@@ -0,0 +1,81 @@
+package appai
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	fileSystem "github.com/afrancoc2000/application-helper-ai/internal/file_system"
+)
+
+const (
+	colorReset = "\033[0m"
+	colorRed   = "\033[31m"
+	colorGreen = "\033[32m"
+	colorCyan  = "\033[36m"
+	colorBold  = "\033[1m"
+)
+
+// printChanges shows how the generated files differ from the ones on disk,
+// modified files are shown as a unified diff.
+func printChanges(out io.Writer, changes []fileSystem.FileChange, colored bool) error {
+	fmt.Fprintln(out, "Compared with the files on disk:")
+	for index, change := range changes {
+		fmt.Fprintf(out, "%d. ", index+1)
+		err := printChange(out, change, colored)
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Fprintln(out)
+
+	return nil
+}
+
+// printChange shows the status of a file and, when it is modified, its diff.
+func printChange(out io.Writer, change fileSystem.FileChange, colored bool) error {
+	fmt.Fprintf(out, "%s%s (%s)\n", change.File.Path, change.File.Name, change.Status)
+	if change.Status != fileSystem.ModifiedFile {
+		return nil
+	}
+
+	diff, err := change.UnifiedDiff()
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.SplitAfter(diff, "\n") {
+		fmt.Fprint(out, colorDiffLine(line, colored))
+	}
+	return nil
+}
+
+func colorDiffLine(line string, colored bool) string {
+	if !colored || line == "" {
+		return line
+	}
+
+	switch {
+	case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+		return colorBold + strings.TrimSuffix(line, "\n") + colorReset + "\n"
+	case strings.HasPrefix(line, "@@"):
+		return colorCyan + strings.TrimSuffix(line, "\n") + colorReset + "\n"
+	case strings.HasPrefix(line, "+"):
+		return colorGreen + strings.TrimSuffix(line, "\n") + colorReset + "\n"
+	case strings.HasPrefix(line, "-"):
+		return colorRed + strings.TrimSuffix(line, "\n") + colorReset + "\n"
+	}
+	return line
+}
+
+// useColors returns whether the output is a terminal that accepts colors.
+func useColors(file *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -3,6 +3,7 @@ package appai
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 
@@ -10,6 +11,9 @@ import (
 	fileSystem "github.com/afrancoc2000/application-helper-ai/internal/file_system"
 	"github.com/afrancoc2000/application-helper-ai/internal/models"
 	"github.com/afrancoc2000/application-helper-ai/internal/openai"
+	"github.com/afrancoc2000/application-helper-ai/internal/session"
+	"github.com/afrancoc2000/application-helper-ai/internal/tui"
+	"github.com/afrancoc2000/application-helper-ai/internal/usage"
 	"github.com/manifoldco/promptui"
 )
 
@@ -17,56 +21,251 @@ const (
 	apply      = "Apply"
 	doNotApply = "Don't apply"
 	makeBetter = "Add to the query"
+	// correctionPrompt asks the model to fix an answer that couldn't be parsed
+	correctionPrompt = "Your last answer couldn't be parsed: %s. Answer again with only the corrected JSON array of files, without any explanation or markdown."
 )
 
 type Generator struct {
 	appConfig   config.AppConfig
 	client      openai.AIClient
 	fileFactory fileSystem.FileFactory
+	sessions    *session.Store
+	session     *session.Session
+	usageLog    *usage.Log
+	// usage adds up the tokens of the queries of the current turn
+	usage openai.TokenUsage
+	// runUsage adds up the turns of this run
+	runUsage usage.Total
+	// reviewPrompt and editor are used to review the files one by one
+	reviewPrompt reviewPrompt
+	editor       fileEditor
+	// browse shows the files in the terminal interface, it is nil when the
+	// input or the output isn't a terminal
+	browse filesBrowser
 }
 
-func NewGenerator(appConfig config.AppConfig, client openai.AIClient, fileFactory fileSystem.FileFactory) (*Generator, error) {
+// NewGenerator returns a Generator that records the conversation in current
+// and saves it in sessions after every turn, adding the tokens used to the
+// usage log. When current already has messages the conversation continues
+// from them.
+func NewGenerator(appConfig config.AppConfig, client openai.AIClient, fileFactory fileSystem.FileFactory, sessions *session.Store, current *session.Session, usageLog *usage.Log) (*Generator, error) {
+	if len(current.Messages) > 0 {
+		client.SetHistory(current.Messages)
+	}
 
-	return &Generator{
-		appConfig:   appConfig,
-		client:      client,
-		fileFactory: fileFactory,
-	}, nil
+	generator := &Generator{
+		appConfig:    appConfig,
+		client:       client,
+		fileFactory:  fileFactory,
+		sessions:     sessions,
+		session:      current,
+		usageLog:     usageLog,
+		reviewPrompt: promptReview,
+		editor:       editInEditor,
+	}
+	if tui.Supported(os.Stdin, os.Stdout) {
+		generator.browse = browseTerminal
+	}
+	return generator, nil
 }
 
+// Run sends the prompt in args and keeps refining the answer until the user
+// applies it or gives up. Without a prompt it resumes from the files generated
+// in the last turn of the session.
 func (c *Generator) Run(args []string) error {
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
 
-	prompt := args[0]
+	prompt := ""
+	if len(args) > 0 {
+		prompt = args[0]
+	}
+
+	var files []models.AppFile
+	if prompt == "" {
+		turn := c.session.LastTurn()
+		if turn == nil {
+			return fmt.Errorf("prompt must be provided")
+		}
+		fmt.Printf("Resuming session %s: %s\n", c.session.ID, c.session.Title())
+		files = turn.Files
+	}
+	defer fmt.Printf("Continue this session with --%s %s\n", config.ResumeLabel, c.session.ID)
+	defer c.printUsage(os.Stdout)
+
 	var action, queryResult string
 	var err error
-	var files []models.AppFile
 	for action != apply {
 
-		queryResult, err = c.client.QueryOpenAI(ctx, prompt)
-		if err != nil {
-			return err
+		if prompt != "" {
+			var rounds int
+			queryResult, files, rounds, err = c.queryFiles(ctx, os.Stdout, prompt)
+			record := c.recordUsage(os.Stdout)
+			if err != nil {
+				// keep the conversation so the session can still be resumed
+				_ = c.saveSession()
+				return err
+			}
+
+			c.session.AddTurn(prompt, queryResult, files)
+			c.session.LastTurn().RepairRounds = rounds
+			c.session.SetUsage(record)
+			err = c.saveSession()
+			if err != nil {
+				return err
+			}
 		}
 
-		files, err = models.AppFileFromString(queryResult)
-		if err != nil {
-			return err
+		// the terminal interface shows the changes itself
+		if c.browse == nil || c.appConfig.DryRun || c.appConfig.SkipConfirmation {
+			changes, err := c.fileFactory.CompareFiles(files)
+			if err != nil {
+				return err
+			}
+			err = printChanges(os.Stdout, changes, useColors(os.Stdout))
+			if err != nil {
+				return err
+			}
 		}
 
-		printQueryResults(files)
+		if c.appConfig.DryRun {
+			fmt.Println("Dry run, no files were written.")
+			return nil
+		}
 
-		action, err = c.userActionPrompt()
+		action, files, err = c.confirm(ctx, files)
 		if err != nil {
 			return err
 		}
 
-		if action == doNotApply {
+		switch action {
+		case doNotApply:
 			return nil
+		case apply:
+			// the turn keeps the files that are applied
+			c.session.LastTurn().Files = files
+		default:
+			prompt = action
+		}
+	}
+	results, err := c.fileFactory.CreateFiles(files)
+	printResults(os.Stdout, results)
+	if err != nil {
+		return err
+	}
+
+	c.session.LastTurn().Applied = true
+	return c.saveSession()
+}
+
+// queryFiles sends the prompt and parses the files of the answer. When the
+// answer can't be parsed the error is sent back to the model asking for a
+// corrected one, up to the configured number of repair attempts. It returns
+// how many repair rounds were needed.
+func (c *Generator) queryFiles(ctx context.Context, out io.Writer, prompt string) (string, []models.AppFile, int, error) {
+	c.usage = openai.TokenUsage{}
+	preview := newFilePreview(out)
+	answer, err := c.client.QueryOpenAIStream(ctx, prompt, preview.Write)
+	if err != nil {
+		return "", nil, 0, err
+	}
+	c.addUsage(out)
+
+	files, repairs, err := models.ParseAppFiles(answer)
+	rounds := 0
+	for err != nil && rounds < c.appConfig.RepairAttempts {
+		rounds++
+		fmt.Fprintf(out, "%s\nAsking for a corrected answer (attempt %d of %d)...\n", err, rounds, c.appConfig.RepairAttempts)
+
+		answer, err = c.client.QueryOpenAI(ctx, fmt.Sprintf(correctionPrompt, err))
+		if err != nil {
+			return "", nil, rounds, err
+		}
+		c.addUsage(out)
+		files, repairs, err = models.ParseAppFiles(answer)
+	}
+	if err != nil {
+		if rounds > 0 {
+			return "", nil, rounds, fmt.Errorf("%w, still invalid after %d repair attempts", err, rounds)
+		}
+		return "", nil, rounds, err
+	}
+
+	printRepairs(out, repairs)
+	return answer, files, rounds, nil
+}
+
+// addUsage adds the tokens of the last query to the usage of the turn and
+// prints them.
+func (c *Generator) addUsage(out io.Writer) {
+	last := c.client.LastUsage()
+	c.usage = c.usage.Add(last)
+	fmt.Fprintf(out, "Tokens: %d prompt, %d completion\n", last.PromptTokens, last.CompletionTokens)
+}
+
+// recordUsage prices the tokens of the current turn and adds them to the
+// usage of the run and to the usage log. A failure to log is only reported,
+// the generation is more important than the accounting.
+func (c *Generator) recordUsage(out io.Writer) usage.Record {
+	record := usage.NewRecord(c.session.ID, c.appConfig.OpenaiDeployment, c.usage.PromptTokens, c.usage.CompletionTokens, c.usage.Estimated)
+	if c.usage == (openai.TokenUsage{}) {
+		return record
+	}
+
+	c.runUsage.Add(record)
+	if c.usageLog != nil {
+		if err := c.usageLog.Append(record); err != nil {
+			fmt.Fprintf(out, "Couldn't record the usage: %s\n", err)
 		}
-		prompt = action
 	}
-	return c.fileFactory.CreateFiles(files)
+	return record
+}
+
+// printUsage shows the tokens and cost of this run and, when it was resumed,
+// of the whole session.
+func (c *Generator) printUsage(out io.Writer) {
+	if c.runUsage.Turns == 0 {
+		return
+	}
+	fmt.Fprintf(out, "Usage of this run: %s\n", c.runUsage)
+	if len(c.session.Turns) > c.runUsage.Turns {
+		fmt.Fprintf(out, "Usage of the session: %s\n", c.session.Usage())
+	}
+}
+
+func (c *Generator) saveSession() error {
+	c.session.Messages = c.client.History()
+	c.session.Config = session.ConfigFrom(c.appConfig)
+	err := c.sessions.Save(c.session)
+	if err != nil {
+		return fmt.Errorf("couldn't save the session: %w", err)
+	}
+	return nil
+}
+
+// confirm asks the user what to do with the files, in the terminal interface
+// when there is one, and returns the action with the files to apply.
+func (c *Generator) confirm(ctx context.Context, files []models.AppFile) (string, []models.AppFile, error) {
+	if c.appConfig.SkipConfirmation {
+		return apply, files, nil
+	}
+	if c.browse != nil {
+		return c.browseFiles(ctx, files)
+	}
+
+	action, err := c.userActionPrompt()
+	if err != nil || action != reviewEach {
+		return action, files, err
+	}
+	accepted, err := c.reviewFiles(ctx, os.Stdout, files)
+	if err != nil {
+		return doNotApply, nil, err
+	}
+	if len(accepted) == 0 {
+		fmt.Println("No file was accepted, nothing was written.")
+		return doNotApply, nil, nil
+	}
+	return apply, accepted, nil
 }
 
 func (c *Generator) userActionPrompt() (string, error) {
@@ -77,8 +276,8 @@ func (c *Generator) userActionPrompt() (string, error) {
 
 	var result string
 	var err error
-	items := []string{apply, doNotApply}
-	label := fmt.Sprintf("Would you like to apply this? [%s/%s/%s]", makeBetter, apply, doNotApply)
+	items := []string{apply, reviewEach, doNotApply}
+	label := fmt.Sprintf("Would you like to apply this? [%s/%s/%s/%s]", makeBetter, apply, reviewEach, doNotApply)
 
 	prompt := promptui.SelectWithAdd{
 		Label:    label,
@@ -93,11 +292,51 @@ func (c *Generator) userActionPrompt() (string, error) {
 	return result, nil
 }
 
-func printQueryResults(files []models.AppFile) {
-	fmt.Println("These are the files that would be created. Do you want to apply them? or add something to the query?")
-	for index, file := range files {
-		fmt.Printf("%d. File: %s%s:\n", index+1, file.Path, file.Name)
-		fmt.Printf("%s\n", file.Content)
-		fmt.Printf("\n")
+// ConflictPrompt asks the user what to do with a generated file that already
+// exists on disk.
+func ConflictPrompt(change fileSystem.FileChange) (fileSystem.ConflictPolicy, error) {
+	items := []fileSystem.ConflictPolicy{
+		fileSystem.OverwriteOnConflict,
+		fileSystem.BackupOnConflict,
+		fileSystem.SkipOnConflict,
+		fileSystem.FailOnConflict,
+	}
+	prompt := promptui.Select{
+		Label: fmt.Sprintf("%s%s already exists, what would you like to do? [%s/%s/%s/%s]", change.File.Path, change.File.Name, items[0], items[1], items[2], items[3]),
+		Items: items,
+	}
+	index, _, err := prompt.Run()
+	if err != nil {
+		return fileSystem.FailOnConflict, err
+	}
+
+	return items[index], nil
+}
+
+// printRepairs warns about the defects fixed to read the answer, a dropped
+// file in particular means the answer is incomplete.
+func printRepairs(out io.Writer, repairs []models.Repair) {
+	if len(repairs) == 0 {
+		return
+	}
+
+	fmt.Fprintln(out, "The answer wasn't valid JSON, to read it the following was done:")
+	for _, repair := range repairs {
+		fmt.Fprintf(out, "  - %s\n", repair)
+	}
+}
+
+func printResults(out io.Writer, results []fileSystem.FileResult) {
+	if len(results) == 0 {
+		return
+	}
+
+	fmt.Fprintln(out, "Files:")
+	for _, result := range results {
+		fmt.Fprintf(out, "  %-11s %s%s", result.Action, result.Change.File.Path, result.Change.File.Name)
+		if result.Backup != "" {
+			fmt.Fprintf(out, " (previous version saved to %s)", result.Backup)
+		}
+		fmt.Fprintln(out)
 	}
 }
@@ -0,0 +1,125 @@
+package appai
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/afrancoc2000/application-helper-ai/internal/config"
+	"github.com/afrancoc2000/application-helper-ai/internal/models"
+	"github.com/afrancoc2000/application-helper-ai/internal/openai"
+	"github.com/afrancoc2000/application-helper-ai/internal/session"
+	"github.com/afrancoc2000/application-helper-ai/internal/usage"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakeClient answers every query with the next of its answers and records the prompts.
+type fakeClient struct {
+	answers []string
+	prompts []string
+}
+
+func (c *fakeClient) QueryOpenAI(ctx context.Context, prompt string) (string, error) {
+	c.prompts = append(c.prompts, prompt)
+	answer := c.answers[0]
+	c.answers = c.answers[1:]
+	return answer, nil
+}
+
+func (c *fakeClient) QueryOpenAIStream(ctx context.Context, prompt string, onData func(chunk string)) (string, error) {
+	answer, err := c.QueryOpenAI(ctx, prompt)
+	onData(answer)
+	return answer, err
+}
+
+func (c *fakeClient) History() []models.Message {
+	return []models.Message{}
+}
+
+func (c *fakeClient) SetHistory(messages []models.Message) {}
+
+func (c *fakeClient) LastUsage() openai.TokenUsage {
+	return openai.TokenUsage{PromptTokens: 10, CompletionTokens: 5}
+}
+
+func TestGenerator(t *testing.T) {
+	Convey("Generator", t, func() {
+
+		valid := `[{"fileName":"index.html","filePath":"./","fileContent":"<html></html>"}]`
+		client := &fakeClient{}
+		gpt4, _ := models.DeploymentFromName("gpt-4")
+		generator := &Generator{
+			appConfig: config.AppConfig{RepairAttempts: 2, OpenaiDeployment: gpt4},
+			client:    client,
+			session:   session.New(config.AppConfig{}),
+		}
+		out := &bytes.Buffer{}
+
+		Convey("queryFiles valid answer", func() {
+			client.answers = []string{valid}
+
+			answer, files, rounds, err := generator.queryFiles(context.Background(), out, "Create a page")
+			So(err, ShouldBeNil)
+			So(answer, ShouldEqual, valid)
+			So(len(files), ShouldEqual, 1)
+			So(rounds, ShouldEqual, 0)
+			So(client.prompts, ShouldResemble, []string{"Create a page"})
+		})
+
+		Convey("queryFiles asks for a corrected answer", func() {
+			client.answers = []string{"Sorry, I can't do that.", valid}
+
+			_, files, rounds, err := generator.queryFiles(context.Background(), out, "Create a page")
+			So(err, ShouldBeNil)
+			So(len(files), ShouldEqual, 1)
+			So(rounds, ShouldEqual, 1)
+			So(len(client.prompts), ShouldEqual, 2)
+			So(client.prompts[1], ShouldContainSubstring, "doesn't contain a JSON array")
+			So(out.String(), ShouldContainSubstring, "attempt 1 of 2")
+			So(generator.usage, ShouldResemble, openai.TokenUsage{PromptTokens: 20, CompletionTokens: 10})
+		})
+
+		Convey("queryFiles gives up after the repair attempts", func() {
+			client.answers = []string{"no", "still no", "nope"}
+
+			_, _, rounds, err := generator.queryFiles(context.Background(), out, "Create a page")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "after 2 repair attempts")
+			So(rounds, ShouldEqual, 2)
+			So(len(client.answers), ShouldEqual, 0)
+		})
+
+		Convey("queryFiles without repair attempts", func() {
+			generator.appConfig.RepairAttempts = 0
+			client.answers = []string{"no"}
+
+			_, _, rounds, err := generator.queryFiles(context.Background(), out, "Create a page")
+			So(err, ShouldNotBeNil)
+			So(rounds, ShouldEqual, 0)
+			So(len(client.prompts), ShouldEqual, 1)
+		})
+
+		Convey("recordUsage logs and prints the usage", func() {
+			generator.usageLog = usage.NewLog(filepath.Join(t.TempDir(), "usage.jsonl"))
+			client.answers = []string{valid}
+
+			_, files, _, err := generator.queryFiles(context.Background(), out, "Create a page")
+			So(err, ShouldBeNil)
+			record := generator.recordUsage(out)
+			So(*record.Cost, ShouldAlmostEqual, 0.0006)
+			generator.session.AddTurn("Create a page", valid, files)
+			generator.session.SetUsage(record)
+
+			records, err := generator.usageLog.Read()
+			So(err, ShouldBeNil)
+			So(records, ShouldHaveLength, 1)
+			So(records[0].PromptTokens, ShouldEqual, 10)
+
+			generator.printUsage(out)
+			So(out.String(), ShouldContainSubstring, "Tokens: 10 prompt, 5 completion")
+			So(out.String(), ShouldContainSubstring, "Usage of this run: 10 prompt + 5 completion tokens, $0.0006")
+			So(out.String(), ShouldNotContainSubstring, "Usage of the session")
+		})
+	})
+}
@@ -0,0 +1,58 @@
+package appai
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/afrancoc2000/application-helper-ai/internal/models"
+)
+
+// filePreview prints the files of a streamed answer while they are being
+// received, every file as a numbered "File: <path><name>:" header followed by
+// its content.
+type filePreview struct {
+	out     io.Writer
+	decoder *models.AppFileStreamDecoder
+	file    models.AppFile
+	header  bool
+}
+
+func newFilePreview(out io.Writer) *filePreview {
+	preview := &filePreview{out: out}
+	preview.decoder = models.NewAppFileStreamDecoder(preview.onEvent)
+	fmt.Fprintln(out, "These are the files that would be created. Do you want to apply them? or add something to the query?")
+	return preview
+}
+
+func (p *filePreview) Write(chunk string) {
+	p.decoder.Write(chunk)
+}
+
+func (p *filePreview) onEvent(event models.AppFileEvent) {
+	switch event.Kind {
+	case models.FileStarted:
+		p.file = models.AppFile{}
+		p.header = false
+	case models.FieldCompleted:
+		switch event.Field {
+		case models.FileNameField:
+			p.file.Name = event.Text
+		case models.FilePathField:
+			p.file.Path = event.Text
+		}
+	case models.FieldFragment:
+		p.printHeader(event.Index)
+		fmt.Fprint(p.out, event.Text)
+	case models.FileCompleted:
+		p.printHeader(event.Index)
+		fmt.Fprint(p.out, "\n\n")
+	}
+}
+
+func (p *filePreview) printHeader(index int) {
+	if p.header {
+		return
+	}
+	p.header = true
+	fmt.Fprintf(p.out, "%d. File: %s%s:\n", index+1, p.file.Path, p.file.Name)
+}
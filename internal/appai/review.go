@@ -0,0 +1,213 @@
+package appai
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	fileSystem "github.com/afrancoc2000/application-helper-ai/internal/file_system"
+	"github.com/afrancoc2000/application-helper-ai/internal/models"
+	"github.com/manifoldco/promptui"
+)
+
+const (
+	reviewEach = "Review each file"
+	// regeneratePrompt asks the model for a new version of a single file
+	regeneratePrompt = "Generate again only the file %s%s, the other files stay as they are. Answer with a JSON array containing only that file."
+)
+
+type reviewAction string
+
+const (
+	acceptFile     reviewAction = "Accept"
+	skipFile       reviewAction = "Skip"
+	editFile       reviewAction = "Edit in $EDITOR"
+	regenerateFile reviewAction = "Regenerate"
+)
+
+// reviewDecision is what the user chose for a file, with the instructions
+// for the model when it is regenerated.
+type reviewDecision struct {
+	action       reviewAction
+	instructions string
+}
+
+// reviewPrompt asks what to do with a generated file.
+type reviewPrompt func(change fileSystem.FileChange) (reviewDecision, error)
+
+// fileEditor returns the content of a file after the user changed it.
+type fileEditor func(file models.AppFile) (string, error)
+
+// reviewFiles asks the user to accept, skip, edit or regenerate every file and
+// returns the accepted ones with their changes. A regenerated file is a new
+// turn of the session, with the files as they are at that point.
+func (c *Generator) reviewFiles(ctx context.Context, out io.Writer, files []models.AppFile) ([]models.AppFile, error) {
+	colored := false
+	if file, ok := out.(*os.File); ok {
+		colored = useColors(file)
+	}
+
+	files = append([]models.AppFile{}, files...)
+	accepted := []models.AppFile{}
+	for index := 0; index < len(files); index++ {
+		reviewed := false
+		for !reviewed {
+			changes, err := c.fileFactory.CompareFiles(files[index : index+1])
+			if err != nil {
+				return nil, err
+			}
+			fmt.Fprintf(out, "File %d of %d: ", index+1, len(files))
+			err = printChange(out, changes[0], colored)
+			if err != nil {
+				return nil, err
+			}
+
+			decision, err := c.reviewPrompt(changes[0])
+			if err != nil {
+				return nil, err
+			}
+			switch decision.action {
+			case acceptFile:
+				accepted = append(accepted, files[index])
+				reviewed = true
+			case skipFile:
+				reviewed = true
+			case editFile:
+				content, err := c.editor(files[index])
+				if err != nil {
+					fmt.Fprintf(out, "Couldn't edit the file: %s\n", err)
+					continue
+				}
+				files[index].Content = content
+			case regenerateFile:
+				regenerated, err := c.regenerateFile(ctx, out, files, index, decision.instructions)
+				if err != nil {
+					if ctx.Err() != nil {
+						return nil, err
+					}
+					fmt.Fprintf(out, "Couldn't regenerate the file: %s\n", err)
+					continue
+				}
+				files = regenerated
+			}
+		}
+	}
+	return accepted, nil
+}
+
+// regenerateFile asks the model for a new version of a file and returns the
+// files with it. The other files of the answer, if any, are ignored.
+func (c *Generator) regenerateFile(ctx context.Context, out io.Writer, files []models.AppFile, index int, instructions string) ([]models.AppFile, error) {
+	file := files[index]
+	prompt := fmt.Sprintf(regeneratePrompt, file.Path, file.Name)
+	if instructions != "" {
+		prompt = fmt.Sprintf("%s %s", prompt, instructions)
+	}
+
+	answer, generated, rounds, err := c.queryFiles(ctx, out, prompt)
+	record := c.recordUsage(out)
+	if err != nil {
+		_ = c.saveSession()
+		return nil, err
+	}
+
+	regenerated, ok := findFile(generated, file)
+	if !ok {
+		if len(generated) != 1 {
+			return nil, fmt.Errorf("the answer doesn't contain %s%s", file.Path, file.Name)
+		}
+		// the model answered with a single file under another name
+		regenerated = models.AppFile{Name: file.Name, Path: file.Path, Content: generated[0].Content}
+	}
+
+	files = append([]models.AppFile{}, files...)
+	files[index] = regenerated
+	c.session.AddTurn(prompt, answer, files)
+	c.session.LastTurn().RepairRounds = rounds
+	c.session.SetUsage(record)
+	return files, c.saveSession()
+}
+
+// findFile returns the file with the same path and name.
+func findFile(files []models.AppFile, target models.AppFile) (models.AppFile, bool) {
+	for _, file := range files {
+		if filepath.Join(file.Path, file.Name) == filepath.Join(target.Path, target.Name) {
+			return file, true
+		}
+	}
+	return models.AppFile{}, false
+}
+
+// promptReview asks what to do with a file, and for the changes wanted when it
+// is regenerated.
+func promptReview(change fileSystem.FileChange) (reviewDecision, error) {
+	items := []reviewAction{acceptFile, skipFile, editFile, regenerateFile}
+	prompt := promptui.Select{
+		Label: fmt.Sprintf("What would you like to do with %s%s? [%s/%s/%s/%s]", change.File.Path, change.File.Name, items[0], items[1], items[2], items[3]),
+		Items: items,
+	}
+	index, _, err := prompt.Run()
+	if err != nil {
+		return reviewDecision{}, err
+	}
+	if items[index] != regenerateFile {
+		return reviewDecision{action: items[index]}, nil
+	}
+
+	instructions := promptui.Prompt{Label: "What should change? Leave it empty to just generate it again"}
+	text, err := instructions.Run()
+	if err != nil {
+		return reviewDecision{}, err
+	}
+	return reviewDecision{action: regenerateFile, instructions: strings.TrimSpace(text)}, nil
+}
+
+// editInEditor opens the file in $VISUAL or $EDITOR, or vi when none is set,
+// and returns its content once the editor is closed.
+func editInEditor(file models.AppFile) (string, error) {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		}
+	}
+
+	// the extension is kept so the editor highlights the syntax
+	temp, err := os.CreateTemp("", "*-"+file.Name)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(temp.Name())
+	_, err = temp.WriteString(file.Content)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// the editor can have arguments, like "code --wait"
+	args := strings.Fields(editor)
+	command := exec.Command(args[0], append(args[1:], temp.Name())...)
+	command.Stdin = os.Stdin
+	command.Stdout = os.Stdout
+	command.Stderr = os.Stderr
+	if err := command.Run(); err != nil {
+		return "", fmt.Errorf("%s failed: %w", editor, err)
+	}
+
+	content, err := os.ReadFile(temp.Name())
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
@@ -0,0 +1,131 @@
+package appai
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/afrancoc2000/application-helper-ai/internal/config"
+	fileSystem "github.com/afrancoc2000/application-helper-ai/internal/file_system"
+	"github.com/afrancoc2000/application-helper-ai/internal/models"
+	"github.com/afrancoc2000/application-helper-ai/internal/session"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestReview(t *testing.T) {
+	Convey("Review", t, func() {
+
+		dir := t.TempDir()
+		client := &fakeClient{}
+		gpt4, _ := models.DeploymentFromName("gpt-4")
+		current := session.New(config.AppConfig{})
+		files := []models.AppFile{
+			{Name: "index.html", Path: "./", Content: "<h1>Hello</h1>"},
+			{Name: "style.css", Path: "./", Content: "h1 {}"},
+			{Name: "app.js", Path: "./src/", Content: "alert(1)"},
+		}
+		current.AddTurn("Create a page", "[]", files)
+
+		// decisions are the answers of the user, in order
+		decisions := []reviewDecision{}
+		reviewed := []string{}
+		generator := &Generator{
+			appConfig:   config.AppConfig{RepairAttempts: 2, OpenaiDeployment: gpt4},
+			client:      client,
+			fileFactory: fileSystem.NewFileFactory(dir, fileSystem.OverwriteOnConflict, nil),
+			sessions:    session.NewStore(filepath.Join(dir, "sessions")),
+			session:     current,
+			reviewPrompt: func(change fileSystem.FileChange) (reviewDecision, error) {
+				reviewed = append(reviewed, change.File.Name)
+				decision := decisions[0]
+				decisions = decisions[1:]
+				return decision, nil
+			},
+			editor: func(file models.AppFile) (string, error) {
+				return file.Content + " edited", nil
+			},
+		}
+		out := &bytes.Buffer{}
+
+		Convey("Returns the accepted files", func() {
+			decisions = []reviewDecision{{action: acceptFile}, {action: skipFile}, {action: acceptFile}}
+
+			accepted, err := generator.reviewFiles(context.Background(), out, files)
+			So(err, ShouldBeNil)
+			So(accepted, ShouldResemble, []models.AppFile{files[0], files[2]})
+			So(out.String(), ShouldContainSubstring, "File 2 of 3: ./style.css (new)")
+		})
+
+		Convey("Edits a file before accepting it", func() {
+			decisions = []reviewDecision{{action: editFile}, {action: acceptFile}, {action: skipFile}, {action: skipFile}}
+
+			accepted, err := generator.reviewFiles(context.Background(), out, files)
+			So(err, ShouldBeNil)
+			So(accepted, ShouldHaveLength, 1)
+			So(accepted[0].Content, ShouldEqual, "<h1>Hello</h1> edited")
+			So(reviewed, ShouldResemble, []string{"index.html", "index.html", "style.css", "app.js"})
+			// the generated files are left as they were
+			So(files[0].Content, ShouldEqual, "<h1>Hello</h1>")
+		})
+
+		Convey("Keeps reviewing when the editor fails", func() {
+			generator.editor = func(file models.AppFile) (string, error) {
+				return "", errors.New("no editor")
+			}
+			decisions = []reviewDecision{{action: editFile}, {action: acceptFile}, {action: skipFile}, {action: skipFile}}
+
+			accepted, err := generator.reviewFiles(context.Background(), out, files)
+			So(err, ShouldBeNil)
+			So(accepted, ShouldResemble, []models.AppFile{files[0]})
+			So(out.String(), ShouldContainSubstring, "Couldn't edit the file: no editor")
+		})
+
+		Convey("Regenerates a file as a new turn", func() {
+			client.answers = []string{`[{"fileName":"style.css","filePath":"./","fileContent":"h1 { color: red; }"}]`}
+			decisions = []reviewDecision{{action: skipFile}, {action: regenerateFile, instructions: "Make the title red."}, {action: acceptFile}, {action: acceptFile}}
+
+			accepted, err := generator.reviewFiles(context.Background(), out, files)
+			So(err, ShouldBeNil)
+			So(accepted, ShouldResemble, []models.AppFile{{Name: "style.css", Path: "./", Content: "h1 { color: red; }"}, files[2]})
+			So(client.prompts, ShouldHaveLength, 1)
+			So(client.prompts[0], ShouldStartWith, "Generate again only the file ./style.css")
+			So(client.prompts[0], ShouldEndWith, "Make the title red.")
+
+			So(current.Turns, ShouldHaveLength, 2)
+			So(current.LastTurn().Files[0], ShouldResemble, files[0])
+			So(current.LastTurn().Files[1].Content, ShouldEqual, "h1 { color: red; }")
+			So(current.LastTurn().PromptTokens, ShouldEqual, 10)
+		})
+
+		Convey("Asks again when the regenerated file is missing", func() {
+			client.answers = []string{`[{"fileName":"a.txt","filePath":"./","fileContent":"a"},{"fileName":"b.txt","filePath":"./","fileContent":"b"}]`}
+			decisions = []reviewDecision{{action: regenerateFile}, {action: acceptFile}, {action: skipFile}, {action: skipFile}}
+
+			accepted, err := generator.reviewFiles(context.Background(), out, files)
+			So(err, ShouldBeNil)
+			So(accepted, ShouldResemble, []models.AppFile{files[0]})
+			So(out.String(), ShouldContainSubstring, "the answer doesn't contain ./index.html")
+		})
+	})
+
+	Convey("editInEditor", t, func() {
+		if runtime.GOOS == "windows" {
+			return
+		}
+
+		editor := filepath.Join(t.TempDir(), "editor.sh")
+		So(os.WriteFile(editor, []byte("#!/bin/sh\necho \"$1\" >> \"$1\"\n"), 0o700), ShouldBeNil)
+		t.Setenv("VISUAL", "")
+		t.Setenv("EDITOR", editor)
+
+		content, err := editInEditor(models.AppFile{Name: "index.html", Path: "./", Content: "<h1>Hello</h1>\n"})
+		So(err, ShouldBeNil)
+		So(content, ShouldStartWith, "<h1>Hello</h1>\n")
+		// the temporary file keeps the name of the file
+		So(content, ShouldEndWith, "-index.html\n")
+	})
+}
@@ -0,0 +1,179 @@
+// Package auth gets the Azure AD tokens used to call Azure OpenAI when key
+// authentication is disabled.
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	KeyMethod               Method = "key"
+	ClientCredentialsMethod Method = "client-credentials"
+	AzureCLIMethod          Method = "azure-cli"
+	EnvironmentMethod       Method = "env"
+	ManagedIdentityMethod   Method = "managed-identity"
+)
+
+const (
+	// Scope is the scope of the tokens accepted by Azure OpenAI.
+	Scope = "https://cognitiveservices.azure.com/.default"
+	// Resource is the scope without the suffix, used by the managed identity
+	// endpoint.
+	Resource             = "https://cognitiveservices.azure.com"
+	DefaultAuthorityHost = "https://login.microsoftonline.com"
+	// refreshMargin is how long before it expires a token is replaced, so it
+	// doesn't expire during a long answer.
+	refreshMargin = 5 * time.Minute
+)
+
+// Method is how the requests to Azure OpenAI are authenticated.
+type Method string
+
+// Methods returns the supported authentication methods.
+func Methods() []string {
+	return []string{
+		string(KeyMethod),
+		string(ClientCredentialsMethod),
+		string(AzureCLIMethod),
+		string(EnvironmentMethod),
+		string(ManagedIdentityMethod),
+	}
+}
+
+// ParseMethod validates an authentication method, empty means key.
+func ParseMethod(value string) (Method, error) {
+	if value == "" {
+		return KeyMethod, nil
+	}
+	for _, method := range Methods() {
+		if value == method {
+			return Method(value), nil
+		}
+	}
+	return "", fmt.Errorf("invalid authentication method %q, please choose one of these options: %s", value, strings.Join(Methods(), ", "))
+}
+
+// Token is a bearer token and when it expires, a zero ExpiresOn means it is
+// unknown.
+type Token struct {
+	Value     string
+	ExpiresOn time.Time
+}
+
+func (t Token) expired(now time.Time) bool {
+	return !t.ExpiresOn.IsZero() && !now.Before(t.ExpiresOn)
+}
+
+// TokenProvider returns a valid token for Azure OpenAI.
+type TokenProvider interface {
+	Token(ctx context.Context) (Token, error)
+}
+
+// Settings configure the token providers.
+type Settings struct {
+	Method       Method
+	TenantID     string
+	ClientID     string
+	ClientSecret string
+	// AuthorityHost is the Azure AD host, defaults to the public cloud.
+	AuthorityHost string
+	// TokenCache is the MSAL token cache of the Azure CLI, defaults to
+	// ~/.azure/msal_token_cache.json.
+	TokenCache string
+	// IdentityEndpoint is the managed identity endpoint, defaults to the
+	// instance metadata service.
+	IdentityEndpoint string
+}
+
+// UsesTokens returns whether the requests are authenticated with tokens
+// instead of the API key.
+func (s Settings) UsesTokens() bool {
+	return s.Method != "" && s.Method != KeyMethod
+}
+
+// Validate checks the settings needed by the method are set.
+func (s Settings) Validate() error {
+	if s.Method == ClientCredentialsMethod && (s.TenantID == "" || s.ClientID == "" || s.ClientSecret == "") {
+		return fmt.Errorf("the %s authentication needs a tenant ID, a client ID and a client secret", s.Method)
+	}
+	return nil
+}
+
+// NewTokenProvider returns the provider of the configured method, renewing
+// the tokens before they expire. The HTTP client is used to request them.
+func NewTokenProvider(settings Settings, httpClient *http.Client) (TokenProvider, error) {
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+
+	var source TokenProvider
+	switch settings.Method {
+	case ClientCredentialsMethod:
+		source = newClientCredentials(settings, httpClient)
+	case AzureCLIMethod:
+		cache, err := newAzureCLICache(settings)
+		if err != nil {
+			return nil, err
+		}
+		source = cache
+	case EnvironmentMethod:
+		source = environmentToken{}
+	case ManagedIdentityMethod:
+		source = newManagedIdentity(settings, httpClient)
+	default:
+		return nil, fmt.Errorf("the %s authentication doesn't use tokens", settings.Method)
+	}
+	return &refreshingProvider{source: source, now: time.Now}, nil
+}
+
+// refreshingProvider keeps the token of a source until it is about to
+// expire, so a new one is only requested when needed.
+type refreshingProvider struct {
+	source TokenProvider
+	now    func() time.Time
+	mutex  sync.Mutex
+	token  Token
+}
+
+func (p *refreshingProvider) Token(ctx context.Context) (Token, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.token.Value != "" && (p.token.ExpiresOn.IsZero() || p.now().Add(refreshMargin).Before(p.token.ExpiresOn)) {
+		return p.token, nil
+	}
+
+	token, err := p.source.Token(ctx)
+	if err != nil {
+		return Token{}, err
+	}
+	if token.expired(p.now()) {
+		return Token{}, fmt.Errorf("the Azure AD token expired at %s", token.ExpiresOn.Local().Format(time.RFC1123))
+	}
+	p.token = token
+	return token, nil
+}
+
+// Transport authenticates the requests with a bearer token instead of the
+// api-key header set by the clients.
+type Transport struct {
+	Base   http.RoundTripper
+	Tokens TokenProvider
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.Tokens.Token(req.Context())
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get an Azure AD token: %w", err)
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Del("api-key")
+	req.Header.Set("Authorization", "Bearer "+token.Value)
+	return t.Base.RoundTrip(req)
+}
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// msalTokenCache is the part of the MSAL token cache of the Azure CLI with
+// the access tokens.
+type msalTokenCache struct {
+	AccessToken map[string]msalAccessToken `json:"AccessToken"`
+}
+
+type msalAccessToken struct {
+	Secret    string `json:"secret"`
+	Target    string `json:"target"`
+	Realm     string `json:"realm"`
+	ExpiresOn string `json:"expires_on"`
+}
+
+// azureCLICache reads the tokens the Azure CLI saved for Azure OpenAI, the
+// file is read again on every refresh to find the tokens the CLI renewed.
+type azureCLICache struct {
+	path     string
+	tenantID string
+}
+
+func newAzureCLICache(settings Settings) (*azureCLICache, error) {
+	path := settings.TokenCache
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(home, ".azure", "msal_token_cache.json")
+	}
+	return &azureCLICache{path: path, tenantID: settings.TenantID}, nil
+}
+
+func (c *azureCLICache) Token(ctx context.Context) (Token, error) {
+	content, err := os.ReadFile(c.path)
+	if err != nil {
+		return Token{}, fmt.Errorf("couldn't read the Azure CLI token cache, run az login first: %w", err)
+	}
+	cache := msalTokenCache{}
+	if err := json.Unmarshal(content, &cache); err != nil {
+		return Token{}, fmt.Errorf("invalid Azure CLI token cache %s: %w", c.path, err)
+	}
+
+	// the token that expires last is the one most likely to still be valid
+	best := Token{}
+	for _, entry := range cache.AccessToken {
+		if !strings.Contains(entry.Target, Resource) || (c.tenantID != "" && !strings.EqualFold(entry.Realm, c.tenantID)) {
+			continue
+		}
+		seconds, err := strconv.ParseInt(entry.ExpiresOn, 10, 64)
+		if err != nil {
+			continue
+		}
+		expiresOn := time.Unix(seconds, 0)
+		if expiresOn.After(best.ExpiresOn) {
+			best = Token{Value: entry.Secret, ExpiresOn: expiresOn}
+		}
+	}
+
+	if best.Value == "" || best.expired(time.Now()) {
+		return Token{}, fmt.Errorf("there is no valid Azure OpenAI token in the Azure CLI token cache %s, run: az account get-access-token --resource %s", c.path, Resource)
+	}
+	return best, nil
+}
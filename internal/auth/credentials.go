@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const defaultIdentityEndpoint = "http://169.254.169.254/metadata/identity/oauth2/token"
+
+// tokenResponse is the answer of the Azure AD and managed identity token
+// endpoints, the managed identity one sends the numbers as strings.
+type tokenResponse struct {
+	AccessToken      string      `json:"access_token"`
+	ExpiresIn        json.Number `json:"expires_in"`
+	ExpiresOn        json.Number `json:"expires_on"`
+	Error            string      `json:"error"`
+	ErrorDescription string      `json:"error_description"`
+}
+
+func (r tokenResponse) token(now time.Time) Token {
+	token := Token{Value: r.AccessToken}
+	if seconds, err := r.ExpiresIn.Int64(); err == nil {
+		token.ExpiresOn = now.Add(time.Duration(seconds) * time.Second)
+	} else if unix, err := r.ExpiresOn.Int64(); err == nil {
+		token.ExpiresOn = time.Unix(unix, 0)
+	}
+	return token
+}
+
+// requestToken sends a token request and reads the token from the answer.
+func requestToken(httpClient *http.Client, req *http.Request) (Token, error) {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return Token{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Token{}, err
+	}
+	result := tokenResponse{}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return Token{}, fmt.Errorf("invalid token response with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if resp.StatusCode != http.StatusOK || result.AccessToken == "" {
+		return Token{}, fmt.Errorf("token request failed with status %d: %s %s", resp.StatusCode, result.Error, result.ErrorDescription)
+	}
+	return result.token(time.Now()), nil
+}
+
+// clientCredentials requests tokens for a service principal with its secret.
+type clientCredentials struct {
+	httpClient *http.Client
+	url        string
+	form       url.Values
+}
+
+func newClientCredentials(settings Settings, httpClient *http.Client) *clientCredentials {
+	authorityHost := settings.AuthorityHost
+	if authorityHost == "" {
+		authorityHost = DefaultAuthorityHost
+	}
+	return &clientCredentials{
+		httpClient: httpClient,
+		url:        fmt.Sprintf("%s/%s/oauth2/v2.0/token", strings.TrimSuffix(authorityHost, "/"), url.PathEscape(settings.TenantID)),
+		form: url.Values{
+			"grant_type":    {"client_credentials"},
+			"client_id":     {settings.ClientID},
+			"client_secret": {settings.ClientSecret},
+			"scope":         {Scope},
+		},
+	}
+}
+
+func (c *clientCredentials) Token(ctx context.Context) (Token, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, strings.NewReader(c.form.Encode()))
+	if err != nil {
+		return Token{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return requestToken(c.httpClient, req)
+}
+
+// managedIdentity requests tokens for the identity of the Azure resource the
+// application runs on, the user assigned one when a client ID is set.
+type managedIdentity struct {
+	httpClient *http.Client
+	url        string
+}
+
+func newManagedIdentity(settings Settings, httpClient *http.Client) *managedIdentity {
+	endpoint := settings.IdentityEndpoint
+	if endpoint == "" {
+		endpoint = defaultIdentityEndpoint
+	}
+	query := url.Values{
+		"api-version": {"2018-02-01"},
+		"resource":    {Resource},
+	}
+	if settings.ClientID != "" {
+		query.Set("client_id", settings.ClientID)
+	}
+	return &managedIdentity{httpClient: httpClient, url: endpoint + "?" + query.Encode()}
+}
+
+func (m *managedIdentity) Token(ctx context.Context) (Token, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.url, nil)
+	if err != nil {
+		return Token{}, err
+	}
+	req.Header.Set("Metadata", "true")
+	return requestToken(m.httpClient, req)
+}
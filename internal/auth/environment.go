@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// TokenVariable is the environment variable with the token used by the env
+// authentication, injected by the platform running the application.
+const TokenVariable = "AZURE_OPENAI_AD_TOKEN"
+
+// environmentToken reads the token from the environment, its expiration is
+// taken from the token when it is a JWT.
+type environmentToken struct{}
+
+func (environmentToken) Token(ctx context.Context) (Token, error) {
+	value := strings.TrimSpace(os.Getenv(TokenVariable))
+	if value == "" {
+		return Token{}, fmt.Errorf("the %s environment variable is not set", TokenVariable)
+	}
+	value = strings.TrimPrefix(value, "Bearer ")
+	return Token{Value: value, ExpiresOn: jwtExpiration(value)}, nil
+}
+
+// jwtExpiration returns the exp claim of a JWT without validating it, or the
+// zero time when the token isn't a JWT.
+func jwtExpiration(token string) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}
+	}
+	claims := struct {
+		Expiration int64 `json:"exp"`
+	}{}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Expiration == 0 {
+		return time.Time{}
+	}
+	return time.Unix(claims.Expiration, 0)
+}
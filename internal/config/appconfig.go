@@ -1,6 +1,15 @@
 package config
 
 import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/afrancoc2000/application-helper-ai/internal/auth"
+	fileSystem "github.com/afrancoc2000/application-helper-ai/internal/file_system"
+	"github.com/afrancoc2000/application-helper-ai/internal/keyring"
 	"github.com/afrancoc2000/application-helper-ai/internal/models"
 	"github.com/spf13/viper"
 )
@@ -14,9 +23,79 @@ const (
 	SkipConfirmationLabel     = "skipConfirmation"
 	TemperatureLabel          = "temperature"
 	ChatContextLabel          = "chatContext"
+	ProviderLabel             = "provider"
+	BaseURLLabel              = "baseUrl"
+	ModelCatalogLabel         = "modelCatalog"
+	OutputDirLabel            = "outputDir"
+	DryRunLabel               = "dryRun"
+	ConflictPolicyLabel       = "conflictPolicy"
+	ResumeLabel               = "resume"
+	RepairAttemptsLabel       = "repairAttempts"
+	StructuredOutputLabel     = "structuredOutput"
+	MaxRetriesLabel           = "maxRetries"
+	RetryDelayLabel           = "retryDelay"
+	RetryMaxDelayLabel        = "retryMaxDelay"
+	RecordCassetteLabel       = "record"
+	ReplayCassetteLabel       = "replay"
+	ProxyLabel                = "proxy"
+	CABundleLabel             = "caBundle"
+	HeadersLabel              = "header"
+	TimeoutLabel              = "timeout"
+	AzureAuthLabel            = "azureAuth"
+	AzureTenantIDLabel        = "azureTenantId"
+	AzureClientIDLabel        = "azureClientId"
+	AzureClientSecretLabel    = "azureClientSecret"
+	AzureAuthorityHostLabel   = "azureAuthorityHost"
+	AzureTokenCacheLabel      = "azureTokenCache"
+	ConfigFileLabel           = "config"
+	ProfileLabel              = "profile"
+	KeyringLabel              = "keyring"
 	choices                   = 1
 )
 
+// headerStart finds the commas that separate the headers of an environment
+// variable, the ones followed by the name of the next header, so the commas
+// inside header values are kept.
+var headerStart = regexp.MustCompile(`,\s*[A-Za-z0-9!#$%&'*+.^_|~-]+\s*:`)
+
+const (
+	OpenAIProvider = "openai"
+	AzureProvider  = "azure"
+	OllamaProvider = "ollama"
+)
+
+// ProviderCapabilities tells the configuration what a provider needs.
+type ProviderCapabilities struct {
+	// AnyModel is set for local servers, which can serve any model, so the
+	// deployment name isn't validated against the model catalog.
+	AnyModel bool
+	// NeedsAPIKey is set when the requests are authenticated with the API key.
+	NeedsAPIKey bool
+}
+
+var providerCapabilities = map[string]ProviderCapabilities{
+	OpenAIProvider: {NeedsAPIKey: true},
+	AzureProvider:  {NeedsAPIKey: true},
+	OllamaProvider: {AnyModel: true},
+}
+
+// RegisterProvider declares the capabilities of a provider, registering a name
+// twice replaces them. openai.RegisterProvider calls it for the providers it
+// adds.
+func RegisterProvider(name string, capabilities ProviderCapabilities) {
+	providerCapabilities[name] = capabilities
+}
+
+// Capabilities returns the capabilities of the configured provider. The ones
+// that aren't registered need an API key and a model of the catalog.
+func (c *AppConfig) Capabilities() ProviderCapabilities {
+	capabilities, ok := providerCapabilities[c.ProviderName()]
+	if !ok {
+		return ProviderCapabilities{NeedsAPIKey: true}
+	}
+	return capabilities
+}
+
 type AppConfig struct {
 	OpenaiApiKey         string
 	OpenaiDeploymentName string
@@ -26,6 +105,26 @@ type AppConfig struct {
 	SkipConfirmation     bool
 	Temperature          float32
 	ChatContext          string
+	Provider             string
+	BaseURL              string
+	ModelCatalog         string
+	Catalog              *models.Catalog
+	OutputDir            string
+	DryRun               bool
+	ConflictPolicy       fileSystem.ConflictPolicy
+	RepairAttempts       int
+	StructuredOutput     bool
+	MaxRetries           int
+	RetryDelay           time.Duration
+	RetryMaxDelay        time.Duration
+	RecordCassette       string
+	ReplayCassette       string
+	Proxy                string
+	CABundle             string
+	Headers              map[string]string
+	Timeout              time.Duration
+	AzureAuth            auth.Settings
+	Keyring              keyring.Backend
 	Choices              int
 }
 
@@ -38,13 +137,199 @@ func (c *AppConfig) Initialize(viperConfig viper.Viper) error {
 	c.SkipConfirmation = viperConfig.GetBool(SkipConfirmationLabel)
 	c.Temperature = float32(viperConfig.GetFloat64(TemperatureLabel))
 	c.ChatContext = viperConfig.GetString(ChatContextLabel)
+	c.Provider = viperConfig.GetString(ProviderLabel)
+	c.BaseURL = viperConfig.GetString(BaseURLLabel)
+	c.ModelCatalog = viperConfig.GetString(ModelCatalogLabel)
+	c.OutputDir = viperConfig.GetString(OutputDirLabel)
+	if c.OutputDir == "" {
+		c.OutputDir = "."
+	}
+	c.DryRun = viperConfig.GetBool(DryRunLabel)
+	c.RepairAttempts = viperConfig.GetInt(RepairAttemptsLabel)
+	if c.RepairAttempts < 0 {
+		return fmt.Errorf("%s can't be negative", RepairAttemptsLabel)
+	}
+	// structured output is used unless it was explicitly turned off
+	c.StructuredOutput = !viperConfig.IsSet(StructuredOutputLabel) || viperConfig.GetBool(StructuredOutputLabel)
+	c.MaxRetries = viperConfig.GetInt(MaxRetriesLabel)
+	if c.MaxRetries < 0 {
+		return fmt.Errorf("%s can't be negative", MaxRetriesLabel)
+	}
+	c.RetryDelay = viperConfig.GetDuration(RetryDelayLabel)
+	if c.RetryDelay < 0 {
+		return fmt.Errorf("%s can't be negative", RetryDelayLabel)
+	}
+	c.RetryMaxDelay = viperConfig.GetDuration(RetryMaxDelayLabel)
+	if c.RetryMaxDelay < c.RetryDelay {
+		return fmt.Errorf("%s can't be smaller than %s", RetryMaxDelayLabel, RetryDelayLabel)
+	}
+	c.RecordCassette = viperConfig.GetString(RecordCassetteLabel)
+	c.ReplayCassette = viperConfig.GetString(ReplayCassetteLabel)
+	if c.RecordCassette != "" && c.ReplayCassette != "" {
+		return fmt.Errorf("%s and %s can't be used together", RecordCassetteLabel, ReplayCassetteLabel)
+	}
+	c.Proxy = viperConfig.GetString(ProxyLabel)
+	if c.Proxy != "" {
+		if err := validateProxy(c.Proxy); err != nil {
+			return err
+		}
+	}
+	c.CABundle = viperConfig.GetString(CABundleLabel)
+	headers, err := ParseHeaders(headerList(viperConfig))
+	if err != nil {
+		return err
+	}
+	c.Headers = headers
+	c.Timeout = viperConfig.GetDuration(TimeoutLabel)
+	if c.Timeout < 0 {
+		return fmt.Errorf("%s can't be negative", TimeoutLabel)
+	}
+
+	method, err := auth.ParseMethod(viperConfig.GetString(AzureAuthLabel))
+	if err != nil {
+		return err
+	}
+	c.AzureAuth = auth.Settings{
+		Method:        method,
+		TenantID:      viperConfig.GetString(AzureTenantIDLabel),
+		ClientID:      viperConfig.GetString(AzureClientIDLabel),
+		ClientSecret:  viperConfig.GetString(AzureClientSecretLabel),
+		AuthorityHost: viperConfig.GetString(AzureAuthorityHostLabel),
+		TokenCache:    viperConfig.GetString(AzureTokenCacheLabel),
+	}
+	if err := c.AzureAuth.Validate(); err != nil {
+		return err
+	}
+	if c.AzureAuth.UsesTokens() && c.ProviderName() != AzureProvider {
+		return fmt.Errorf("%s %s is only supported by the %s provider", AzureAuthLabel, method, AzureProvider)
+	}
+
+	backend, err := keyring.ParseBackend(viperConfig.GetString(KeyringLabel))
+	if err != nil {
+		return err
+	}
+	c.Keyring = backend
+	if c.OpenaiApiKey == "" && c.needsAPIKey() {
+		key, err := StoredAPIKey(c.Keyring, viperConfig.GetString(ProfileLabel))
+		if err != nil {
+			return err
+		}
+		c.OpenaiApiKey = key
+	}
 
-	deployment, err := models.DeploymentFromName(c.OpenaiDeploymentName)
+	conflictPolicy := viperConfig.GetString(ConflictPolicyLabel)
+	if conflictPolicy == "" {
+		conflictPolicy = string(defaultConflictPolicy(c.SkipConfirmation))
+	}
+	policy, err := fileSystem.ParseConflictPolicy(conflictPolicy)
 	if err != nil {
 		return err
 	}
+	c.ConflictPolicy = policy
+
+	catalogPath := c.ModelCatalog
+	if catalogPath == "" {
+		catalogPath = defaultModelCatalog()
+	}
+	catalog, err := models.LoadCatalog(catalogPath)
+	if err != nil {
+		return err
+	}
+	c.Catalog = catalog
+
+	deployment, err := catalog.Deployment(c.OpenaiDeploymentName)
+	if err != nil {
+		// local servers can serve any model, so their names can't be validated
+		if !c.Capabilities().AnyModel {
+			return err
+		}
+		deployment = models.LocalDeployment(c.OpenaiDeploymentName)
+	}
 	c.OpenaiDeployment = deployment
 	c.Choices = choices
 
 	return nil
 }
+
+// defaultConflictPolicy asks about every existing file unless the user asked to
+// skip confirmations, in which case existing files are never touched.
+func defaultConflictPolicy(skipConfirmation bool) fileSystem.ConflictPolicy {
+	if skipConfirmation {
+		return fileSystem.FailOnConflict
+	}
+	return fileSystem.PromptOnConflict
+}
+
+// ProviderName returns the configured provider, when none is set Azure is used
+// if an Azure endpoint was given and OpenAI otherwise.
+func (c *AppConfig) ProviderName() string {
+	if c.Provider != "" {
+		return c.Provider
+	}
+	if c.AzureOpenaiEndpoint != "" {
+		return AzureProvider
+	}
+	return OpenAIProvider
+}
+
+// needsAPIKey returns whether the requests are authenticated with the API key,
+// replayed answers, the providers that don't declare it and Azure AD tokens
+// don't need it.
+func (c *AppConfig) needsAPIKey() bool {
+	return c.ReplayCassette == "" && c.Capabilities().NeedsAPIKey && !c.AzureAuth.UsesTokens()
+}
+
+// ParseHeaders reads headers written as "Name: value", like curl does.
+func ParseHeaders(entries []string) (map[string]string, error) {
+	headers := map[string]string{}
+	for _, entry := range entries {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(entry, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return nil, fmt.Errorf("invalid %s %q, use the format \"Name: value\"", HeadersLabel, entry)
+		}
+		headers[name] = strings.TrimSpace(value)
+	}
+	return headers, nil
+}
+
+// headerList reads the headers, set as a list by the flag and as a string by
+// the environment variable. The variable separates the headers with new lines,
+// or with commas followed by the name of the next header. Viper would split
+// the string on spaces, which are valid in header values.
+func headerList(viperConfig viper.Viper) []string {
+	value, ok := viperConfig.Get(HeadersLabel).(string)
+	if !ok {
+		return viperConfig.GetStringSlice(HeadersLabel)
+	}
+
+	entries := []string{}
+	for _, line := range strings.Split(value, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		start := 0
+		for _, match := range headerStart.FindAllStringIndex(line, -1) {
+			entries = append(entries, line[start:match[0]])
+			start = match[0] + 1
+		}
+		entries = append(entries, line[start:])
+	}
+	return entries
+}
+
+func validateProxy(proxy string) error {
+	proxyURL, err := url.Parse(proxy)
+	if err != nil || proxyURL.Host == "" {
+		return fmt.Errorf("invalid %s %q, use a URL like http://proxy.example.com:8080", ProxyLabel, proxy)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+		return nil
+	default:
+		return fmt.Errorf("invalid %s %q, the scheme must be http, https or socks5", ProxyLabel, proxy)
+	}
+}
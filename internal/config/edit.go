@@ -0,0 +1,316 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// SetSetting saves a setting in a config file, in a profile when one is given,
+// creating the file if it doesn't exist. Only lists, like header, take several
+// values. The comments of YAML files are kept, TOML files are rewritten
+// without them.
+func SetSetting(path string, profile string, key string, values []string) error {
+	label, value, err := parseSetting(profile, key, values)
+	if err != nil {
+		return err
+	}
+	return editFile(path, func(content []byte) ([]byte, error) {
+		if isTOML(path) {
+			return setTOML(content, profile, label, value)
+		}
+		return setYAML(content, profile, label, value)
+	})
+}
+
+// UnsetSetting removes a setting from a config file, or from one of its
+// profiles when one is given.
+func UnsetSetting(path string, profile string, key string) error {
+	return editFile(path, func(content []byte) ([]byte, error) {
+		var removed bool
+		var err error
+		if isTOML(path) {
+			content, removed, err = unsetTOML(content, profile, key)
+		} else {
+			content, removed, err = unsetYAML(content, profile, key)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !removed {
+			if profile != "" {
+				return nil, fmt.Errorf("%s is not set in the profile %q of %s", key, profile, path)
+			}
+			return nil, fmt.Errorf("%s is not set in %s", key, path)
+		}
+		return content, nil
+	})
+}
+
+// editFile changes the content of a config file, the new content is only
+// written if it is a valid config file.
+func editFile(path string, edit func(content []byte) ([]byte, error)) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".toml":
+	default:
+		return fmt.Errorf("unsupported config file %s, use a .yaml, .yml or .toml file", path)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if _, err := parseFile(path, content); err != nil {
+		return err
+	}
+
+	content, err = edit(content)
+	if err != nil {
+		return err
+	}
+	if _, err := parseFile(path, content); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0o600)
+}
+
+// parseSetting validates a setting given as text in the command line,
+// returning its name as a flag and its value in the type of the file.
+func parseSetting(profile string, key string, values []string) (string, interface{}, error) {
+	if key == ProfileLabel {
+		if profile != "" {
+			return "", nil, fmt.Errorf("the default %s can't be set in a profile", ProfileLabel)
+		}
+		if len(values) != 1 {
+			return "", nil, fmt.Errorf("%s takes the name of a profile", ProfileLabel)
+		}
+		return ProfileLabel, values[0], nil
+	}
+
+	label, kind, ok := lookupSetting(key)
+	if !ok {
+		return "", nil, fmt.Errorf("unknown setting %s, the settings are the names of the flags like %s or %s", key, ProviderLabel, OpenaiDeploymentNameLabel)
+	}
+	// the secrets would be kept in plain text and in the shell history
+	switch label {
+	case OpenaiApiKeyLabel:
+		return "", nil, fmt.Errorf("%s isn't saved in the config file, save it in the keyring with application-ai login", label)
+	case AzureClientSecretLabel:
+		return "", nil, fmt.Errorf("%s isn't saved in the config file, set it with the AZURE_CLIENT_SECRET environment variable", label)
+	}
+	if kind == listSetting {
+		return label, values, nil
+	}
+	if len(values) != 1 {
+		return "", nil, fmt.Errorf("%s takes a single value", label)
+	}
+
+	text := values[0]
+	var value interface{}
+	var err error
+	switch kind {
+	case intSetting:
+		value, err = strconv.Atoi(text)
+		if err != nil {
+			err = fmt.Errorf("expected an integer but got %s", text)
+		}
+	case floatSetting:
+		value, err = strconv.ParseFloat(text, 64)
+		if err != nil {
+			err = fmt.Errorf("expected a number but got %s", text)
+		}
+	case boolSetting:
+		value, err = strconv.ParseBool(text)
+		if err != nil {
+			err = fmt.Errorf("expected true or false but got %s", text)
+		}
+	case durationSetting:
+		value = text
+		if _, parseErr := time.ParseDuration(text); parseErr != nil {
+			err = fmt.Errorf("expected a duration like 30s or 2m but got %s", text)
+		}
+	default:
+		value = text
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("%s: %w", label, err)
+	}
+	return label, value, nil
+}
+
+func isTOML(path string) bool {
+	return strings.ToLower(filepath.Ext(path)) == ".toml"
+}
+
+// yamlSettingsMap returns the map of a YAML document where the settings of a
+// profile, or the shared ones, are saved, creating it when create is true.
+func yamlSettingsMap(document *yaml.Node, profile string, create bool) *yaml.Node {
+	if len(document.Content) == 0 {
+		if !create {
+			return nil
+		}
+		document.Kind = yaml.DocumentNode
+		document.Content = []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}
+	}
+
+	settings := document.Content[0]
+	if profile == "" {
+		return settings
+	}
+	for _, key := range []string{profilesKey, profile} {
+		_, value := yamlEntry(settings, key)
+		if value == nil {
+			if !create {
+				return nil
+			}
+			value = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			settings.Content = append(settings.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+		}
+		settings = value
+	}
+	return settings
+}
+
+// yamlEntry finds a key of a map ignoring its case, as the settings are read,
+// returning the index of the key and the value.
+func yamlEntry(mapping *yaml.Node, key string) (int, *yaml.Node) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if strings.EqualFold(mapping.Content[i].Value, key) {
+			return i, mapping.Content[i+1]
+		}
+	}
+	return -1, nil
+}
+
+func setYAML(content []byte, profile string, label string, value interface{}) ([]byte, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, err
+	}
+
+	var valueNode yaml.Node
+	if err := valueNode.Encode(value); err != nil {
+		return nil, err
+	}
+	settings := yamlSettingsMap(&document, profile, true)
+	if index, _ := yamlEntry(settings, label); index >= 0 {
+		settings.Content[index].Value = label
+		settings.Content[index+1] = &valueNode
+	} else {
+		settings.Content = append(settings.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: label}, &valueNode)
+	}
+	return encodeYAML(&document)
+}
+
+func unsetYAML(content []byte, profile string, key string) ([]byte, bool, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, false, err
+	}
+
+	settings := yamlSettingsMap(&document, profile, false)
+	if settings == nil {
+		return content, false, nil
+	}
+	index, _ := yamlEntry(settings, key)
+	if index < 0 {
+		return content, false, nil
+	}
+	settings.Content = append(settings.Content[:index], settings.Content[index+2:]...)
+	content, err := encodeYAML(&document)
+	return content, true, err
+}
+
+func encodeYAML(document *yaml.Node) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(document); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// tomlSettingsTable returns the table of a TOML document where the settings
+// of a profile, or the shared ones, are saved, creating it when create is true.
+func tomlSettingsTable(document map[string]interface{}, profile string, create bool) (map[string]interface{}, error) {
+	settings := document
+	if profile == "" {
+		return settings, nil
+	}
+	for _, key := range []string{profilesKey, profile} {
+		table, ok := settings[key].(map[string]interface{})
+		if !ok {
+			if settings[key] != nil {
+				return nil, fmt.Errorf("%s: expected a table of settings", key)
+			}
+			if !create {
+				return nil, nil
+			}
+			table = map[string]interface{}{}
+			settings[key] = table
+		}
+		settings = table
+	}
+	return settings, nil
+}
+
+// removeTOMLKey removes a key of a table ignoring its case, as the settings
+// are read.
+func removeTOMLKey(table map[string]interface{}, key string) bool {
+	removed := false
+	for name := range table {
+		if strings.EqualFold(name, key) {
+			delete(table, name)
+			removed = true
+		}
+	}
+	return removed
+}
+
+func setTOML(content []byte, profile string, label string, value interface{}) ([]byte, error) {
+	document := map[string]interface{}{}
+	if err := toml.Unmarshal(content, &document); err != nil {
+		return nil, err
+	}
+
+	settings, err := tomlSettingsTable(document, profile, true)
+	if err != nil {
+		return nil, err
+	}
+	removeTOMLKey(settings, label)
+	settings[label] = value
+	return toml.Marshal(document)
+}
+
+func unsetTOML(content []byte, profile string, key string) ([]byte, bool, error) {
+	document := map[string]interface{}{}
+	if err := toml.Unmarshal(content, &document); err != nil {
+		return nil, false, err
+	}
+
+	settings, err := tomlSettingsTable(document, profile, false)
+	if err != nil || settings == nil {
+		return content, false, err
+	}
+	if !removeTOMLKey(settings, key) {
+		return content, false, nil
+	}
+	content, err = toml.Marshal(document)
+	return content, true, err
+}
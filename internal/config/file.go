@@ -0,0 +1,399 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	configFileName = "config"
+	profilesKey    = "profiles"
+)
+
+type settingKind int
+
+const (
+	stringSetting settingKind = iota
+	intSetting
+	floatSetting
+	boolSetting
+	durationSetting
+	listSetting
+)
+
+// fileSettings are the settings that can be saved in a config file, the ones
+// that only make sense for a single run, like resume or record, are left out.
+var fileSettings = map[string]settingKind{
+	OpenaiApiKeyLabel:         stringSetting,
+	OpenaiDeploymentNameLabel: stringSetting,
+	MaxTokensLabel:            intSetting,
+	AzureOpenaiEndpointLabel:  stringSetting,
+	SkipConfirmationLabel:     boolSetting,
+	TemperatureLabel:          floatSetting,
+	ChatContextLabel:          stringSetting,
+	ProviderLabel:             stringSetting,
+	BaseURLLabel:              stringSetting,
+	ModelCatalogLabel:         stringSetting,
+	OutputDirLabel:            stringSetting,
+	DryRunLabel:               boolSetting,
+	ConflictPolicyLabel:       stringSetting,
+	RepairAttemptsLabel:       intSetting,
+	StructuredOutputLabel:     boolSetting,
+	MaxRetriesLabel:           intSetting,
+	RetryDelayLabel:           durationSetting,
+	RetryMaxDelayLabel:        durationSetting,
+	ProxyLabel:                stringSetting,
+	CABundleLabel:             stringSetting,
+	HeadersLabel:              listSetting,
+	TimeoutLabel:              durationSetting,
+	AzureAuthLabel:            stringSetting,
+	AzureTenantIDLabel:        stringSetting,
+	AzureClientIDLabel:        stringSetting,
+	AzureClientSecretLabel:    stringSetting,
+	AzureAuthorityHostLabel:   stringSetting,
+	AzureTokenCacheLabel:      stringSetting,
+	KeyringLabel:              stringSetting,
+}
+
+// File is a config file with settings shared by every profile and named
+// profiles with the settings of an environment, like azure-prod or
+// openai-personal. The keys are the names of the flags.
+type File struct {
+	Path     string
+	Settings map[string]interface{}
+	// Profile is the profile used when none is selected.
+	Profile  string
+	Profiles map[string]map[string]interface{}
+}
+
+// rawSetting is a setting read from a file before it is validated, line is
+// 0 when the format doesn't report it. A setting without a key declares a
+// profile, so profiles without settings exist.
+type rawSetting struct {
+	profile string
+	key     string
+	value   interface{}
+	line    int
+}
+
+// NewFilePath returns the config file that is created in the config
+// directory when the user hasn't created one.
+func NewFilePath() (string, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, configFileName+".yaml"), nil
+}
+
+// DefaultFile returns the config file in the config directory, config.yaml,
+// config.yml or config.toml, or an empty string if the user hasn't created one.
+func DefaultFile() string {
+	dir, err := ConfigDir()
+	if err != nil {
+		return ""
+	}
+	for _, extension := range []string{".yaml", ".yml", ".toml"} {
+		path := filepath.Join(dir, configFileName+extension)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// LoadFile reads a YAML or TOML config file, chosen by its extension, and
+// validates its settings.
+func LoadFile(path string) (*File, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseFile(path, content)
+}
+
+// parseFile validates the content of a config file, the path chooses the
+// format and is used in the errors.
+func parseFile(path string, content []byte) (*File, error) {
+	var settings []rawSetting
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		settings, err = yamlSettings(content)
+	case ".toml":
+		settings, err = tomlSettings(content)
+	default:
+		return nil, fmt.Errorf("unsupported config file %s, use a .yaml, .yml or .toml file", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+
+	file := &File{Path: path, Settings: map[string]interface{}{}, Profiles: map[string]map[string]interface{}{}}
+	for _, setting := range settings {
+		if err := file.add(setting); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := file.Profiles[file.Profile]; file.Profile != "" && !ok {
+		return nil, fmt.Errorf("%s: %s: the profile %q doesn't exist", path, ProfileLabel, file.Profile)
+	}
+	return file, nil
+}
+
+// add validates a setting and adds it to the file.
+func (f *File) add(setting rawSetting) error {
+	location := f.Path
+	if setting.line > 0 {
+		location = fmt.Sprintf("%s:%d", f.Path, setting.line)
+	}
+	key := setting.key
+	if setting.profile != "" {
+		key = fmt.Sprintf("%s.%s.%s", profilesKey, setting.profile, setting.key)
+	}
+
+	if setting.key == "" {
+		if f.Profiles[setting.profile] == nil {
+			f.Profiles[setting.profile] = map[string]interface{}{}
+		}
+		return nil
+	}
+	if setting.profile == "" && setting.key == ProfileLabel {
+		profile, ok := setting.value.(string)
+		if !ok {
+			return fmt.Errorf("%s: %s: expected the name of a profile", location, key)
+		}
+		f.Profile = profile
+		return nil
+	}
+
+	label, kind, ok := lookupSetting(setting.key)
+	if !ok {
+		return fmt.Errorf("%s: %s: unknown setting, the settings are the names of the flags like %s or %s", location, key, ProviderLabel, OpenaiDeploymentNameLabel)
+	}
+	value, err := checkKind(setting.value, kind)
+	if err != nil {
+		return fmt.Errorf("%s: %s: %w", location, key, err)
+	}
+
+	if setting.profile == "" {
+		f.Settings[label] = value
+		return nil
+	}
+	if f.Profiles[setting.profile] == nil {
+		f.Profiles[setting.profile] = map[string]interface{}{}
+	}
+	f.Profiles[setting.profile][label] = value
+	return nil
+}
+
+// ProfileNames returns the names of the profiles in alphabetical order.
+func (f *File) ProfileNames() []string {
+	names := make([]string, 0, len(f.Profiles))
+	for name := range f.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Resolve returns the shared settings overridden by the ones of the given
+// profile, or of the default profile when none is given.
+func (f *File) Resolve(profile string) (map[string]interface{}, error) {
+	if profile == "" {
+		profile = f.Profile
+	}
+
+	settings := map[string]interface{}{}
+	for label, value := range f.Settings {
+		settings[label] = value
+	}
+	if profile == "" {
+		return settings, nil
+	}
+
+	profileSettings, ok := f.Profiles[profile]
+	if !ok {
+		if len(f.Profiles) == 0 {
+			return nil, fmt.Errorf("the profile %q doesn't exist, %s has no profiles", profile, f.Path)
+		}
+		return nil, fmt.Errorf("the profile %q doesn't exist in %s, please choose one of these options: %s", profile, f.Path, strings.Join(f.ProfileNames(), ", "))
+	}
+	for label, value := range profileSettings {
+		settings[label] = value
+	}
+	return settings, nil
+}
+
+// lookupSetting finds a setting ignoring the case of its name, as the
+// environment variables and flags are matched.
+func lookupSetting(key string) (string, settingKind, bool) {
+	for label, kind := range fileSettings {
+		if strings.EqualFold(label, key) {
+			return label, kind, true
+		}
+	}
+	return "", 0, false
+}
+
+// checkKind validates the type of a value, returning it in the type the
+// configuration reads it with.
+func checkKind(value interface{}, kind settingKind) (interface{}, error) {
+	switch kind {
+	case stringSetting:
+		if text, ok := value.(string); ok {
+			return text, nil
+		}
+		return nil, fmt.Errorf("expected a string but got %v", value)
+	case intSetting:
+		switch number := value.(type) {
+		case int:
+			return number, nil
+		case int64:
+			return int(number), nil
+		}
+		return nil, fmt.Errorf("expected an integer but got %v", value)
+	case floatSetting:
+		switch number := value.(type) {
+		case int:
+			return float64(number), nil
+		case int64:
+			return float64(number), nil
+		case float64:
+			return number, nil
+		}
+		return nil, fmt.Errorf("expected a number but got %v", value)
+	case boolSetting:
+		if flag, ok := value.(bool); ok {
+			return flag, nil
+		}
+		return nil, fmt.Errorf("expected true or false but got %v", value)
+	case durationSetting:
+		if text, ok := value.(string); ok {
+			if _, err := time.ParseDuration(text); err == nil {
+				return text, nil
+			}
+		}
+		return nil, fmt.Errorf("expected a duration like 30s or 2m but got %v", value)
+	case listSetting:
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected a list but got %v", value)
+		}
+		list := make([]string, 0, len(items))
+		for _, item := range items {
+			text, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("expected a list of strings but got %v", item)
+			}
+			list = append(list, text)
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("unsupported setting")
+}
+
+// yamlSettings reads the settings of a YAML file with their line numbers.
+func yamlSettings(content []byte) ([]rawSetting, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		return nil, err
+	}
+	if len(document.Content) == 0 {
+		return nil, nil
+	}
+
+	root := document.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: expected a map of settings", root.Line)
+	}
+
+	settings := []rawSetting{}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		if key.Value != profilesKey {
+			setting, err := yamlSetting("", key, value)
+			if err != nil {
+				return nil, err
+			}
+			settings = append(settings, setting)
+			continue
+		}
+
+		if value.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("line %d: %s: expected a map of profiles", value.Line, profilesKey)
+		}
+		for j := 0; j+1 < len(value.Content); j += 2 {
+			name, profile := value.Content[j], value.Content[j+1]
+			if profile.Kind != yaml.MappingNode {
+				return nil, fmt.Errorf("line %d: %s.%s: expected a map of settings", profile.Line, profilesKey, name.Value)
+			}
+			settings = append(settings, rawSetting{profile: name.Value, line: name.Line})
+			for k := 0; k+1 < len(profile.Content); k += 2 {
+				setting, err := yamlSetting(name.Value, profile.Content[k], profile.Content[k+1])
+				if err != nil {
+					return nil, err
+				}
+				settings = append(settings, setting)
+			}
+		}
+	}
+	return settings, nil
+}
+
+func yamlSetting(profile string, key *yaml.Node, value *yaml.Node) (rawSetting, error) {
+	var decoded interface{}
+	if err := value.Decode(&decoded); err != nil {
+		return rawSetting{}, fmt.Errorf("line %d: %s: %w", value.Line, key.Value, err)
+	}
+	return rawSetting{profile: profile, key: key.Value, value: decoded, line: key.Line}, nil
+}
+
+// tomlSettings reads the settings of a TOML file, sorted by name because
+// TOML tables aren't ordered.
+func tomlSettings(content []byte) ([]rawSetting, error) {
+	document := map[string]interface{}{}
+	if err := toml.Unmarshal(content, &document); err != nil {
+		return nil, err
+	}
+
+	settings := []rawSetting{}
+	for _, key := range sortedKeys(document) {
+		if key != profilesKey {
+			settings = append(settings, rawSetting{key: key, value: document[key]})
+			continue
+		}
+
+		profiles, ok := document[key].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: expected a table of profiles", profilesKey)
+		}
+		for _, name := range sortedKeys(profiles) {
+			profile, ok := profiles[name].(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s.%s: expected a table of settings", profilesKey, name)
+			}
+			settings = append(settings, rawSetting{profile: name})
+			for _, setting := range sortedKeys(profile) {
+				settings = append(settings, rawSetting{profile: name, key: setting, value: profile[setting]})
+			}
+		}
+	}
+	return settings, nil
+}
+
+func sortedKeys(values map[string]interface{}) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/afrancoc2000/application-helper-ai/internal/keyring"
+)
+
+const (
+	appDirName       = "application-ai"
+	modelCatalogFile = "models.yaml"
+	keyringFile      = "keyring.json"
+)
+
+// ConfigDir returns the directory where the user settings of the application
+// are stored, like $XDG_CONFIG_HOME/application-ai on Linux.
+func ConfigDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, appDirName), nil
+}
+
+// defaultModelCatalog returns the user catalog in the config directory, or an
+// empty string if the user hasn't created one.
+func defaultModelCatalog() string {
+	dir, err := ConfigDir()
+	if err != nil {
+		return ""
+	}
+
+	path := filepath.Join(dir, modelCatalogFile)
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// OpenKeyring returns the store of the API keys, the encrypted file used when
+// there's no system keyring is kept in the config directory.
+func OpenKeyring(backend keyring.Backend) (keyring.Store, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	return keyring.Open(backend, filepath.Join(dir, keyringFile), keyring.DefaultPassphrase)
+}
+
+// StoredAPIKey returns the API key saved with the login command for a profile,
+// or an empty string if there's none.
+func StoredAPIKey(backend keyring.Backend, profile string) (string, error) {
+	store, err := OpenKeyring(backend)
+	if err != nil {
+		return "", err
+	}
+	key, err := store.Get(profile)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("couldn't read the API key from %s: %w", store, err)
+	}
+	return key, nil
+}
@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/afrancoc2000/application-helper-ai/internal/models"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+type ChangeStatus int
+
+const (
+	NewFile ChangeStatus = iota
+	ModifiedFile
+	UnchangedFile
+)
+
+func (s ChangeStatus) String() string {
+	return [...]string{"new", "modified", "unchanged"}[s]
+}
+
+// FileChange compares a generated file with the file already on disk.
+type FileChange struct {
+	File     models.AppFile
+	Target   string
+	Status   ChangeStatus
+	Previous string
+}
+
+// UnifiedDiff returns the changes to the file on disk in unified diff format,
+// new files are compared against an empty file.
+func (c FileChange) UnifiedDiff() (string, error) {
+	name := filepath.ToSlash(filepath.Join(normalizePath(c.File.Path), normalizePath(c.File.Name)))
+	fromFile := "a/" + name
+	if c.Status == NewFile {
+		fromFile = "/dev/null"
+	}
+
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(c.Previous),
+		B:        splitLines(c.File.Content),
+		FromFile: fromFile,
+		ToFile:   "b/" + name,
+		Context:  3,
+	})
+}
+
+func (f *fileFactory) CompareFiles(files []models.AppFile) ([]FileChange, error) {
+	targets, err := f.resolveFiles(files)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []FileChange{}
+	for index, file := range files {
+		change := FileChange{File: file, Target: targets[index], Status: NewFile}
+
+		previous, err := os.ReadFile(change.Target)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if err == nil {
+			change.Previous = string(previous)
+			change.Status = ModifiedFile
+			if change.Previous == file.Content {
+				change.Status = UnchangedFile
+			}
+		}
+
+		changes = append(changes, change)
+	}
+
+	return changes, nil
+}
+
+// splitLines splits text keeping the line endings, a missing final line ending
+// is added so the last line diffs like the others.
+func splitLines(text string) []string {
+	if text == "" {
+		return []string{}
+	}
+
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1]
+	}
+	lines[len(lines)-1] += "\n"
+	return lines
+}
@@ -0,0 +1,127 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+type ConflictPolicy string
+
+const (
+	FailOnConflict      ConflictPolicy = "fail"
+	SkipOnConflict      ConflictPolicy = "skip"
+	OverwriteOnConflict ConflictPolicy = "overwrite"
+	BackupOnConflict    ConflictPolicy = "backup"
+	PromptOnConflict    ConflictPolicy = "prompt-per-file"
+)
+
+// ConflictPolicies returns the valid conflict policies.
+func ConflictPolicies() []ConflictPolicy {
+	return []ConflictPolicy{FailOnConflict, SkipOnConflict, OverwriteOnConflict, BackupOnConflict, PromptOnConflict}
+}
+
+func ParseConflictPolicy(name string) (ConflictPolicy, error) {
+	names := []string{}
+	for _, policy := range ConflictPolicies() {
+		if string(policy) == name {
+			return policy, nil
+		}
+		names = append(names, string(policy))
+	}
+
+	return "", fmt.Errorf("The specified conflict policy %q does not exist, please choose one of these options: %s", name, strings.Join(names, ", "))
+}
+
+// ConflictPrompt asks the user what to do with a file that already exists, it
+// must return any policy except PromptOnConflict.
+type ConflictPrompt func(change FileChange) (ConflictPolicy, error)
+
+type FileAction int
+
+const (
+	CreatedFile FileAction = iota
+	OverwrittenFile
+	SkippedFile
+	BackedUpFile
+	KeptFile
+)
+
+func (a FileAction) String() string {
+	return [...]string{"created", "overwritten", "skipped", "backed up", "unchanged"}[a]
+}
+
+// FileResult is what CreateFiles did with a generated file.
+type FileResult struct {
+	Change FileChange
+	Action FileAction
+	Backup string
+}
+
+// ConflictError lists the files that already exist when the policy is to fail.
+type ConflictError struct {
+	Files []FileChange
+}
+
+func (e *ConflictError) Error() string {
+	var message strings.Builder
+	message.WriteString("these files already exist, no file was written:")
+	for _, change := range e.Files {
+		fmt.Fprintf(&message, "\n  - %s%s", change.File.Path, change.File.Name)
+	}
+	return message.String()
+}
+
+// resolveConflict decides what to do with a generated file, asking the user
+// when the policy requires it.
+func (f *fileFactory) resolveConflict(change FileChange) (FileAction, error) {
+	switch change.Status {
+	case NewFile:
+		return CreatedFile, nil
+	case UnchangedFile:
+		return KeptFile, nil
+	}
+
+	policy := f.policy
+	if policy == PromptOnConflict {
+		if f.prompt == nil {
+			return 0, fmt.Errorf("the %s conflict policy needs an interactive prompt", PromptOnConflict)
+		}
+
+		var err error
+		policy, err = f.prompt(change)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	switch policy {
+	case SkipOnConflict:
+		return SkippedFile, nil
+	case OverwriteOnConflict:
+		return OverwrittenFile, nil
+	case BackupOnConflict:
+		return BackedUpFile, nil
+	case FailOnConflict:
+		return 0, &ConflictError{Files: []FileChange{change}}
+	}
+	return 0, fmt.Errorf("unsupported conflict policy %q", policy)
+}
+
+// backupPath returns where an existing file is moved to make room for the
+// generated one, the file name with a .bak suffix and a number when it's taken.
+func backupPath(target string) (string, error) {
+	backup := target + ".bak"
+	for index := 1; ; index++ {
+		_, err := os.Lstat(backup)
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		backup = fmt.Sprintf("%s.bak.%d", target, index)
+	}
+
+	return backup, nil
+}
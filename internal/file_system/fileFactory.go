@@ -1,53 +1,232 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/afrancoc2000/application-helper-ai/internal/models"
 )
 
 type FileFactory interface {
-	CreateFiles(files []models.AppFile) error
+	// CreateFiles writes the files applying the conflict policy to the ones
+	// that already exist, and reports what was done with each of them.
+	CreateFiles(files []models.AppFile) ([]FileResult, error)
+	// CompareFiles reports how each file differs from the one on disk without writing anything.
+	CompareFiles(files []models.AppFile) ([]FileChange, error)
 }
 
 type fileFactory struct {
+	root   string
+	policy ConflictPolicy
+	prompt ConflictPrompt
 }
 
-func NewFileFactory() FileFactory {
-	return &fileFactory{}
+// NewFileFactory returns a FileFactory that only writes files inside root,
+// prompt is only used with the PromptOnConflict policy.
+func NewFileFactory(root string, policy ConflictPolicy, prompt ConflictPrompt) FileFactory {
+	return &fileFactory{root: root, policy: policy, prompt: prompt}
 }
 
-func (f *fileFactory) CreateFiles(files []models.AppFile) error {
+// UnsafeFile is a generated file that would be written outside of the output
+// directory, or over another generated file.
+type UnsafeFile struct {
+	File   models.AppFile
+	Reason string
+}
 
-	for _, file := range files {
-		err := f.saveFile(file)
+// UnsafePathError lists every generated file rejected by the output directory sandbox.
+type UnsafePathError struct {
+	Root  string
+	Files []UnsafeFile
+}
+
+func (e *UnsafePathError) Error() string {
+	var message strings.Builder
+	fmt.Fprintf(&message, "refusing to write files outside of the output directory %s:", e.Root)
+	for _, file := range e.Files {
+		fmt.Fprintf(&message, "\n  - %s%s: %s", file.File.Path, file.File.Name, file.Reason)
+	}
+	return message.String()
+}
+
+func (f *fileFactory) CreateFiles(files []models.AppFile) ([]FileResult, error) {
+	changes, err := f.CompareFiles(files)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []FileResult{}
+	conflicts := []FileChange{}
+	for _, change := range changes {
+		action, err := f.resolveConflict(change)
+		var conflictErr *ConflictError
+		if errors.As(err, &conflictErr) {
+			conflicts = append(conflicts, conflictErr.Files...)
+			continue
+		}
 		if err != nil {
-			return err
+			return nil, err
 		}
+		results = append(results, FileResult{Change: change, Action: action})
+	}
+	if len(conflicts) > 0 {
+		return nil, &ConflictError{Files: conflicts}
+	}
+
+	root, err := filepath.Abs(f.root)
+	if err != nil {
+		return nil, err
+	}
+	// the output directory isn't rolled back, it keeps the journal
+	err = os.MkdirAll(root, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	transaction := newApplyTransaction(root)
+	err = transaction.apply(results)
+	if err != nil {
+		return nil, err
+	}
+
+	journal := newJournalEntry()
+	journal.addDirectories(root, transaction.directories)
+	for _, result := range results {
+		journal.addFile(root, result)
+	}
+	err = journal.save(root)
+	if err != nil {
+		return results, fmt.Errorf("the files were written but the apply couldn't be recorded for undo: %w", err)
 	}
 
-	return nil
+	return results, nil
 }
 
-func (f *fileFactory) saveFile(factoryFile models.AppFile) error {
-	err := os.MkdirAll(factoryFile.Path, os.ModePerm)
+// resolveFiles returns the location of every file inside the output directory,
+// failing without writing anything if any of them is unsafe or if two of them
+// are written to the same file.
+func (f *fileFactory) resolveFiles(files []models.AppFile) ([]string, error) {
+	root, err := filepath.Abs(f.root)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	realRoot, err := realPath(root)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := []string{}
+	unsafeFiles := []UnsafeFile{}
+	// written maps the real location of every file to the first one written there
+	written := map[string]models.AppFile{}
+	for _, file := range files {
+		target, reason := resolveFile(root, realRoot, file)
+		if reason != "" {
+			unsafeFiles = append(unsafeFiles, UnsafeFile{File: file, Reason: reason})
+			continue
+		}
+
+		realTarget, err := realPath(target)
+		if err != nil {
+			realTarget = target
+		}
+		if first, ok := written[realTarget]; ok {
+			unsafeFiles = append(unsafeFiles, UnsafeFile{File: file, Reason: fmt.Sprintf("%s%s is written to the same file", first.Path, first.Name)})
+			continue
+		}
+		written[realTarget] = file
+		targets = append(targets, target)
+	}
+
+	if len(unsafeFiles) > 0 {
+		return nil, &UnsafePathError{Root: root, Files: unsafeFiles}
 	}
+	return targets, nil
+}
 
-	file, err := os.Create(fmt.Sprintf("%s%s", factoryFile.Path, factoryFile.Name))
+// resolveFile normalizes the path and name of a file and checks it stays
+// inside root, returning the reason when it doesn't.
+func resolveFile(root string, realRoot string, file models.AppFile) (string, string) {
+	path := normalizePath(file.Path)
+	name := normalizePath(file.Name)
+
+	if name == "" {
+		return "", "the file name is empty"
+	}
+	if filepath.IsAbs(path) || filepath.IsAbs(name) || filepath.VolumeName(path) != "" || filepath.VolumeName(name) != "" {
+		return "", "absolute paths are not allowed"
+	}
+
+	relative := filepath.Join(path, name)
+	if relative == "." || strings.HasSuffix(name, string(filepath.Separator)) {
+		return "", "the file name is not a file"
+	}
+	if escapes(relative) {
+		return "", "the path escapes the output directory"
+	}
+	if isStatePath(relative) {
+		return "", fmt.Sprintf("the %s directory is reserved for the application", StateDir)
+	}
+
+	target := filepath.Join(root, relative)
+	realTarget, err := realPath(target)
 	if err != nil {
-		fmt.Println(err)
-		return err
+		return "", fmt.Sprintf("the path can't be resolved: %s", err)
+	}
+	if realTarget == realRoot {
+		return "", "a symbolic link points to the output directory itself"
 	}
-	defer file.Close()
+	if escapes(relativePath(realRoot, realTarget)) {
+		return "", "a symbolic link points outside of the output directory"
+	}
+
+	return target, ""
+}
+
+// normalizePath converts the separators used by the model to the ones of the
+// current OS, models often answer with Windows paths.
+func normalizePath(path string) string {
+	return filepath.FromSlash(strings.ReplaceAll(strings.TrimSpace(path), `\`, "/"))
+}
+
+func escapes(relative string) bool {
+	return relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator))
+}
 
-	_, err = file.WriteString(factoryFile.Content)
+func relativePath(base string, target string) string {
+	relative, err := filepath.Rel(base, target)
 	if err != nil {
-		fmt.Println(err)
-		return err
+		return ".."
 	}
+	return relative
+}
 
-	return nil
+// realPath resolves the symbolic links of the longest existing part of path,
+// the rest of it is appended as is because it will be created by us.
+func realPath(path string) (string, error) {
+	existing := path
+	missing := []string{}
+	for {
+		_, err := os.Lstat(existing)
+		if err == nil {
+			break
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			break
+		}
+		missing = append([]string{filepath.Base(existing)}, missing...)
+		existing = parent
+	}
+
+	resolved, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(append([]string{resolved}, missing...)...), nil
 }
@@ -0,0 +1,253 @@
+package cli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// StateDir is the directory inside the output directory where the
+	// application keeps its state, generated files can't be written in it.
+	StateDir   = ".application-ai"
+	journalDir = "journal"
+)
+
+// ErrNothingToUndo is returned by Undo when no apply has been recorded.
+var ErrNothingToUndo = errors.New("there is nothing to undo")
+
+// JournalEntry records everything an apply changed so it can be undone.
+type JournalEntry struct {
+	ID          string        `json:"id"`
+	CreatedAt   time.Time     `json:"createdAt"`
+	Files       []JournalFile `json:"files"`
+	Directories []string      `json:"directories"`
+}
+
+// JournalFile is a file written by an apply, paths are relative to the output directory.
+type JournalFile struct {
+	Path     string     `json:"path"`
+	Action   FileAction `json:"action"`
+	Checksum string     `json:"checksum"`
+	Previous []byte     `json:"previous,omitempty"`
+	// Mode is the permissions of the overwritten file
+	Mode   os.FileMode `json:"mode,omitempty"`
+	Backup string      `json:"backup,omitempty"`
+	// Restored is set once an undo put the file back, so an undo that failed
+	// halfway can be run again to finish it
+	Restored bool `json:"restored,omitempty"`
+}
+
+// ModifiedFilesError lists the files changed after an apply, which prevent undoing it.
+type ModifiedFilesError struct {
+	Files []string
+}
+
+func (e *ModifiedFilesError) Error() string {
+	return fmt.Sprintf("refusing to undo, these files were modified after they were applied:\n  - %s", strings.Join(e.Files, "\n  - "))
+}
+
+func newJournalEntry() *JournalEntry {
+	now := time.Now().UTC()
+	return &JournalEntry{
+		ID:          now.Format("20060102T150405.000000000Z"),
+		CreatedAt:   now,
+		Files:       []JournalFile{},
+		Directories: []string{},
+	}
+}
+
+func (e *JournalEntry) addDirectories(root string, directories []string) {
+	for _, dir := range directories {
+		e.Directories = append(e.Directories, relativePath(root, dir))
+	}
+}
+
+func (e *JournalEntry) addFile(root string, result FileResult) {
+	file := JournalFile{
+		Path:     relativePath(root, result.Change.Target),
+		Action:   result.Action,
+		Checksum: checksum([]byte(result.Change.File.Content)),
+	}
+
+	switch result.Action {
+	case OverwrittenFile:
+		file.Previous = []byte(result.Change.Previous)
+		// the apply keeps the permissions of the files it overwrites
+		if info, err := os.Stat(result.Change.Target); err == nil {
+			file.Mode = info.Mode().Perm()
+		}
+	case BackedUpFile:
+		file.Backup = relativePath(root, result.Backup)
+	case SkippedFile, KeptFile:
+		return
+	}
+
+	e.Files = append(e.Files, file)
+}
+
+func (e *JournalEntry) save(root string) error {
+	if len(e.Files) == 0 {
+		return nil
+	}
+
+	dir := filepath.Join(root, StateDir, journalDir)
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return err
+	}
+
+	return e.write(filepath.Join(dir, e.ID+".json"))
+}
+
+func (e *JournalEntry) write(path string) error {
+	content, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0o600)
+}
+
+// LastJournalEntry returns the most recent apply recorded in the output directory root.
+func LastJournalEntry(root string) (*JournalEntry, string, error) {
+	dir := filepath.Join(root, StateDir, journalDir)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, "", ErrNothingToUndo
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			names = append(names, entry.Name())
+		}
+	}
+	if len(names) == 0 {
+		return nil, "", ErrNothingToUndo
+	}
+	sort.Strings(names)
+
+	path := filepath.Join(dir, names[len(names)-1])
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	entry := &JournalEntry{}
+	err = json.Unmarshal(content, entry)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid journal entry %s: %w", path, err)
+	}
+	return entry, path, nil
+}
+
+// Undo restores the output directory root to its state before the last apply,
+// refusing to do it if any of the applied files changed since then. When a
+// file can't be restored the ones already restored are recorded in the
+// journal, so undoing again finishes the job.
+func Undo(root string) (*JournalEntry, error) {
+	entry, path, err := LastJournalEntry(root)
+	if err != nil {
+		return nil, err
+	}
+
+	modified := []string{}
+	for _, file := range entry.Files {
+		if file.Restored {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(root, file.Path))
+		if err != nil || checksum(content) != file.Checksum {
+			modified = append(modified, file.Path)
+			continue
+		}
+		if file.Backup != "" {
+			if _, err := os.Lstat(filepath.Join(root, file.Backup)); err != nil {
+				modified = append(modified, file.Backup)
+			}
+		}
+	}
+	if len(modified) > 0 {
+		return nil, &ModifiedFilesError{Files: modified}
+	}
+
+	for index := len(entry.Files) - 1; index >= 0; index-- {
+		file := &entry.Files[index]
+		if file.Restored {
+			continue
+		}
+		err := undoFile(root, *file)
+		if err != nil {
+			return nil, entry.interrupted(path, fmt.Errorf("couldn't restore %s: %w", file.Path, err))
+		}
+		file.Restored = true
+	}
+
+	for index := len(entry.Directories) - 1; index >= 0; index-- {
+		err := removeIfEmpty(filepath.Join(root, entry.Directories[index]))
+		if err != nil {
+			return nil, entry.interrupted(path, err)
+		}
+	}
+
+	return entry, os.Remove(path)
+}
+
+// interrupted records the files already restored by an undo that failed and
+// returns the error that stopped it.
+func (e *JournalEntry) interrupted(path string, cause error) error {
+	err := e.write(path)
+	if err != nil {
+		return fmt.Errorf("%w, and the files already restored couldn't be recorded: %s", cause, err)
+	}
+	return fmt.Errorf("%w, undo again to restore the rest", cause)
+}
+
+func undoFile(root string, file JournalFile) error {
+	target := filepath.Join(root, file.Path)
+	switch file.Action {
+	case OverwrittenFile:
+		err := os.WriteFile(target, file.Previous, defaultFileMode)
+		// entries recorded before the mode was kept leave it as it is
+		if err != nil || file.Mode == 0 {
+			return err
+		}
+		return os.Chmod(target, file.Mode)
+	case BackedUpFile:
+		return rename(filepath.Join(root, file.Backup), target)
+	default:
+		return os.Remove(target)
+	}
+}
+
+func removeIfEmpty(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil || len(entries) > 0 {
+		return err
+	}
+	return os.Remove(dir)
+}
+
+func checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// isStatePath returns whether a path relative to the output directory is inside the state directory.
+func isStatePath(relative string) bool {
+	first := strings.SplitN(relative, string(filepath.Separator), 2)[0]
+	return strings.EqualFold(first, StateDir)
+}
@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/afrancoc2000/application-helper-ai/internal/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUndo(t *testing.T) {
+	Convey("Undo", t, func() {
+
+		root := t.TempDir()
+		err := os.WriteFile(filepath.Join(root, "main.tf"), []byte("hand written"), 0o644)
+		So(err, ShouldBeNil)
+		err = os.WriteFile(filepath.Join(root, "README.md"), []byte("# old"), 0o644)
+		So(err, ShouldBeNil)
+
+		factory := NewFileFactory(root, BackupOnConflict, nil)
+		_, err = factory.CreateFiles([]models.AppFile{
+			{Name: "main.tf", Path: "./", Content: "generated"},
+			{Name: "README.md", Path: "./", Content: "# new"},
+		})
+		So(err, ShouldBeNil)
+
+		read := func(name string) string {
+			content, err := os.ReadFile(filepath.Join(root, name))
+			So(err, ShouldBeNil)
+			return string(content)
+		}
+
+		Convey("Finishes an undo that failed halfway", func() {
+			// the files are restored in reverse order, main.tf fails
+			count := 0
+			rename = func(from string, to string) error {
+				count++
+				if count == 2 {
+					return errors.New("disk full")
+				}
+				return os.Rename(from, to)
+			}
+			Reset(func() { rename = os.Rename })
+
+			_, err := Undo(root)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldStartWith, "couldn't restore main.tf: disk full")
+			So(read("README.md"), ShouldEqual, "# old")
+			So(read("main.tf"), ShouldEqual, "generated")
+
+			entry, _, err := LastJournalEntry(root)
+			So(err, ShouldBeNil)
+			So(entry.Files[0].Restored, ShouldBeFalse)
+			So(entry.Files[1].Restored, ShouldBeTrue)
+
+			// README.md isn't taken as modified the second time
+			entry, err = Undo(root)
+			So(err, ShouldBeNil)
+			So(entry.Files, ShouldHaveLength, 2)
+			So(read("main.tf"), ShouldEqual, "hand written")
+
+			_, err = Undo(root)
+			So(errors.Is(err, ErrNothingToUndo), ShouldBeTrue)
+			leftovers, err := filepath.Glob(filepath.Join(root, "*.bak*"))
+			So(err, ShouldBeNil)
+			So(leftovers, ShouldBeEmpty)
+		})
+	})
+}
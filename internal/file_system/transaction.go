@@ -0,0 +1,183 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const defaultFileMode os.FileMode = 0o644
+
+// rename is replaced in tests to simulate failures while files are moved into
+// place or restored by an undo.
+var rename = os.Rename
+
+// applyTransaction writes a set of files all or nothing, every file is staged
+// in a temporary file next to its target and only moved into place once all
+// of them were written. If anything fails the files already moved and the
+// directories created are rolled back.
+type applyTransaction struct {
+	root        string
+	directories []string
+	staged      []stagedFile
+	committed   int
+}
+
+type stagedFile struct {
+	result *FileResult
+	temp   string
+}
+
+func newApplyTransaction(root string) *applyTransaction {
+	return &applyTransaction{root: root}
+}
+
+// apply writes the files of the results that need to be written, filling the
+// backup locations, and leaves the disk untouched when it fails.
+func (t *applyTransaction) apply(results []FileResult) error {
+	for index := range results {
+		switch results[index].Action {
+		case SkippedFile, KeptFile:
+			continue
+		}
+
+		err := t.stage(&results[index])
+		if err != nil {
+			return t.rollback(err)
+		}
+	}
+
+	for index := range t.staged {
+		err := t.commit(&t.staged[index])
+		if err != nil {
+			return t.rollback(err)
+		}
+		t.committed++
+	}
+
+	return nil
+}
+
+func (t *applyTransaction) stage(result *FileResult) error {
+	target := result.Change.Target
+	for _, dir := range missingDirectories(t.root, target) {
+		err := os.Mkdir(dir, os.ModePerm)
+		if err != nil && !os.IsExist(err) {
+			return err
+		}
+		if err == nil {
+			t.directories = append(t.directories, dir)
+		}
+	}
+
+	mode := defaultFileMode
+	info, err := os.Stat(target)
+	if err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	t.staged = append(t.staged, stagedFile{result: result, temp: temp.Name()})
+
+	_, err = temp.WriteString(result.Change.File.Content)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Chmod(temp.Name(), mode)
+}
+
+func (t *applyTransaction) commit(staged *stagedFile) error {
+	result := staged.result
+	if result.Action == BackedUpFile {
+		backup, err := backupPath(result.Change.Target)
+		if err != nil {
+			return err
+		}
+		err = rename(result.Change.Target, backup)
+		if err != nil {
+			return err
+		}
+		result.Backup = backup
+	}
+
+	err := rename(staged.temp, result.Change.Target)
+	if err != nil {
+		// put the backup back now, rollback only handles committed files
+		if result.Backup != "" {
+			if restoreErr := rename(result.Backup, result.Change.Target); restoreErr == nil {
+				result.Backup = ""
+			}
+		}
+		return err
+	}
+	staged.temp = ""
+	return nil
+}
+
+// rollback undoes everything the transaction did and returns the error that
+// caused it, along with any file that couldn't be restored.
+func (t *applyTransaction) rollback(cause error) error {
+	failures := []string{}
+
+	for index := t.committed - 1; index >= 0; index-- {
+		err := undoCommit(t.staged[index])
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", t.staged[index].result.Change.Target, err))
+		}
+	}
+
+	for _, staged := range t.staged {
+		if staged.temp == "" {
+			continue
+		}
+		err := os.Remove(staged.temp)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			failures = append(failures, fmt.Sprintf("%s: %s", staged.temp, err))
+		}
+	}
+
+	for index := len(t.directories) - 1; index >= 0; index-- {
+		err := removeIfEmpty(t.directories[index])
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %s", t.directories[index], err))
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("%w, and these changes couldn't be rolled back:\n  - %s", cause, strings.Join(failures, "\n  - "))
+	}
+	return fmt.Errorf("%w, no file was written", cause)
+}
+
+func undoCommit(staged stagedFile) error {
+	result := staged.result
+	switch result.Action {
+	case BackedUpFile:
+		return rename(result.Backup, result.Change.Target)
+	case OverwrittenFile:
+		return os.WriteFile(result.Change.Target, []byte(result.Change.Previous), 0)
+	default:
+		return os.Remove(result.Change.Target)
+	}
+}
+
+// missingDirectories returns the directories between root and target that
+// don't exist yet, from the outermost to the innermost.
+func missingDirectories(root string, target string) []string {
+	missing := []string{}
+	for dir := filepath.Dir(target); dir != root && dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		if _, err := os.Lstat(dir); err == nil {
+			break
+		}
+		missing = append([]string{dir}, missing...)
+	}
+	return missing
+}
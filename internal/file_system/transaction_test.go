@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/afrancoc2000/application-helper-ai/internal/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestApplyTransaction(t *testing.T) {
+	Convey("applyTransaction", t, func() {
+
+		root := t.TempDir()
+		err := os.WriteFile(filepath.Join(root, "main.tf"), []byte("hand written"), 0o600)
+		So(err, ShouldBeNil)
+		err = os.WriteFile(filepath.Join(root, "README.md"), []byte("# old"), 0o644)
+		So(err, ShouldBeNil)
+
+		files := []models.AppFile{
+			{Name: "main.tf", Path: "./", Content: "generated"},
+			{Name: "README.md", Path: "./", Content: "# new"},
+			{Name: "app.py", Path: "src/app/", Content: "print('hi')"},
+		}
+
+		// failRename makes only the given call to rename fail, restoring it when the test ends
+		failRename := func(call int) {
+			count := 0
+			rename = func(from string, to string) error {
+				count++
+				if count == call {
+					return errors.New("disk full")
+				}
+				return os.Rename(from, to)
+			}
+			Reset(func() { rename = os.Rename })
+		}
+
+		listFiles := func() []string {
+			found := []string{}
+			err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+				if err == nil && path != root {
+					found = append(found, relativePath(root, path))
+				}
+				return err
+			})
+			So(err, ShouldBeNil)
+			return found
+		}
+
+		read := func(name string) string {
+			content, err := os.ReadFile(filepath.Join(root, name))
+			So(err, ShouldBeNil)
+			return string(content)
+		}
+
+		Convey("Writes every file and keeps the mode of the existing ones", func() {
+			factory := NewFileFactory(root, OverwriteOnConflict, nil)
+			_, err := factory.CreateFiles(files)
+			So(err, ShouldBeNil)
+
+			So(read("main.tf"), ShouldEqual, "generated")
+			So(read(filepath.Join("src", "app", "app.py")), ShouldEqual, "print('hi')")
+			info, err := os.Stat(filepath.Join(root, "main.tf"))
+			So(err, ShouldBeNil)
+			So(info.Mode().Perm(), ShouldEqual, os.FileMode(0o600))
+		})
+
+		Convey("Rolls back the files already moved into place", func() {
+			before := listFiles()
+			failRename(3)
+
+			factory := NewFileFactory(root, OverwriteOnConflict, nil)
+			_, err := factory.CreateFiles(files)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "no file was written")
+
+			So(read("main.tf"), ShouldEqual, "hand written")
+			So(read("README.md"), ShouldEqual, "# old")
+			So(listFiles(), ShouldResemble, before)
+		})
+
+		Convey("Restores the backups", func() {
+			before := listFiles()
+			failRename(4)
+
+			factory := NewFileFactory(root, BackupOnConflict, nil)
+			_, err := factory.CreateFiles(files)
+			So(err, ShouldNotBeNil)
+
+			So(read("main.tf"), ShouldEqual, "hand written")
+			So(read("README.md"), ShouldEqual, "# old")
+			So(listFiles(), ShouldResemble, before)
+		})
+
+		Convey("Doesn't record a failed apply", func() {
+			failRename(1)
+
+			factory := NewFileFactory(root, OverwriteOnConflict, nil)
+			_, err := factory.CreateFiles(files)
+			So(err, ShouldNotBeNil)
+
+			_, _, err = LastJournalEntry(root)
+			So(err, ShouldEqual, ErrNothingToUndo)
+		})
+	})
+}
@@ -0,0 +1,211 @@
+package keyring
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	fileVersion = 1
+	// iterations of PBKDF2, the cost of trying a passphrase
+	iterations = 200000
+	keyLength  = 32
+	saltLength = 16
+)
+
+// encryptedFile is the content of the file, the keys are a JSON map of the
+// profiles to their keys encrypted with AES-GCM and a key derived from the
+// passphrase with PBKDF2-SHA256.
+type encryptedFile struct {
+	Version    int    `json:"version"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Keys       []byte `json:"keys"`
+}
+
+// FileStore stores the keys in a file encrypted with a passphrase.
+type FileStore struct {
+	path       string
+	passphrase func() (string, error)
+	// secret is the passphrase once it was asked
+	secret string
+}
+
+// NewFileStore returns a store of the keys in an encrypted file, passphrase is
+// called the first time the file is read or written.
+func NewFileStore(path string, passphrase func() (string, error)) *FileStore {
+	return &FileStore{path: path, passphrase: passphrase}
+}
+
+func (s *FileStore) Get(profile string) (string, error) {
+	keys, err := s.read()
+	if err != nil {
+		return "", err
+	}
+	key, ok := keys[ProfileKey(profile)]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return key, nil
+}
+
+func (s *FileStore) Set(profile string, key string) error {
+	keys, err := s.read()
+	if err != nil {
+		return err
+	}
+	keys[ProfileKey(profile)] = key
+	return s.write(keys)
+}
+
+func (s *FileStore) Delete(profile string) error {
+	keys, err := s.read()
+	if err != nil {
+		return err
+	}
+	if _, ok := keys[ProfileKey(profile)]; !ok {
+		return ErrNotFound
+	}
+	delete(keys, ProfileKey(profile))
+	return s.write(keys)
+}
+
+func (s *FileStore) String() string {
+	return fmt.Sprintf("the encrypted file %s", s.path)
+}
+
+func (s *FileStore) secretPassphrase() (string, error) {
+	if s.secret != "" {
+		return s.secret, nil
+	}
+	secret, err := s.passphrase()
+	if err != nil {
+		return "", err
+	}
+	if secret == "" {
+		return "", errors.New("the passphrase of the keyring file can't be empty")
+	}
+	s.secret = secret
+	return secret, nil
+}
+
+// read decrypts the keys, a missing file has none and the passphrase isn't
+// asked.
+func (s *FileStore) read() (map[string]string, error) {
+	content, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var file encryptedFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, fmt.Errorf("invalid keyring file %s: %w", s.path, err)
+	}
+	if file.Version != fileVersion {
+		return nil, fmt.Errorf("unsupported keyring file %s, version %d", s.path, file.Version)
+	}
+	secret, err := s.secretPassphrase()
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(secret, file.Salt, file.Iterations)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := gcm.Open(nil, file.Nonce, file.Keys, nil)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decrypt %s, the passphrase is wrong or the file was modified", s.path)
+	}
+
+	keys := map[string]string{}
+	if err := json.Unmarshal(plain, &keys); err != nil {
+		return nil, fmt.Errorf("invalid keyring file %s: %w", s.path, err)
+	}
+	return keys, nil
+}
+
+// write encrypts the keys with a new salt and nonce.
+func (s *FileStore) write(keys map[string]string) error {
+	secret, err := s.secretPassphrase()
+	if err != nil {
+		return err
+	}
+	plain, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+
+	file := encryptedFile{Version: fileVersion, Iterations: iterations, Salt: make([]byte, saltLength)}
+	if _, err := rand.Read(file.Salt); err != nil {
+		return err
+	}
+	gcm, err := newGCM(secret, file.Salt, file.Iterations)
+	if err != nil {
+		return err
+	}
+	file.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(file.Nonce); err != nil {
+		return err
+	}
+	file.Keys = gcm.Seal(nil, file.Nonce, plain, nil)
+
+	content, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, content, 0o600)
+}
+
+func newGCM(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	if len(salt) == 0 || iterations <= 0 {
+		return nil, errors.New("invalid keyring file, the salt or the iterations are missing")
+	}
+	block, err := aes.NewCipher(pbkdf2([]byte(passphrase), salt, iterations, keyLength))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// pbkdf2 derives a key from a passphrase as described in RFC 8018 with
+// HMAC-SHA256.
+func pbkdf2(passphrase []byte, salt []byte, iterations int, length int) []byte {
+	mac := hmac.New(sha256.New, passphrase)
+	key := make([]byte, 0, length)
+	block := make([]byte, 4)
+	for index := uint32(1); len(key) < length; index++ {
+		binary.BigEndian.PutUint32(block, index)
+		mac.Reset()
+		mac.Write(salt)
+		mac.Write(block)
+		u := mac.Sum(nil)
+		t := append([]byte{}, u...)
+		for i := 1; i < iterations; i++ {
+			mac.Reset()
+			mac.Write(u)
+			u = mac.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:length]
+}
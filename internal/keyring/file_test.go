@@ -0,0 +1,19 @@
+package keyring
+
+import (
+	"encoding/hex"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPBKDF2(t *testing.T) {
+	Convey("PBKDF2-HMAC-SHA256", t, func() {
+		// test vectors of RFC 7914
+		key := pbkdf2([]byte("passwd"), []byte("salt"), 1, 64)
+		So(hex.EncodeToString(key), ShouldEqual, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783")
+
+		key = pbkdf2([]byte("Password"), []byte("NaCl"), 80000, 64)
+		So(hex.EncodeToString(key), ShouldEqual, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d")
+	})
+}
@@ -0,0 +1,119 @@
+// Package keyring stores the API keys of the profiles in the system keyring,
+// or in a file encrypted with a passphrase when there's no system keyring, so
+// they don't have to be passed in flags or environment variables.
+package keyring
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/manifoldco/promptui"
+)
+
+const (
+	AutoBackend   Backend = "auto"
+	SystemBackend Backend = "system"
+	FileBackend   Backend = "file"
+)
+
+const (
+	// Service is the name the keys are stored with in the system keyring.
+	Service = "application-ai"
+	// DefaultProfile is the name the key is stored with when no profile is
+	// used.
+	DefaultProfile = "default"
+	// PassphraseVariable is the environment variable with the passphrase of
+	// the encrypted file, it is asked when it isn't set.
+	PassphraseVariable = "APPLICATION_AI_KEYRING_PASSPHRASE"
+)
+
+// ErrNotFound is returned when there's no key stored for a profile.
+var ErrNotFound = errors.New("no API key is stored")
+
+// Backend is where the keys are stored.
+type Backend string
+
+// Backends returns the supported backends.
+func Backends() []string {
+	return []string{string(AutoBackend), string(SystemBackend), string(FileBackend)}
+}
+
+// ParseBackend validates a backend, empty means auto.
+func ParseBackend(value string) (Backend, error) {
+	if value == "" {
+		return AutoBackend, nil
+	}
+	for _, backend := range Backends() {
+		if value == backend {
+			return Backend(value), nil
+		}
+	}
+	return "", fmt.Errorf("invalid keyring %q, please choose one of these options: %s", value, strings.Join(Backends(), ", "))
+}
+
+// Store keeps an API key for every profile.
+type Store interface {
+	// Get returns the key of a profile, or ErrNotFound.
+	Get(profile string) (string, error)
+	Set(profile string, key string) error
+	// Delete removes the key of a profile, or returns ErrNotFound.
+	Delete(profile string) error
+	// String describes where the keys are stored.
+	String() string
+}
+
+// Open returns the store of a backend, auto uses the system keyring when
+// there's one and the encrypted file otherwise. The passphrase of the file is
+// only asked when it is read or written.
+func Open(backend Backend, file string, passphrase func() (string, error)) (Store, error) {
+	switch backend {
+	case SystemBackend:
+		system, ok := systemKeyring()
+		if !ok {
+			return nil, fmt.Errorf("there's no system keyring, install secret-tool on Linux or use the %s keyring", FileBackend)
+		}
+		return system, nil
+	case FileBackend:
+		return NewFileStore(file, passphrase), nil
+	case AutoBackend, "":
+		if system, ok := systemKeyring(); ok {
+			return system, nil
+		}
+		return NewFileStore(file, passphrase), nil
+	default:
+		return nil, fmt.Errorf("invalid keyring %q", backend)
+	}
+}
+
+// ProfileKey returns the name the key of a profile is stored with.
+func ProfileKey(profile string) string {
+	if profile == "" {
+		return DefaultProfile
+	}
+	return profile
+}
+
+// DefaultPassphrase reads the passphrase from PassphraseVariable or asks for it.
+func DefaultPassphrase() (string, error) {
+	if passphrase := os.Getenv(PassphraseVariable); passphrase != "" {
+		return passphrase, nil
+	}
+	return PromptSecret("Passphrase of the keyring file")
+}
+
+// PromptSecret asks for a secret without showing it.
+func PromptSecret(label string) (string, error) {
+	prompt := promptui.Prompt{
+		Label: label,
+		Mask:  '*',
+		Validate: func(value string) error {
+			if strings.TrimSpace(value) == "" {
+				return errors.New("it can't be empty")
+			}
+			return nil
+		},
+	}
+	return prompt.Run()
+}
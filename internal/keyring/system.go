@@ -0,0 +1,156 @@
+package keyring
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// commandKeyring stores the keys with the command line tool of the system
+// keyring, the Secret Service through secret-tool on Linux and the Keychain
+// through security on macOS.
+type commandKeyring struct {
+	name   string
+	tool   string
+	get    func(profile string) []string
+	set    func(profile string, key string) ([]string, string)
+	delete func(profile string) []string
+	// notFound tells whether a failed command means there's no key.
+	notFound func(exitCode int, output string) bool
+}
+
+// systemKeyring returns the keyring of the system, when there's one.
+func systemKeyring() (Store, bool) {
+	var keyring *commandKeyring
+	switch runtime.GOOS {
+	case "darwin":
+		keyring = keychain()
+	case "windows":
+		return nil, false
+	default:
+		// the Secret Service is reached through the session bus
+		if os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+			return nil, false
+		}
+		keyring = secretService()
+	}
+	if _, err := exec.LookPath(keyring.tool); err != nil {
+		return nil, false
+	}
+	return keyring, true
+}
+
+func secretService() *commandKeyring {
+	attributes := func(profile string) []string {
+		return []string{"service", Service, "profile", ProfileKey(profile)}
+	}
+	return &commandKeyring{
+		name: "the Secret Service",
+		tool: "secret-tool",
+		get: func(profile string) []string {
+			return append([]string{"lookup"}, attributes(profile)...)
+		},
+		set: func(profile string, key string) ([]string, string) {
+			label := fmt.Sprintf("--label=%s API key (%s)", Service, ProfileKey(profile))
+			return append([]string{"store", label}, attributes(profile)...), key
+		},
+		delete: func(profile string) []string {
+			return append([]string{"clear"}, attributes(profile)...)
+		},
+		notFound: func(exitCode int, output string) bool {
+			return exitCode == 1 && strings.TrimSpace(output) == ""
+		},
+	}
+}
+
+func keychain() *commandKeyring {
+	return &commandKeyring{
+		name: "the macOS Keychain",
+		tool: "security",
+		get: func(profile string) []string {
+			return []string{"find-generic-password", "-s", Service, "-a", ProfileKey(profile), "-w"}
+		},
+		set: func(profile string, key string) ([]string, string) {
+			// security -i reads the command from stdin so the key never shows
+			// in the arguments of the process, a prompt for the key would read
+			// it from the terminal instead of stdin
+			command := []string{"add-generic-password", "-U", "-s", Service, "-a", ProfileKey(profile), "-w", key}
+			for index, arg := range command {
+				command[index] = securityQuote(arg)
+			}
+			return []string{"-i"}, strings.Join(command, " ") + "\n"
+		},
+		delete: func(profile string) []string {
+			return []string{"delete-generic-password", "-s", Service, "-a", ProfileKey(profile)}
+		},
+		notFound: func(exitCode int, output string) bool {
+			// errSecItemNotFound
+			return exitCode == 44
+		},
+	}
+}
+
+// securityQuote quotes an argument of a command read by security -i.
+func securityQuote(arg string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
+
+func (k *commandKeyring) Get(profile string) (string, error) {
+	output, err := k.run(k.get(profile), "")
+	if err != nil {
+		return "", err
+	}
+	key := strings.TrimRight(output, "\r\n")
+	if key == "" {
+		return "", ErrNotFound
+	}
+	return key, nil
+}
+
+func (k *commandKeyring) Set(profile string, key string) error {
+	args, input := k.set(profile, key)
+	_, err := k.run(args, input)
+	return err
+}
+
+func (k *commandKeyring) Delete(profile string) error {
+	if _, err := k.Get(profile); err != nil {
+		return err
+	}
+	_, err := k.run(k.delete(profile), "")
+	return err
+}
+
+func (k *commandKeyring) String() string {
+	return k.name
+}
+
+func (k *commandKeyring) run(args []string, input string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	command := exec.Command(k.tool, args...)
+	command.Stdin = strings.NewReader(input)
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+
+	err := command.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if k.notFound(exitErr.ExitCode(), stdout.String()+stderr.String()) {
+			return "", ErrNotFound
+		}
+		return "", fmt.Errorf("%s failed: %s", k.tool, strings.TrimSpace(stderr.String()))
+	}
+	if err != nil {
+		return "", err
+	}
+	// security -i doesn't exit with the status of the commands it reads,
+	// their errors are only written
+	if len(args) > 0 && args[0] == "-i" && strings.TrimSpace(stderr.String()) != "" {
+		return "", fmt.Errorf("%s failed: %s", k.tool, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
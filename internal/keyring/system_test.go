@@ -0,0 +1,26 @@
+package keyring
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCommandKeyrings(t *testing.T) {
+	Convey("Command keyrings", t, func() {
+
+		Convey("Send the key on stdin instead of the arguments", func() {
+			for _, keyring := range []*commandKeyring{secretService(), keychain()} {
+				args, input := keyring.set("default", "my-secret-api-key")
+				So(args, ShouldNotContain, "my-secret-api-key")
+				So(input, ShouldContainSubstring, "my-secret-api-key")
+			}
+		})
+
+		Convey("Writes the Keychain command for security -i", func() {
+			args, input := keychain().set("azure-prod", `my"secret\key`)
+			So(args, ShouldResemble, []string{"-i"})
+			So(input, ShouldEqual, `"add-generic-password" "-U" "-s" "`+Service+`" "-a" "`+ProfileKey("azure-prod")+`" "-w" "my\"secret\\key"`+"\n")
+		})
+	})
+}
@@ -1,24 +1,68 @@
 package models
 
 import (
-	"encoding/json"
-	"fmt"
+	"reflect"
+	"strings"
 )
 
 type AppFile struct {
-	Name    string `required:"true" json:"fileName"`
-	Path    string `required:"true" json:"filePath"`
-	Content string `required:"true" json:"fileContent"`
+	Name    string `required:"true" json:"fileName" description:"The name of the file with its extension"`
+	Path    string `required:"true" json:"filePath" description:"The directory of the file as a relative path starting with a point, like ./src/"`
+	Content string `required:"true" json:"fileContent" description:"The whole content of the file"`
 }
 
-const parseError = "Sorry, Couldn't parse OpenAI response: %s"
+// AppFileSchema returns the JSON schema of an AppFile, built from the struct
+// tags so new fields are described to the model without further changes.
+func AppFileSchema() map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
 
-func AppFileFromString(text string) ([]AppFile, error) {
-	files := []AppFile{}
-	err := json.Unmarshal([]byte(text), &files)
-	if err != nil {
-		return nil, fmt.Errorf(parseError, err)
+	fileType := reflect.TypeOf(AppFile{})
+	for index := 0; index < fileType.NumField(); index++ {
+		field := fileType.Field(index)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+
+		properties[name] = map[string]interface{}{
+			"type":        schemaType(field.Type.Kind()),
+			"description": field.Tag.Get("description"),
+		}
+		if field.Tag.Get("required") == "true" {
+			required = append(required, name)
+		}
+	}
+
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
+
+func schemaType(kind reflect.Kind) string {
+	switch kind {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Struct, reflect.Map:
+		return "object"
+	default:
+		return "string"
 	}
+}
 
-	return files, nil
+const parseError = "Sorry, Couldn't parse OpenAI response: %s"
+
+// AppFileFromString reads the files of a model answer, see ParseAppFiles for
+// the defects that are repaired.
+func AppFileFromString(text string) ([]AppFile, error) {
+	files, _, err := ParseAppFiles(text)
+	return files, err
 }
@@ -0,0 +1,219 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Repair is a defect of a model answer that ParseAppFiles had to fix to read it.
+type Repair string
+
+const (
+	StrippedFences    Repair = "removed the markdown code fences"
+	StrippedProse     Repair = "removed the text around the JSON array"
+	RemovedCommas     Repair = "removed trailing commas"
+	EscapedCharacters Repair = "escaped new lines and control characters inside strings"
+	EscapedBackslash  Repair = "escaped backslashes that weren't valid JSON escapes"
+	DroppedTruncated  Repair = "dropped the last file because the answer was cut off"
+)
+
+var fencePattern = regexp.MustCompile("```[a-zA-Z]*")
+
+// ParseAppFiles reads the files of a model answer, tolerating the usual ways
+// models break the requested format: prose or markdown fences around the
+// array, trailing commas, raw new lines in the file content and answers cut
+// off by the token limit. It returns the repairs that were needed, none when
+// the answer was valid JSON.
+func ParseAppFiles(text string) ([]AppFile, []Repair, error) {
+	files := []AppFile{}
+	if err := json.Unmarshal([]byte(text), &files); err == nil {
+		return files, []Repair{}, nil
+	}
+
+	array, outside, err := extractArray(text)
+	if err != nil {
+		return nil, nil, fmt.Errorf(parseError, err)
+	}
+
+	repairs := []Repair{}
+	if fencePattern.MatchString(outside) {
+		outside = fencePattern.ReplaceAllString(outside, "")
+		repairs = append(repairs, StrippedFences)
+	}
+	if strings.TrimSpace(outside) != "" {
+		repairs = append(repairs, StrippedProse)
+	}
+
+	repaired, fixes := repairArray(array)
+	repairs = append(repairs, fixes...)
+
+	files = []AppFile{}
+	err = json.Unmarshal([]byte(repaired), &files)
+	if err != nil {
+		return nil, nil, fmt.Errorf(parseError, err)
+	}
+	if len(files) == 0 && containsRepair(repairs, DroppedTruncated) {
+		return nil, nil, fmt.Errorf(parseError, "the answer was cut off before the first file was complete")
+	}
+	return files, repairs, nil
+}
+
+// extractArray returns the text from the first '[' that opens an array of
+// objects to the ']' that closes it, or to the end if it is never closed,
+// and the text around it. Fences are found around the array instead of
+// extracting the fenced block because file contents often have fences too.
+func extractArray(text string) (string, string, error) {
+	start := -1
+	for index := strings.Index(text, "["); index >= 0; {
+		next := strings.TrimLeft(text[index+1:], " \t\r\n")
+		if strings.HasPrefix(next, "{") || strings.HasPrefix(next, "]") {
+			start = index
+			break
+		}
+		following := strings.Index(text[index+1:], "[")
+		if following < 0 {
+			break
+		}
+		index += following + 1
+	}
+	if start < 0 {
+		return "", "", fmt.Errorf("the answer doesn't contain a JSON array of files")
+	}
+
+	end := len(text)
+	depth := 0
+	inString := false
+	escaped := false
+	for index := start; index < len(text); index++ {
+		char := text[index]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case char == '\\':
+				escaped = true
+			case char == '"':
+				inString = false
+			}
+			continue
+		}
+
+		switch char {
+		case '"':
+			inString = true
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+		}
+		if depth == 0 {
+			end = index + 1
+			break
+		}
+	}
+
+	return text[start:end], text[:start] + text[end:], nil
+}
+
+// repairArray fixes the defects that keep an array from being valid JSON,
+// dropping the last object if the array was cut off in the middle of it.
+func repairArray(array string) (string, []Repair) {
+	var out strings.Builder
+	found := map[Repair]bool{}
+	stack := []byte{}
+	inString := false
+	escaped := false
+	lastComplete := -1
+
+	for index := 0; index < len(array); index++ {
+		char := array[index]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+				if !strings.ContainsRune(`"\/bfnrtu`, rune(char)) {
+					// the backslash was meant literally, like in a regular expression
+					out.WriteByte('\\')
+					found[EscapedBackslash] = true
+				}
+				out.WriteByte(char)
+			case char == '\\':
+				escaped = true
+				out.WriteByte(char)
+			case char == '"':
+				inString = false
+				out.WriteByte(char)
+			case char < 0x20:
+				out.WriteString(escapeControl(char))
+				found[EscapedCharacters] = true
+			default:
+				out.WriteByte(char)
+			}
+			continue
+		}
+
+		switch char {
+		case '"':
+			inString = true
+		case '[', '{':
+			stack = append(stack, char)
+		case ']', '}':
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case ',':
+			next := strings.TrimLeft(array[index+1:], " \t\r\n")
+			if strings.HasPrefix(next, "]") || strings.HasPrefix(next, "}") {
+				found[RemovedCommas] = true
+				continue
+			}
+		}
+		out.WriteByte(char)
+
+		if char == '}' && len(stack) == 1 {
+			lastComplete = out.Len()
+		}
+	}
+
+	repaired := out.String()
+	if len(stack) > 0 || inString {
+		found[DroppedTruncated] = true
+		if lastComplete < 0 {
+			repaired = "[]"
+		} else {
+			repaired = repaired[:lastComplete] + "]"
+		}
+	}
+
+	repairs := []Repair{}
+	for _, repair := range []Repair{RemovedCommas, EscapedCharacters, EscapedBackslash, DroppedTruncated} {
+		if found[repair] {
+			repairs = append(repairs, repair)
+		}
+	}
+	return repaired, repairs
+}
+
+func containsRepair(repairs []Repair, repair Repair) bool {
+	for _, found := range repairs {
+		if found == repair {
+			return true
+		}
+	}
+	return false
+}
+
+func escapeControl(char byte) string {
+	switch char {
+	case '\n':
+		return `\n`
+	case '\r':
+		return `\r`
+	case '\t':
+		return `\t`
+	default:
+		return fmt.Sprintf(`\u%04x`, char)
+	}
+}
@@ -0,0 +1,223 @@
+package models
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+const (
+	FileNameField    = "fileName"
+	FilePathField    = "filePath"
+	FileContentField = "fileContent"
+)
+
+type AppFileEventKind int
+
+const (
+	FileStarted AppFileEventKind = iota
+	FieldFragment
+	FieldCompleted
+	FileCompleted
+)
+
+// AppFileEvent describes the progress of a file while the JSON array that
+// contains it is still being received.
+type AppFileEvent struct {
+	Kind  AppFileEventKind
+	Index int
+	Field string
+	Text  string
+}
+
+// AppFileStreamDecoder decodes a JSON array of AppFile incrementally, reporting
+// field values as they arrive instead of waiting for the whole array. It is
+// meant for previews, the final result should still come from AppFileFromString.
+type AppFileStreamDecoder struct {
+	onEvent func(AppFileEvent)
+
+	started   bool
+	finished  bool
+	depth     int
+	index     int
+	expectKey bool
+
+	inString  bool
+	isKey     bool
+	escape    bool
+	hex       []rune
+	highSurr  rune
+	key       string
+	keyBuffer strings.Builder
+	value     strings.Builder
+	fragment  strings.Builder
+}
+
+func NewAppFileStreamDecoder(onEvent func(AppFileEvent)) *AppFileStreamDecoder {
+	return &AppFileStreamDecoder{onEvent: onEvent, index: -1}
+}
+
+// Write feeds the next chunk of the response to the decoder.
+func (d *AppFileStreamDecoder) Write(chunk string) {
+	for _, char := range chunk {
+		if d.finished {
+			return
+		}
+		if d.inString {
+			d.readStringChar(char)
+			continue
+		}
+		d.readStructuralChar(char)
+	}
+	d.flushFragment()
+}
+
+func (d *AppFileStreamDecoder) readStructuralChar(char rune) {
+	if !d.started {
+		if char == '[' {
+			d.started = true
+			d.depth = 1
+		}
+		return
+	}
+
+	switch char {
+	case '"':
+		d.inString = true
+		d.isKey = d.depth == 2 && d.expectKey
+		d.keyBuffer.Reset()
+		d.value.Reset()
+	case '{', '[':
+		d.depth++
+		if d.depth == 2 && char == '{' {
+			d.index++
+			d.expectKey = true
+			d.emit(AppFileEvent{Kind: FileStarted, Index: d.index})
+		}
+	case '}', ']':
+		if d.depth == 2 && char == '}' {
+			d.emit(AppFileEvent{Kind: FileCompleted, Index: d.index})
+		}
+		d.depth--
+		if d.depth == 0 {
+			d.finished = true
+		}
+	case ':':
+		if d.depth == 2 {
+			d.expectKey = false
+		}
+	case ',':
+		if d.depth == 2 {
+			d.expectKey = true
+		}
+	}
+}
+
+func (d *AppFileStreamDecoder) readStringChar(char rune) {
+	if d.hex != nil {
+		d.hex = append(d.hex, char)
+		if len(d.hex) == 4 {
+			d.writeRune(decodeHex(d.hex))
+			d.hex = nil
+		}
+		return
+	}
+
+	if d.escape {
+		d.escape = false
+		switch char {
+		case 'u':
+			d.hex = make([]rune, 0, 4)
+		case 'n':
+			d.writeRune('\n')
+		case 't':
+			d.writeRune('\t')
+		case 'r':
+			d.writeRune('\r')
+		case 'b':
+			d.writeRune('\b')
+		case 'f':
+			d.writeRune('\f')
+		default:
+			d.writeRune(char)
+		}
+		return
+	}
+
+	switch char {
+	case '\\':
+		d.escape = true
+	case '"':
+		d.closeString()
+	default:
+		d.writeRune(char)
+	}
+}
+
+func (d *AppFileStreamDecoder) writeRune(char rune) {
+	if utf16.IsSurrogate(char) {
+		if d.highSurr == 0 {
+			d.highSurr = char
+			return
+		}
+		char = utf16.DecodeRune(d.highSurr, char)
+	}
+	d.highSurr = 0
+
+	if d.isKey {
+		d.keyBuffer.WriteRune(char)
+		return
+	}
+	if d.depth != 2 {
+		return
+	}
+	d.value.WriteRune(char)
+	if d.key == FileContentField {
+		d.fragment.WriteRune(char)
+	}
+}
+
+func (d *AppFileStreamDecoder) closeString() {
+	d.inString = false
+	if d.isKey {
+		d.key = d.keyBuffer.String()
+		return
+	}
+	if d.depth != 2 {
+		return
+	}
+	d.flushFragment()
+	d.emit(AppFileEvent{Kind: FieldCompleted, Index: d.index, Field: d.key, Text: d.value.String()})
+}
+
+func (d *AppFileStreamDecoder) flushFragment() {
+	if d.fragment.Len() == 0 {
+		return
+	}
+	d.emit(AppFileEvent{Kind: FieldFragment, Index: d.index, Field: d.key, Text: d.fragment.String()})
+	d.fragment.Reset()
+}
+
+func (d *AppFileStreamDecoder) emit(event AppFileEvent) {
+	if d.onEvent != nil {
+		d.onEvent(event)
+	}
+}
+
+func decodeHex(digits []rune) rune {
+	var value rune
+	for _, digit := range digits {
+		value <<= 4
+		switch {
+		case digit >= '0' && digit <= '9':
+			value |= digit - '0'
+		case digit >= 'a' && digit <= 'f':
+			value |= digit - 'a' + 10
+		case digit >= 'A' && digit <= 'F':
+			value |= digit - 'A' + 10
+		default:
+			return unicode.ReplacementChar
+		}
+	}
+	return value
+}
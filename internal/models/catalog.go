@@ -0,0 +1,208 @@
+package models
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/afrancoc2000/application-helper-ai/internal/tokenizer"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed catalog.yaml
+var builtinCatalog []byte
+
+// Catalog holds the known models, the deployment names mapped onto them and
+// the prices of the models.
+type Catalog struct {
+	Models      []Model           `yaml:"models"`
+	Deployments map[string]string `yaml:"deployments"`
+	Prices      map[string]Price  `yaml:"prices"`
+}
+
+// DefaultCatalog returns the catalog embedded in the application.
+func DefaultCatalog() (*Catalog, error) {
+	catalog, err := parseCatalog(builtinCatalog)
+	if err == nil {
+		err = catalog.validate()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid built-in model catalog: %w", err)
+	}
+	return catalog, nil
+}
+
+// LoadCatalog returns the built-in catalog extended with the models and
+// deployments of the user catalog at path, models with the same name replace
+// the built-in ones.
+func LoadCatalog(path string) (*Catalog, error) {
+	catalog, err := DefaultCatalog()
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return catalog, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	userCatalog, err := parseCatalog(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid model catalog %s: %w", path, err)
+	}
+	catalog.merge(userCatalog)
+
+	if err := catalog.validate(); err != nil {
+		return nil, fmt.Errorf("invalid model catalog %s: %w", path, err)
+	}
+	return catalog, nil
+}
+
+// Model returns the catalog entry for a model name.
+func (c *Catalog) Model(name string) (Model, bool) {
+	for _, model := range c.Models {
+		if model.Name == name {
+			return model, true
+		}
+	}
+	return Model{}, false
+}
+
+// Deployment resolves a deployment name, either a model name or one of the
+// names in the deployments section, to the model that serves it.
+func (c *Catalog) Deployment(name string) (Deployment, error) {
+	modelName := name
+	if mapped, ok := c.Deployments[name]; ok {
+		modelName = mapped
+	}
+
+	model, ok := c.Model(modelName)
+	if !ok {
+		return Deployment{}, fmt.Errorf("The specified deployment does not exist, please choose one of these options: %s", strings.Join(c.Names(), ", "))
+	}
+	deployment := Deployment{Name: name, Model: model}
+	if price, ok := c.Prices[modelName]; ok {
+		deployment.Price = &price
+	}
+	return deployment, nil
+}
+
+// Names returns every model and deployment name in the catalog sorted alphabetically.
+func (c *Catalog) Names() []string {
+	names := []string{}
+	for _, model := range c.Models {
+		names = append(names, model.Name)
+	}
+	for deployment := range c.Deployments {
+		names = append(names, deployment)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c *Catalog) merge(other *Catalog) {
+	for _, model := range other.Models {
+		replaced := false
+		for index := range c.Models {
+			if c.Models[index].Name == model.Name {
+				c.Models[index] = model
+				replaced = true
+			}
+		}
+		if !replaced {
+			c.Models = append(c.Models, model)
+		}
+	}
+
+	if c.Deployments == nil {
+		c.Deployments = map[string]string{}
+	}
+	for deployment, model := range other.Deployments {
+		c.Deployments[deployment] = model
+	}
+
+	if c.Prices == nil {
+		c.Prices = map[string]Price{}
+	}
+	for model, price := range other.Prices {
+		c.Prices[model] = price
+	}
+}
+
+func (c *Catalog) validate() error {
+	for index, model := range c.Models {
+		if model.Name == "" {
+			return fmt.Errorf("models[%d]: name is required", index)
+		}
+		if model.ContextWindow <= 0 {
+			return fmt.Errorf("models[%d] (%s): contextWindow must be greater than 0", index, model.Name)
+		}
+		if model.MaxOutputTokens < 0 {
+			return fmt.Errorf("models[%d] (%s): maxOutputTokens can't be negative", index, model.Name)
+		}
+		if model.Mode != ChatMode && model.Mode != CompletionMode {
+			return fmt.Errorf("models[%d] (%s): mode must be %s or %s", index, model.Name, ChatMode, CompletionMode)
+		}
+		if !isTokenizer(model.Tokenizer) {
+			return fmt.Errorf("models[%d] (%s): tokenizer must be one of %v", index, model.Name, tokenizer.Names())
+		}
+		if model.Functions && model.Mode != ChatMode {
+			return fmt.Errorf("models[%d] (%s): only %s models support functions", index, model.Name, ChatMode)
+		}
+	}
+
+	for deployment, model := range c.Deployments {
+		if _, ok := c.Model(model); !ok {
+			return fmt.Errorf("deployments.%s: model %s is not in the catalog", deployment, model)
+		}
+	}
+
+	for model, price := range c.Prices {
+		if _, ok := c.Model(model); !ok {
+			return fmt.Errorf("prices.%s: model %s is not in the catalog", model, model)
+		}
+		if price.Prompt < 0 || price.Completion < 0 {
+			return fmt.Errorf("prices.%s: prices can't be negative", model)
+		}
+	}
+	return nil
+}
+
+func isTokenizer(name string) bool {
+	for _, known := range tokenizer.Names() {
+		if name == known {
+			return true
+		}
+	}
+	return false
+}
+
+func parseCatalog(data []byte) (*Catalog, error) {
+	catalog := &Catalog{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(catalog); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	for index := range catalog.Models {
+		if catalog.Models[index].Tokenizer == "" {
+			catalog.Models[index].Tokenizer = defaultTokenizer
+		}
+	}
+	if catalog.Deployments == nil {
+		catalog.Deployments = map[string]string{}
+	}
+	if catalog.Prices == nil {
+		catalog.Prices = map[string]Price{}
+	}
+	return catalog, nil
+}
@@ -1,72 +1,94 @@
 package models
 
-import "fmt"
-
-type Deployment int
+const (
+	ChatMode       ModelMode = "chat"
+	CompletionMode ModelMode = "completion"
+)
 
 const (
-	CodeDavinci002      Deployment = iota // code-davinci-002
-	TextDavinci003                        // text-davinci-003
-	Gpt35Turbo0301                        // gpt-3.5-turbo-0301
-	Gpt35Turbo                            // gpt-3.5-turbo
-	Gpt35Turbo0301Azure                   // gpt-35-turbo-0301
-	Gpt4_0314                             // gpt-4-0314
-	Gpt4_32k_0314                         // gpt-4-32k-0314
+	defaultTokenizer   = "cl100k_base"
+	localContextWindow = 4096
 )
 
+type ModelMode string
+
+// Model describes the limits and behaviour of a model in the catalog.
+type Model struct {
+	Name            string    `yaml:"name"`
+	ContextWindow   int       `yaml:"contextWindow"`
+	MaxOutputTokens int       `yaml:"maxOutputTokens"`
+	Mode            ModelMode `yaml:"mode"`
+	Tokenizer       string    `yaml:"tokenizer"`
+	Functions       bool      `yaml:"functions"`
+}
+
+// Deployment is the name used to call the API together with the model that
+// serves it. For OpenAI both names are the same, Azure deployments can have
+// any name.
+type Deployment struct {
+	Name  string
+	Model Model
+	// Price is nil when the catalog has no price for the model.
+	Price *Price
+}
+
 func (d Deployment) String() string {
-	return [...]string{
-		"code-davinci-002",
-		"text-davinci-003",
-		"gpt-3.5-turbo-0301",
-		"gpt-3.5-turbo",
-		"gpt-35-turbo-0301",
-		"gpt-4-0314",
-		"gpt-4-32k-0314",
-	}[d]
+	return d.Name
 }
 
 func (d Deployment) MaxTokens() int {
-	return [...]int{
-		8001, // code-davinci-002
-		4097, // text-davinci-003
-		4096, // gpt-3.5-turbo-0301
-		4096, // gpt-3.5-turbo
-		4096, // gpt-35-turbo-0301
-		8192, // gpt-4-0314
-		8192, // gpt-4-32k-0314
-	}[d]
+	return d.Model.ContextWindow
+}
+
+func (d Deployment) MaxOutputTokens() int {
+	if d.Model.MaxOutputTokens == 0 {
+		return d.Model.ContextWindow
+	}
+	return d.Model.MaxOutputTokens
 }
 
 func (d Deployment) IsChat() bool {
-	return [...]bool{
-		false, // code-davinci-002
-		false, // text-davinci-003
-		true,  // gpt-3.5-turbo-0301
-		true,  // gpt-3.5-turbo
-		true,  // gpt-35-turbo-0301
-		true,  // gpt-4-0314
-		true,  // gpt-4-32k-0314
-	}[d]
+	return d.Model.Mode == ChatMode
+}
+
+// SupportsFunctions returns whether the model can answer with function calls.
+func (d Deployment) SupportsFunctions() bool {
+	return d.IsChat() && d.Model.Functions
+}
+
+func (d Deployment) Tokenizer() string {
+	return d.Model.Tokenizer
 }
 
+// Cost returns what the tokens cost in US dollars and whether the price of
+// the model is known.
+func (d Deployment) Cost(promptTokens int, completionTokens int) (float64, bool) {
+	if d.Price == nil {
+		return 0, false
+	}
+	return d.Price.Cost(promptTokens, completionTokens), true
+}
+
+// DeploymentFromName looks up a deployment in the built-in catalog.
 func DeploymentFromName(name string) (Deployment, error) {
-	switch name {
-	case "code-davinci-002":
-		return CodeDavinci002, nil
-	case "text-davinci-003":
-		return TextDavinci003, nil
-	case "gpt-3.5-turbo-0301":
-		return Gpt35Turbo0301, nil
-	case "gpt-3.5-turbo":
-		return Gpt35Turbo, nil
-	case "gpt-35-turbo-0301":
-		return Gpt35Turbo0301Azure, nil
-	case "gpt-4-0314":
-		return Gpt4_0314, nil
-	case "gpt-4-32k-0314":
-		return Gpt4_32k_0314, nil
+	catalog, err := DefaultCatalog()
+	if err != nil {
+		return Deployment{}, err
 	}
+	return catalog.Deployment(name)
+}
 
-	return -1, fmt.Errorf("The specified deployment does not exist, please choose one of these options: code-davinci-002, text-davinci-003, gpt-3.5-turbo-0301, gpt-3.5-turbo, gpt-35-turbo-0301, gpt-4-0314, gpt-4-32k-0314")
+// LocalDeployment describes a model unknown to the catalog that is served by
+// a local provider, it is treated as a chat model with a small context window.
+func LocalDeployment(name string) Deployment {
+	return Deployment{
+		Name: name,
+		Model: Model{
+			Name:            name,
+			ContextWindow:   localContextWindow,
+			MaxOutputTokens: localContextWindow,
+			Mode:            ChatMode,
+			Tokenizer:       defaultTokenizer,
+		},
+	}
 }
@@ -6,8 +6,8 @@ import (
 )
 
 type Message struct {
-	Role    Role
-	Content string
+	Role    Role   `json:"role"`
+	Content string `json:"content"`
 }
 
 func ConvertToOpenAIMessages(messages []Message) []openAI.ChatCompletionRequestMessage {
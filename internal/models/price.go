@@ -0,0 +1,15 @@
+package models
+
+const tokensPerPrice = 1_000_000
+
+// Price is what a model charges in US dollars for a million tokens of the
+// prompt and of the completion.
+type Price struct {
+	Prompt     float64 `yaml:"prompt"`
+	Completion float64 `yaml:"completion"`
+}
+
+// Cost returns what the tokens cost in US dollars.
+func (p Price) Cost(promptTokens int, completionTokens int) float64 {
+	return (float64(promptTokens)*p.Prompt + float64(completionTokens)*p.Completion) / tokensPerPrice
+}
@@ -1,5 +1,7 @@
 package models
 
+import "fmt"
+
 type Role int
 
 const (
@@ -8,6 +10,26 @@ const (
 	Assistant
 )
 
+var roleNames = [...]string{"system", "user", "assistant"}
+
 func (r Role) String() string {
-	return [...]string{"system", "user", "assistant"}[r]
+	return roleNames[r]
+}
+
+// MarshalText stores the role by name so saved conversations stay readable.
+func (r Role) MarshalText() ([]byte, error) {
+	if r < 0 || int(r) >= len(roleNames) {
+		return nil, fmt.Errorf("invalid role %d", r)
+	}
+	return []byte(r.String()), nil
+}
+
+func (r *Role) UnmarshalText(text []byte) error {
+	for index, name := range roleNames {
+		if name == string(text) {
+			*r = Role(index)
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid role %q", text)
 }
@@ -0,0 +1,200 @@
+package openai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/afrancoc2000/application-helper-ai/internal/config"
+	"github.com/afrancoc2000/application-helper-ai/internal/models"
+)
+
+// Cassette holds the queries sent to a model and its answers so a generation
+// can be replayed without calling the API, for tests and demos.
+type Cassette struct {
+	RecordedAt   time.Time     `json:"recordedAt"`
+	Deployment   string        `json:"deployment"`
+	ChatContext  string        `json:"chatContext,omitempty"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a query and its answer, or the error it failed with.
+type Interaction struct {
+	Prompt string `json:"prompt"`
+	Stream bool   `json:"stream,omitempty"`
+	// Chunks are the parts of a streamed answer as they were received.
+	Chunks []string   `json:"chunks,omitempty"`
+	Answer string     `json:"answer"`
+	Error  string     `json:"error,omitempty"`
+	Usage  TokenUsage `json:"usage"`
+}
+
+// LoadCassette reads a cassette written by a recording.
+func LoadCassette(path string) (*Cassette, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cassette := &Cassette{}
+	if err := json.Unmarshal(content, cassette); err != nil {
+		return nil, fmt.Errorf("invalid cassette %s: %w", path, err)
+	}
+	return cassette, nil
+}
+
+// Save writes the cassette through a temporary file so an interrupted
+// recording keeps the interactions saved before.
+func (c *Cassette) Save(path string) error {
+	content, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	temp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = temp.Write(content)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+	}
+	return err
+}
+
+// recordingClient saves every query of the wrapped client and its answer in a
+// cassette, written again after every query.
+type recordingClient struct {
+	AIClient
+	path     string
+	mutex    sync.Mutex
+	cassette *Cassette
+}
+
+func newRecordingClient(client AIClient, appConfig config.AppConfig) *recordingClient {
+	return &recordingClient{
+		AIClient: client,
+		path:     appConfig.RecordCassette,
+		cassette: &Cassette{
+			RecordedAt:   time.Now().UTC(),
+			Deployment:   appConfig.OpenaiDeployment.String(),
+			ChatContext:  appConfig.ChatContext,
+			Interactions: []Interaction{},
+		},
+	}
+}
+
+func (c *recordingClient) QueryOpenAI(ctx context.Context, prompt string) (string, error) {
+	answer, err := c.AIClient.QueryOpenAI(ctx, prompt)
+	return c.record(Interaction{Prompt: prompt, Answer: answer}, err)
+}
+
+func (c *recordingClient) QueryOpenAIStream(ctx context.Context, prompt string, onData func(chunk string)) (string, error) {
+	chunks := []string{}
+	answer, err := c.AIClient.QueryOpenAIStream(ctx, prompt, func(chunk string) {
+		chunks = append(chunks, chunk)
+		onData(chunk)
+	})
+	return c.record(Interaction{Prompt: prompt, Stream: true, Chunks: chunks, Answer: answer}, err)
+}
+
+func (c *recordingClient) record(interaction Interaction, queryErr error) (string, error) {
+	if queryErr != nil {
+		interaction.Error = queryErr.Error()
+	} else {
+		interaction.Usage = c.AIClient.LastUsage()
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.cassette.Interactions = append(c.cassette.Interactions, interaction)
+	if err := c.cassette.Save(c.path); err != nil {
+		return "", fmt.Errorf("couldn't record the answer in %s: %w", c.path, err)
+	}
+	return interaction.Answer, queryErr
+}
+
+// replayClient answers with the interactions of a cassette in the order they
+// were recorded, failing when a query doesn't match the recorded one so a
+// test notices when the prompts change.
+type replayClient struct {
+	path      string
+	cassette  *Cassette
+	next      int
+	appConfig config.AppConfig
+	messages  []models.Message
+	usageRecorder
+}
+
+func newReplayClient(appConfig config.AppConfig) (AIClient, error) {
+	cassette, err := LoadCassette(appConfig.ReplayCassette)
+	if err != nil {
+		return nil, err
+	}
+	return &replayClient{
+		path:      appConfig.ReplayCassette,
+		cassette:  cassette,
+		appConfig: appConfig,
+		messages:  initializeMessages(appConfig.ChatContext),
+	}, nil
+}
+
+func (c *replayClient) QueryOpenAI(ctx context.Context, prompt string) (string, error) {
+	return c.QueryOpenAIStream(ctx, prompt, func(string) {})
+}
+
+func (c *replayClient) QueryOpenAIStream(ctx context.Context, prompt string, onData func(chunk string)) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if c.next >= len(c.cassette.Interactions) {
+		return "", fmt.Errorf("the cassette %s has no answer for query %d, it only has %d", c.path, c.next+1, len(c.cassette.Interactions))
+	}
+
+	interaction := c.cassette.Interactions[c.next]
+	if interaction.Prompt != prompt {
+		return "", fmt.Errorf("query %d doesn't match the cassette %s, expected the prompt %q but got %q", c.next+1, c.path, interaction.Prompt, prompt)
+	}
+	c.next++
+
+	if interaction.Error != "" {
+		return "", errors.New(interaction.Error)
+	}
+
+	chunks := interaction.Chunks
+	if len(chunks) == 0 {
+		chunks = []string{interaction.Answer}
+	}
+	for _, chunk := range chunks {
+		onData(chunk)
+	}
+
+	c.messages = append(c.messages,
+		models.Message{Role: models.User, Content: prompt},
+		models.Message{Role: models.Assistant, Content: interaction.Answer})
+	c.record(c.appConfig.OpenaiDeployment, 0, interaction.Answer, interaction.Usage)
+	return interaction.Answer, nil
+}
+
+func (c *replayClient) History() []models.Message {
+	return append([]models.Message{}, c.messages...)
+}
+
+func (c *replayClient) SetHistory(messages []models.Message) {
+	c.messages = append([]models.Message{}, messages...)
+}
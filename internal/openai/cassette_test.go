@@ -0,0 +1,79 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/afrancoc2000/application-helper-ai/internal/config"
+	"github.com/afrancoc2000/application-helper-ai/internal/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// scriptedClient answers with its answers in order, nil error answers are successful.
+type scriptedClient struct {
+	replayClient
+	errs []error
+}
+
+func (c *scriptedClient) QueryOpenAIStream(ctx context.Context, prompt string, onData func(chunk string)) (string, error) {
+	err := c.errs[0]
+	c.errs = c.errs[1:]
+	if err != nil {
+		return "", err
+	}
+	return c.replayClient.QueryOpenAIStream(ctx, prompt, onData)
+}
+
+func TestCassette(t *testing.T) {
+	offlineTokenizers(t)
+
+	Convey("Cassette", t, func() {
+
+		path := filepath.Join(t.TempDir(), "cassette.json")
+		appConfig := config.AppConfig{
+			OpenaiDeployment: models.LocalDeployment("llama2"),
+			RecordCassette:   path,
+			ReplayCassette:   path,
+		}
+		source := &Cassette{Interactions: []Interaction{
+			{Prompt: "Create a page", Answer: "[]", Usage: TokenUsage{PromptTokens: 100, CompletionTokens: 1}},
+		}}
+		scripted := &scriptedClient{
+			replayClient: replayClient{path: "source", cassette: source, appConfig: appConfig},
+			errs:         []error{errors.New("server unavailable"), nil},
+		}
+
+		Convey("Records answers and errors, and replays them", func() {
+			recorder := newRecordingClient(scripted, appConfig)
+			_, err := recorder.QueryOpenAIStream(context.Background(), "Create a page", func(string) {})
+			So(err, ShouldNotBeNil)
+			// the failed query is recorded, the source cassette isn't consumed
+			scripted.next = 0
+			_, err = recorder.QueryOpenAIStream(context.Background(), "Create a page", func(string) {})
+			So(err, ShouldBeNil)
+
+			replay, err := newReplayClient(appConfig)
+			So(err, ShouldBeNil)
+
+			_, err = replay.QueryOpenAI(context.Background(), "Create a page")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "server unavailable")
+
+			chunks := []string{}
+			answer, err := replay.QueryOpenAIStream(context.Background(), "Create a page", func(chunk string) {
+				chunks = append(chunks, chunk)
+			})
+			So(err, ShouldBeNil)
+			So(answer, ShouldEqual, "[]")
+			So(chunks, ShouldResemble, []string{"[]"})
+			So(replay.LastUsage(), ShouldResemble, TokenUsage{PromptTokens: 100, CompletionTokens: 1})
+			So(replay.History()[len(replay.History())-1].Content, ShouldEqual, "[]")
+
+			_, err = replay.QueryOpenAI(context.Background(), "Add a title")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "has no answer for query 3")
+		})
+	})
+}
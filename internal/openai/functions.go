@@ -0,0 +1,226 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	openAI "github.com/PullRequestInc/go-gpt3"
+	"github.com/afrancoc2000/application-helper-ai/internal/models"
+	azureOpenAI "github.com/sozercan/kubectl-ai/pkg/gpt3"
+)
+
+const (
+	filesFunctionName        = "create_files"
+	filesArgument            = "files"
+	defaultOpenAIBaseURL     = "https://api.openai.com/v1"
+	azureFunctionsAPIVersion = "2023-07-01-preview"
+)
+
+// functionsParameter finds the functions parameters named in an error as the
+// argument that isn't supported, like "Unrecognized request argument
+// supplied: functions" or "'function_call' was unexpected".
+var functionsParameter = regexp.MustCompile("(argument[^:]*:\\s*|['\"`])(functions|function_call)\\b")
+
+type functionDefinition struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Parameters  map[string]interface{} `json:"parameters"`
+}
+
+type functionChatRequest struct {
+	Model        string                                `json:"model,omitempty"`
+	Messages     []openAI.ChatCompletionRequestMessage `json:"messages"`
+	MaxTokens    int                                   `json:"max_tokens,omitempty"`
+	N            int                                   `json:"n,omitempty"`
+	Temperature  *float32                              `json:"temperature,omitempty"`
+	Stream       bool                                  `json:"stream"`
+	Functions    []functionDefinition                  `json:"functions"`
+	FunctionCall map[string]string                     `json:"function_call"`
+}
+
+type functionCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// filesFunction describes the generated files as the arguments of a function
+// so the API answers with them as structured data instead of free text.
+func filesFunction() functionDefinition {
+	return functionDefinition{
+		Name:        filesFunctionName,
+		Description: "Creates the files needed to build the application",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				filesArgument: map[string]interface{}{
+					"type":  "array",
+					"items": models.AppFileSchema(),
+				},
+			},
+			"required": []string{filesArgument},
+		},
+	}
+}
+
+// functionsClient calls the chat completions endpoint forcing the files
+// function, neither of the clients we depend on supports functions.
+type functionsClient struct {
+	httpClient        *http.Client
+	url               string
+	headers           map[string]string
+	errorFromResponse func(resp *http.Response) error
+	out               io.Writer
+}
+
+func newOpenAIFunctionsClient(httpClient *http.Client, baseURL string, apiKey string) *functionsClient {
+	if baseURL == "" {
+		baseURL = defaultOpenAIBaseURL
+	}
+	return &functionsClient{
+		httpClient:        httpClient,
+		url:               strings.TrimSuffix(baseURL, "/") + "/chat/completions",
+		headers:           map[string]string{"Authorization": "Bearer " + apiKey},
+		errorFromResponse: openAIErrorFromResponse,
+		out:               os.Stderr,
+	}
+}
+
+func newAzureFunctionsClient(httpClient *http.Client, endpoint string, deployment string, apiKey string) *functionsClient {
+	return &functionsClient{
+		httpClient: httpClient,
+		url: fmt.Sprintf("%s/openai/deployments/%s/chat/completions?api-version=%s",
+			strings.TrimSuffix(endpoint, "/"), deployment, azureFunctionsAPIVersion),
+		headers:           map[string]string{"api-key": apiKey},
+		errorFromResponse: azureErrorFromResponse,
+		out:               os.Stderr,
+	}
+}
+
+// rejected returns whether the API refused a request because of the files
+// function, the older versions of the models, like the 0301 deployments of
+// gpt-35-turbo, answer them with a 400 that names the functions parameters.
+// Other 400s, like a prompt that is too long, aren't about functions. The user
+// is told the answer is asked as text instead.
+func (c *functionsClient) rejected(err error) bool {
+	var openAIError openAI.APIError
+	var azureError azureOpenAI.APIError
+	rejected := false
+	switch {
+	case errors.As(err, &openAIError):
+		rejected = openAIError.StatusCode == http.StatusBadRequest && functionsParameter.MatchString(openAIError.Message)
+	case errors.As(err, &azureError):
+		rejected = azureError.StatusCode == http.StatusBadRequest && functionsParameter.MatchString(azureError.Message)
+	}
+	if rejected {
+		fmt.Fprintf(c.out, "%s\nThe deployment doesn't support functions, asking for the files as text...\n", err)
+	}
+	return rejected
+}
+
+// query streams the arguments of the files function, calling onData with
+// every chunk, and returns the generated files as a JSON array with the usage
+// reported by the API, if any.
+func (c *functionsClient) query(ctx context.Context, request functionChatRequest, onData func(chunk string)) (string, TokenUsage, error) {
+	request.Stream = true
+	request.Functions = []functionDefinition{filesFunction()}
+	request.FunctionCall = map[string]string{"name": filesFunctionName}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return "", TokenUsage{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return "", TokenUsage{}, err
+	}
+	req.Header.Set("Content-type", "application/json")
+	for name, value := range c.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", TokenUsage{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", TokenUsage{}, c.errorFromResponse(resp)
+	}
+
+	var arguments, content strings.Builder
+	var reported TokenUsage
+	err = readEventStream(resp.Body, func(data []byte) error {
+		output := new(chatCompletionStreamResponse)
+		if err := json.Unmarshal(data, output); err != nil {
+			return fmt.Errorf("invalid json stream data: %w", err)
+		}
+		if output.Usage != nil {
+			reported = output.Usage.tokenUsage()
+		}
+		if len(output.Choices) == 0 {
+			return nil
+		}
+
+		delta := output.Choices[0].Delta
+		if delta.FunctionCall != nil && delta.FunctionCall.Arguments != "" {
+			arguments.WriteString(delta.FunctionCall.Arguments)
+			onData(delta.FunctionCall.Arguments)
+		}
+		if delta.Content != "" {
+			content.WriteString(delta.Content)
+			onData(delta.Content)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", TokenUsage{}, err
+	}
+
+	if arguments.Len() == 0 {
+		return content.String(), reported, nil
+	}
+	return filesFromArguments(arguments.String()), reported, nil
+}
+
+// filesFromArguments returns the files array of the function arguments. If
+// the arguments aren't valid JSON they are returned as they are, the array
+// is still found in them when the answer is parsed.
+func filesFromArguments(arguments string) string {
+	parsed := map[string]json.RawMessage{}
+	if err := json.Unmarshal([]byte(arguments), &parsed); err != nil {
+		return arguments
+	}
+	files, ok := parsed[filesArgument]
+	if !ok {
+		return arguments
+	}
+	return string(files)
+}
+
+func openAIErrorFromResponse(resp *http.Response) error {
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read from body: %w", err)
+	}
+
+	var result openAI.APIErrorResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		return openAI.APIError{
+			StatusCode: resp.StatusCode,
+			Type:       "Unexpected",
+			Message:    string(data),
+		}
+	}
+	result.Error.StatusCode = resp.StatusCode
+	return result.Error
+}
@@ -0,0 +1,129 @@
+package openai
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/afrancoc2000/application-helper-ai/internal/config"
+	"github.com/afrancoc2000/application-helper-ai/internal/models"
+)
+
+const (
+	// minCompletionTokens is the completion budget guaranteed before every
+	// request, smaller for models or max tokens that can't afford it.
+	minCompletionTokens = 1000
+	droppedLineLength   = 200
+	droppedPrefix       = "Earlier requests of this conversation were dropped to fit the context window, their files were already generated:"
+)
+
+// fitHistory drops the oldest turns of a conversation until the completion
+// has at least the minimum budget left. The first fixed messages, the context
+// and the example, and the last message, the new prompt, are always kept. The
+// history is truncated, not summarized: the prompts of the dropped turns and
+// the names of the files generated in them are listed in a message right after
+// the fixed ones so the model still knows what was asked and created before.
+func fitHistory(messages []models.Message, fixed int, appConfig config.AppConfig, count func([]models.Message) (int, error)) ([]models.Message, *int, int, error) {
+	deployment := appConfig.OpenaiDeployment
+	minimum := minimumCompletionTokens(deployment, appConfig.MaxTokens)
+
+	for {
+		promptTokens, err := count(messages)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		maxTokens := remainingTokens(promptTokens, deployment, appConfig.MaxTokens)
+		if *maxTokens >= minimum {
+			return messages, maxTokens, promptTokens, nil
+		}
+
+		trimmed, ok := truncateOldestTurn(messages, fixed)
+		if !ok {
+			return nil, nil, 0, fmt.Errorf("the prompt leaves %d tokens for the answer of %s and at least %d are needed, shorten the prompt or the context, or use a model with a bigger context window", *maxTokens, deployment, minimum)
+		}
+		messages = trimmed
+	}
+}
+
+func minimumCompletionTokens(deployment models.Deployment, userMaxTokens int) int {
+	limit := deployment.MaxTokens()
+	if userMaxTokens > 0 && userMaxTokens < limit {
+		limit = userMaxTokens
+	}
+
+	minimum := minCompletionTokens
+	if deployment.MaxOutputTokens() < minimum {
+		minimum = deployment.MaxOutputTokens()
+	}
+	if limit/4 < minimum {
+		minimum = limit / 4
+	}
+	return minimum
+}
+
+// truncateOldestTurn removes the oldest prompt after the fixed messages
+// together with its answer, adding the prompt and the files of the answer to
+// the list of dropped turns. It returns false when there is nothing left to
+// drop.
+func truncateOldestTurn(messages []models.Message, fixed int) ([]models.Message, bool) {
+	if len(messages) <= fixed {
+		return messages, false
+	}
+
+	start := fixed
+	dropped := []string{}
+	if isDroppedTurns(messages[start]) {
+		dropped = strings.Split(strings.TrimPrefix(messages[start].Content, droppedPrefix+"\n"), "\n")
+		start++
+	}
+
+	// the last message is the prompt being sent
+	if start >= len(messages)-1 {
+		return messages, false
+	}
+
+	end := start + 1
+	if messages[start].Role == models.User {
+		line := "- " + promptLine(messages[start].Content)
+		if end < len(messages)-1 && messages[end].Role == models.Assistant {
+			if files := fileNames(messages[end].Content); len(files) > 0 {
+				line += " (files: " + strings.Join(files, ", ") + ")"
+			}
+			end++
+		}
+		dropped = append(dropped, line)
+	}
+
+	trimmed := append([]models.Message{}, messages[:fixed]...)
+	trimmed = append(trimmed, models.Message{
+		Role:    models.System,
+		Content: droppedPrefix + "\n" + strings.Join(dropped, "\n"),
+	})
+	return append(trimmed, messages[end:]...), true
+}
+
+func promptLine(prompt string) string {
+	line := []rune(strings.Join(strings.Fields(prompt), " "))
+	if len(line) > droppedLineLength {
+		return string(line[:droppedLineLength-3]) + "..."
+	}
+	return string(line)
+}
+
+// fileNames returns the paths of the files of an answer, none when it can't
+// be parsed.
+func fileNames(answer string) []string {
+	files, _, err := models.ParseAppFiles(answer)
+	if err != nil {
+		return nil
+	}
+	names := []string{}
+	for _, file := range files {
+		names = append(names, path.Join(file.Path, file.Name))
+	}
+	return names
+}
+
+func isDroppedTurns(message models.Message) bool {
+	return strings.HasPrefix(message.Content, droppedPrefix)
+}
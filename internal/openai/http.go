@@ -0,0 +1,106 @@
+package openai
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/afrancoc2000/application-helper-ai/internal/config"
+)
+
+// newHTTPClient returns the HTTP client used to call the API with the
+// configured proxy, CA bundle, extra headers and timeout, the provider's
+// default timeout is used when none is configured. All of them report the
+// Retry-After headers to the retrying client.
+func newHTTPClient(appConfig config.AppConfig, defaultTimeout time.Duration) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if appConfig.Proxy != "" {
+		proxyURL, err := url.Parse(appConfig.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", config.ProxyLabel, appConfig.Proxy, err)
+		}
+		transport.Proxy = explicitProxy(proxyURL)
+	}
+
+	if appConfig.CABundle != "" {
+		pool, err := loadCABundle(appConfig.CABundle)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	var roundTripper http.RoundTripper = transport
+	if len(appConfig.Headers) > 0 {
+		roundTripper = &headerTransport{base: roundTripper, headers: appConfig.Headers}
+	}
+
+	timeout := appConfig.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &retryAfterTransport{base: roundTripper},
+	}, nil
+}
+
+// explicitProxy sends the requests through the configured proxy, except the
+// ones to loopback and link-local addresses, like the managed identity
+// endpoint, which a proxy can't reach.
+func explicitProxy(proxyURL *url.URL) func(req *http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		if isLocalHost(req.URL.Hostname()) {
+			return nil, nil
+		}
+		return proxyURL, nil
+	}
+}
+
+func isLocalHost(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && (ip.IsLoopback() || ip.IsLinkLocalUnicast())
+}
+
+// loadCABundle trusts the certificates of a PEM file besides the ones of the
+// system, for gateways signed by an internal certificate authority.
+func loadCABundle(path string) (*x509.CertPool, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read the %s: %w", config.CABundleLabel, err)
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(content) {
+		return nil, fmt.Errorf("the %s %s has no PEM encoded certificates", config.CABundleLabel, path)
+	}
+	return pool, nil
+}
+
+// headerTransport adds the configured headers to every request, replacing the
+// ones set by the clients.
+type headerTransport struct {
+	base    http.RoundTripper
+	headers map[string]string
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for name, value := range t.headers {
+		req.Header.Set(name, value)
+	}
+	return t.base.RoundTrip(req)
+}
@@ -4,19 +4,22 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"strings"
 	"time"
 
 	openAI "github.com/PullRequestInc/go-gpt3"
 	"github.com/afrancoc2000/application-helper-ai/internal/config"
 	"github.com/afrancoc2000/application-helper-ai/internal/models"
-	gptEncoder "github.com/samber/go-gpt-3-encoder"
 	azureOpenAI "github.com/sozercan/kubectl-ai/pkg/gpt3"
 )
 
 const (
 	numberOfChoices      = 1
 	reservedTokens       = 200
+	azureTimeout         = 60 * time.Second
+	openAITimeout        = 60 * time.Second
+	localTimeout         = 5 * time.Minute
 	baseContext          = "You are a coding assistant for developers, you help developers create applications, you specify one by one the files needed to build an application telling the file name, the file path and the file content. You specify the file path as a valid relative path starting with a point '.'. You must return the answer as a json array, the user is a computer that needs to be able to parse your answer. You don't give explanations you don't show the commands needed to run."
 	examplePrompt        = "Create a terraform project for a resource group"
 	exampleAnswerName    = "main.tf"
@@ -37,93 +40,89 @@ resource "azurerm_resource_group" "aks" {
 
 type AIClient interface {
 	QueryOpenAI(ctx context.Context, prompt string) (string, error)
-}
-
-func NewAIClient(appConfig config.AppConfig) (AIClient, error) {
-	isChat := isChat(appConfig.OpenaiDeployment)
-	isOpenAI := isOpenAI(appConfig.AzureOpenaiEndpoint)
-	if isOpenAI {
-		client := openAI.NewClient(appConfig.OpenaiApiKey)
-		if isChat {
-			messages := initializeMessages(appConfig.ChatContext)
-			return &openAIChatClient{client: client, appConfig: appConfig, messages: messages}, nil
-		} else {
-			prompts := initializePrompts(appConfig.ChatContext)
-			return &openAICompletionClient{client: client, appConfig: appConfig, prompts: prompts}, nil
-		}
-	} else {
-		client, err := azureOpenAI.NewClient(
-			appConfig.AzureOpenaiEndpoint,
-			appConfig.OpenaiApiKey,
-			appConfig.OpenaiDeployment.String(),
-			azureOpenAI.WithTimeout(60*time.Second))
-		if err != nil {
-			return nil, err
-		}
-
-		if isChat {
-			messages := initializeMessages(appConfig.ChatContext)
-			return &azureAIChatClient{client: client, appConfig: appConfig, messages: messages}, nil
-		} else {
-			prompts := initializePrompts(appConfig.ChatContext)
-			return &azureAICompletionClient{client: client, appConfig: appConfig, prompts: prompts}, nil
-		}
-	}
+	// QueryOpenAIStream behaves like QueryOpenAI but calls onData with every
+	// chunk of the answer as soon as it is received.
+	QueryOpenAIStream(ctx context.Context, prompt string, onData func(chunk string)) (string, error)
+	// History returns the conversation sent to the model so far, including the
+	// context and the example that start it.
+	History() []models.Message
+	// SetHistory replaces the conversation, used to resume a saved session.
+	SetHistory(messages []models.Message)
+	// LastUsage returns the tokens counted for the last successful query.
+	LastUsage() TokenUsage
 }
 
 func isChat(deployment models.Deployment) bool {
 	return deployment.IsChat()
 }
 
-func isOpenAI(endpoint string) bool {
-	return endpoint == ""
-}
-
 type openAICompletionClient struct {
 	client    openAI.Client
 	appConfig config.AppConfig
-	prompts   []string
+	// messages keep the prompts and the answers, they are sent as prompts
+	messages []models.Message
+	usageRecorder
 }
 
 type openAIChatClient struct {
 	client    openAI.Client
+	functions *functionsClient
 	appConfig config.AppConfig
 	messages  []models.Message
+	usageRecorder
 }
 
 type azureAICompletionClient struct {
 	client    azureOpenAI.Client
 	appConfig config.AppConfig
-	prompts   []string
+	// messages keep the prompts and the answers, they are sent as prompts
+	messages []models.Message
+	usageRecorder
 }
 
 type azureAIChatClient struct {
-	client    azureOpenAI.Client
-	appConfig config.AppConfig
-	messages  []models.Message
+	client     azureOpenAI.Client
+	httpClient *http.Client
+	functions  *functionsClient
+	appConfig  config.AppConfig
+	messages   []models.Message
+	usageRecorder
 }
 
-func calculateCompletionTokens(prompts []string, appConfig config.AppConfig) (*int, error) {
-	return calculateMaxTokens(strings.Join(prompts, "\n"), appConfig.OpenaiDeployment, appConfig.MaxTokens)
+// calculateCompletionTokens fits the messages of a completion model in the
+// context window of the deployment, see fitHistory, and returns them with the
+// tokens left for the completion and the tokens of the prompts.
+func calculateCompletionTokens(messages []models.Message, appConfig config.AppConfig) ([]models.Message, *int, int, error) {
+	return fitHistory(messages, len(initializePrompts("")), appConfig, func(messages []models.Message) (int, error) {
+		return countTokens(appConfig.OpenaiDeployment, strings.Join(messagesToPrompts(messages), "\n"))
+	})
 }
 
-func calculateChatTokens(messages []models.Message, appConfig config.AppConfig) (*int, error) {
-	prompts, err := json.Marshal(messages)
-	if err != nil {
-		return nil, err
-	}
-	return calculateMaxTokens(string(prompts), appConfig.OpenaiDeployment, appConfig.MaxTokens)
+// calculateChatTokens fits the messages in the context window of the
+// deployment, see fitHistory, and returns them with the tokens left for the
+// completion and the tokens of the messages, including the files function
+// definition when it is sent.
+func calculateChatTokens(messages []models.Message, appConfig config.AppConfig, functions bool) ([]models.Message, *int, int, error) {
+	return fitHistory(messages, len(initializeMessages("")), appConfig, func(messages []models.Message) (int, error) {
+		tokens, err := countMessages(appConfig.OpenaiDeployment, messages)
+		if err != nil || !functions {
+			return tokens, err
+		}
+		functionTokens, err := countFunction(appConfig.OpenaiDeployment, filesFunction())
+		return tokens + functionTokens, err
+	})
 }
 
 func (c *openAICompletionClient) QueryOpenAI(ctx context.Context, prompt string) (string, error) {
-	c.prompts = append(c.prompts, prompt)
-	maxTokens, err := calculateCompletionTokens(c.prompts, c.appConfig)
+	c.messages = append(c.messages, models.Message{Role: models.User, Content: prompt})
+	messages, maxTokens, promptTokens, err := calculateCompletionTokens(c.messages, c.appConfig)
 	if err != nil {
 		return "", err
 	}
+	c.messages = messages
 
 	resp, err := c.client.CompletionWithEngine(ctx, c.appConfig.OpenaiDeployment.String(), openAI.CompletionRequest{
-		Prompt:      c.prompts,
+		Prompt:      messagesToPrompts(c.messages),
 		MaxTokens:   maxTokens,
 		Echo:        false,
 		N:           &c.appConfig.Choices,
@@ -137,22 +136,67 @@ func (c *openAICompletionClient) QueryOpenAI(ctx context.Context, prompt string)
 		return "", fmt.Errorf("expected choices to be 1 but received: %d", len(resp.Choices))
 	}
 
+	c.messages = append(c.messages, models.Message{Role: models.Assistant, Content: resp.Choices[0].Text})
+	c.record(c.appConfig.OpenaiDeployment, promptTokens, resp.Choices[0].Text, TokenUsage{
+		PromptTokens:     resp.Usage.PromptTokens,
+		CompletionTokens: resp.Usage.CompletionTokens,
+	})
 	return resp.Choices[0].Text, nil
 }
 
+func (c *openAICompletionClient) QueryOpenAIStream(ctx context.Context, prompt string, onData func(chunk string)) (string, error) {
+	c.messages = append(c.messages, models.Message{Role: models.User, Content: prompt})
+	messages, maxTokens, promptTokens, err := calculateCompletionTokens(c.messages, c.appConfig)
+	if err != nil {
+		return "", err
+	}
+	c.messages = messages
+
+	var answer strings.Builder
+	var reported TokenUsage
+	err = c.client.CompletionStreamWithEngine(ctx, c.appConfig.OpenaiDeployment.String(), openAI.CompletionRequest{
+		Prompt:      messagesToPrompts(c.messages),
+		MaxTokens:   maxTokens,
+		Echo:        false,
+		N:           &c.appConfig.Choices,
+		Temperature: &c.appConfig.Temperature,
+	}, func(resp *openAI.CompletionResponse) {
+		if resp.Usage.TotalTokens > 0 {
+			reported = TokenUsage{PromptTokens: resp.Usage.PromptTokens, CompletionTokens: resp.Usage.CompletionTokens}
+		}
+		if len(resp.Choices) == 0 {
+			return
+		}
+		answer.WriteString(resp.Choices[0].Text)
+		onData(resp.Choices[0].Text)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	c.messages = append(c.messages, models.Message{Role: models.Assistant, Content: answer.String()})
+	c.record(c.appConfig.OpenaiDeployment, promptTokens, answer.String(), reported)
+	return answer.String(), nil
+}
+
 func (c *openAIChatClient) QueryOpenAI(ctx context.Context, prompt string) (string, error) {
+	if c.functions != nil {
+		return c.QueryOpenAIStream(ctx, prompt, func(string) {})
+	}
+
 	message := models.Message{
 		Role:    models.User,
 		Content: prompt,
 	}
 	c.messages = append(c.messages, message)
-	maxTokens, err := calculateChatTokens(c.messages, c.appConfig)
+	messages, maxTokens, promptTokens, err := calculateChatTokens(c.messages, c.appConfig, c.functions != nil)
 	if err != nil {
 		return "", err
 	}
+	c.messages = messages
 
 	resp, err := c.client.ChatCompletion(ctx, openAI.ChatCompletionRequest{
-		Model:       c.appConfig.OpenaiDeployment.String(),
+		Model:       c.appConfig.OpenaiDeploymentName,
 		Messages:    models.ConvertToOpenAIMessages(c.messages),
 		MaxTokens:   *maxTokens,
 		N:           c.appConfig.Choices,
@@ -172,18 +216,87 @@ func (c *openAIChatClient) QueryOpenAI(ctx context.Context, prompt string) (stri
 	}
 	c.messages = append(c.messages, message)
 
+	c.record(c.appConfig.OpenaiDeployment, promptTokens, resp.Choices[0].Message.Content, TokenUsage{
+		PromptTokens:     resp.Usage.PromptTokens,
+		CompletionTokens: resp.Usage.CompletionTokens,
+	})
 	return resp.Choices[0].Message.Content, nil
 }
 
+func (c *openAIChatClient) QueryOpenAIStream(ctx context.Context, prompt string, onData func(chunk string)) (string, error) {
+	message := models.Message{
+		Role:    models.User,
+		Content: prompt,
+	}
+	c.messages = append(c.messages, message)
+	messages, maxTokens, promptTokens, err := calculateChatTokens(c.messages, c.appConfig, c.functions != nil)
+	if err != nil {
+		return "", err
+	}
+	c.messages = messages
+
+	if c.functions != nil {
+		answer, reported, err := c.functions.query(ctx, functionChatRequest{
+			Model:       c.appConfig.OpenaiDeploymentName,
+			Messages:    models.ConvertToOpenAIMessages(c.messages),
+			MaxTokens:   *maxTokens,
+			N:           c.appConfig.Choices,
+			Temperature: &c.appConfig.Temperature,
+		}, onData)
+		if err == nil {
+			c.messages = append(c.messages, models.Message{Role: models.Assistant, Content: answer})
+			c.record(c.appConfig.OpenaiDeployment, promptTokens, answer, reported)
+			return answer, nil
+		}
+		if !c.functions.rejected(err) {
+			return "", err
+		}
+		// the rest of the session is asked as text too
+		c.functions = nil
+	}
+
+	var answer strings.Builder
+	var reported TokenUsage
+	err = c.client.ChatCompletionStream(ctx, openAI.ChatCompletionRequest{
+		Model:       c.appConfig.OpenaiDeploymentName,
+		Messages:    models.ConvertToOpenAIMessages(c.messages),
+		MaxTokens:   *maxTokens,
+		N:           c.appConfig.Choices,
+		Temperature: &c.appConfig.Temperature,
+	}, func(resp *openAI.ChatCompletionStreamResponse) {
+		if resp.Usage.TotalTokens > 0 {
+			reported = TokenUsage{PromptTokens: resp.Usage.PromptTokens, CompletionTokens: resp.Usage.CompletionTokens}
+		}
+		if len(resp.Choices) == 0 {
+			return
+		}
+		answer.WriteString(resp.Choices[0].Delta.Content)
+		onData(resp.Choices[0].Delta.Content)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	message = models.Message{
+		Role:    models.Assistant,
+		Content: answer.String(),
+	}
+	c.messages = append(c.messages, message)
+
+	c.record(c.appConfig.OpenaiDeployment, promptTokens, answer.String(), reported)
+	return answer.String(), nil
+}
+
 func (c *azureAICompletionClient) QueryOpenAI(ctx context.Context, prompt string) (string, error) {
-	c.prompts = append(c.prompts, prompt)
-	maxTokens, err := calculateCompletionTokens(c.prompts, c.appConfig)
+	c.messages = append(c.messages, models.Message{Role: models.User, Content: prompt})
+	messages, maxTokens, promptTokens, err := calculateCompletionTokens(c.messages, c.appConfig)
 	if err != nil {
 		return "", err
 	}
+	c.messages = messages
 
 	resp, err := c.client.Completion(ctx, azureOpenAI.CompletionRequest{
-		Prompt:      []string{strings.Join(c.prompts, "\n")},
+		Prompt:      []string{strings.Join(messagesToPrompts(c.messages), "\n")},
 		MaxTokens:   maxTokens,
 		Echo:        false,
 		N:           &c.appConfig.Choices,
@@ -197,19 +310,64 @@ func (c *azureAICompletionClient) QueryOpenAI(ctx context.Context, prompt string
 		return "", fmt.Errorf("expected choices to be 1 but received: %d", len(resp.Choices))
 	}
 
+	c.messages = append(c.messages, models.Message{Role: models.Assistant, Content: resp.Choices[0].Text})
+	c.record(c.appConfig.OpenaiDeployment, promptTokens, resp.Choices[0].Text, TokenUsage{
+		PromptTokens:     resp.Usage.PromptTokens,
+		CompletionTokens: resp.Usage.CompletionTokens,
+	})
 	return resp.Choices[0].Text, nil
 }
 
+func (c *azureAICompletionClient) QueryOpenAIStream(ctx context.Context, prompt string, onData func(chunk string)) (string, error) {
+	c.messages = append(c.messages, models.Message{Role: models.User, Content: prompt})
+	messages, maxTokens, promptTokens, err := calculateCompletionTokens(c.messages, c.appConfig)
+	if err != nil {
+		return "", err
+	}
+	c.messages = messages
+
+	var answer strings.Builder
+	var reported TokenUsage
+	err = c.client.CompletionStream(ctx, azureOpenAI.CompletionRequest{
+		Prompt:      []string{strings.Join(messagesToPrompts(c.messages), "\n")},
+		MaxTokens:   maxTokens,
+		Echo:        false,
+		N:           &c.appConfig.Choices,
+		Temperature: &c.appConfig.Temperature,
+	}, func(resp *azureOpenAI.CompletionResponse) {
+		if resp.Usage.TotalTokens > 0 {
+			reported = TokenUsage{PromptTokens: resp.Usage.PromptTokens, CompletionTokens: resp.Usage.CompletionTokens}
+		}
+		if len(resp.Choices) == 0 {
+			return
+		}
+		answer.WriteString(resp.Choices[0].Text)
+		onData(resp.Choices[0].Text)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	c.messages = append(c.messages, models.Message{Role: models.Assistant, Content: answer.String()})
+	c.record(c.appConfig.OpenaiDeployment, promptTokens, answer.String(), reported)
+	return answer.String(), nil
+}
+
 func (c *azureAIChatClient) QueryOpenAI(ctx context.Context, prompt string) (string, error) {
+	if c.functions != nil {
+		return c.QueryOpenAIStream(ctx, prompt, func(string) {})
+	}
+
 	message := models.Message{
 		Role:    models.User,
 		Content: prompt,
 	}
 	c.messages = append(c.messages, message)
-	maxTokens, err := calculateChatTokens(c.messages, c.appConfig)
+	messages, maxTokens, promptTokens, err := calculateChatTokens(c.messages, c.appConfig, c.functions != nil)
 	if err != nil {
 		return "", err
 	}
+	c.messages = messages
 
 	resp, err := c.client.ChatCompletion(ctx, azureOpenAI.ChatCompletionRequest{
 		Model:       c.appConfig.OpenaiDeployment.String(),
@@ -226,32 +384,130 @@ func (c *azureAIChatClient) QueryOpenAI(ctx context.Context, prompt string) (str
 		return "", fmt.Errorf("expected choices to be 1 but received: %d", len(resp.Choices))
 	}
 
+	message = models.Message{
+		Role:    models.Assistant,
+		Content: resp.Choices[0].Message.Content,
+	}
+	c.messages = append(c.messages, message)
+
+	c.record(c.appConfig.OpenaiDeployment, promptTokens, resp.Choices[0].Message.Content, TokenUsage{
+		PromptTokens:     resp.Usage.PromptTokens,
+		CompletionTokens: resp.Usage.CompletionTokens,
+	})
 	return resp.Choices[0].Message.Content, nil
 }
 
-func calculateMaxTokens(prompt string, deployment models.Deployment, userMaxTokens int) (*int, error) {
-	deploymentMaxTokens := deployment.MaxTokens()
-	var maxTokens int
-	if userMaxTokens == 0 || userMaxTokens > deploymentMaxTokens {
-		maxTokens = deploymentMaxTokens
-	} else {
-		maxTokens = userMaxTokens
+func (c *azureAIChatClient) QueryOpenAIStream(ctx context.Context, prompt string, onData func(chunk string)) (string, error) {
+	message := models.Message{
+		Role:    models.User,
+		Content: prompt,
 	}
-
-	encoder, err := gptEncoder.NewEncoder()
+	c.messages = append(c.messages, message)
+	messages, maxTokens, promptTokens, err := calculateChatTokens(c.messages, c.appConfig, c.functions != nil)
 	if err != nil {
-		return nil, err
+		return "", err
+	}
+	c.messages = messages
+
+	if c.functions != nil {
+		answer, reported, err := c.functions.query(ctx, functionChatRequest{
+			Messages:    models.ConvertToOpenAIMessages(c.messages),
+			MaxTokens:   *maxTokens,
+			N:           c.appConfig.Choices,
+			Temperature: &c.appConfig.Temperature,
+		}, onData)
+		if err == nil {
+			c.messages = append(c.messages, models.Message{Role: models.Assistant, Content: answer})
+			c.record(c.appConfig.OpenaiDeployment, promptTokens, answer, reported)
+			return answer, nil
+		}
+		if !c.functions.rejected(err) {
+			return "", err
+		}
+		// the rest of the session is asked as text too
+		c.functions = nil
 	}
 
-	totalTokens := reservedTokens
-	tokens, err := encoder.Encode(prompt)
+	var answer strings.Builder
+	var reported TokenUsage
+	err = c.chatCompletionStream(ctx, azureOpenAI.ChatCompletionRequest{
+		Model:       c.appConfig.OpenaiDeployment.String(),
+		Messages:    models.ConvertToAzureOpenAIMessages(c.messages),
+		MaxTokens:   *maxTokens,
+		N:           c.appConfig.Choices,
+		Temperature: &c.appConfig.Temperature,
+	}, func(resp *chatCompletionStreamResponse) {
+		if resp.Usage != nil {
+			reported = resp.Usage.tokenUsage()
+		}
+		if len(resp.Choices) == 0 {
+			return
+		}
+		answer.WriteString(resp.Choices[0].Delta.Content)
+		onData(resp.Choices[0].Delta.Content)
+	})
 	if err != nil {
-		return nil, err
+		return "", err
+	}
+
+	message = models.Message{
+		Role:    models.Assistant,
+		Content: answer.String(),
 	}
-	totalTokens += len(tokens)
+	c.messages = append(c.messages, message)
 
-	remainingTokens := maxTokens - totalTokens
-	return &remainingTokens, nil
+	c.record(c.appConfig.OpenaiDeployment, promptTokens, answer.String(), reported)
+	return answer.String(), nil
+}
+
+func (c *openAICompletionClient) History() []models.Message {
+	return append([]models.Message{}, c.messages...)
+}
+
+func (c *openAICompletionClient) SetHistory(messages []models.Message) {
+	c.messages = append([]models.Message{}, messages...)
+}
+
+func (c *openAIChatClient) History() []models.Message {
+	return append([]models.Message{}, c.messages...)
+}
+
+func (c *openAIChatClient) SetHistory(messages []models.Message) {
+	c.messages = append([]models.Message{}, messages...)
+}
+
+func (c *azureAICompletionClient) History() []models.Message {
+	return append([]models.Message{}, c.messages...)
+}
+
+func (c *azureAICompletionClient) SetHistory(messages []models.Message) {
+	c.messages = append([]models.Message{}, messages...)
+}
+
+func (c *azureAIChatClient) History() []models.Message {
+	return append([]models.Message{}, c.messages...)
+}
+
+func (c *azureAIChatClient) SetHistory(messages []models.Message) {
+	c.messages = append([]models.Message{}, messages...)
+}
+
+// promptsToMessages represents the initial prompts of a completion model as
+// user messages so both kinds of clients share the same history format.
+func promptsToMessages(prompts []string) []models.Message {
+	messages := []models.Message{}
+	for _, prompt := range prompts {
+		messages = append(messages, models.Message{Role: models.User, Content: prompt})
+	}
+	return messages
+}
+
+func messagesToPrompts(messages []models.Message) []string {
+	prompts := []string{}
+	for _, message := range messages {
+		prompts = append(prompts, message.Content)
+	}
+	return prompts
 }
 
 func initializeMessages(chatContext string) []models.Message {
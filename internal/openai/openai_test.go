@@ -1,21 +1,46 @@
 package openai
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
+	openAI "github.com/PullRequestInc/go-gpt3"
+	"github.com/afrancoc2000/application-helper-ai/internal/auth"
 	"github.com/afrancoc2000/application-helper-ai/internal/config"
 	"github.com/afrancoc2000/application-helper-ai/internal/models"
+	"github.com/afrancoc2000/application-helper-ai/internal/stubserver"
+	"github.com/afrancoc2000/application-helper-ai/internal/tokenizer"
 	. "github.com/smartystreets/goconvey/convey"
+	azureOpenAI "github.com/sozercan/kubectl-ai/pkg/gpt3"
 )
 
+// offlineTokenizers keeps the tokenizer ranks of the test in a temporary
+// directory and never downloads them, the GPT-3 encoder counts instead.
+func offlineTokenizers(t *testing.T) {
+	t.Setenv(tokenizer.CacheDirVariable, t.TempDir())
+	t.Cleanup(tokenizer.SetDownloader(func(url string) ([]byte, error) {
+		return nil, errors.New("the tests don't download tokenizers")
+	}))
+}
+
 func TestOpenAI(t *testing.T) {
+	offlineTokenizers(t)
+
 	Convey("AIClient", t, func() {
 
+		gpt4, _ := models.DeploymentFromName("gpt-4-0314")
+		textDavinci, _ := models.DeploymentFromName("text-davinci-003")
+
 		appConfig := config.AppConfig{
 			OpenaiApiKey:         "123456",
 			OpenaiDeploymentName: "gpt-4-0314",
-			OpenaiDeployment:     models.Gpt4_0314,
+			OpenaiDeployment:     gpt4,
 			AzureOpenaiEndpoint:  "https://devsquad-openai-lab.openai.azure.com/",
 			MaxTokens:            1000,
 			SkipConfirmation:     true,
@@ -26,7 +51,7 @@ func TestOpenAI(t *testing.T) {
 
 		Convey("NewAIClient Azure Completion", func() {
 			appConfig.OpenaiDeploymentName = "text-davinci-003"
-			appConfig.OpenaiDeployment = models.TextDavinci003
+			appConfig.OpenaiDeployment = textDavinci
 
 			client, err := NewAIClient(appConfig)
 			So(err, ShouldBeNil)
@@ -35,7 +60,7 @@ func TestOpenAI(t *testing.T) {
 
 			So(ok, ShouldEqual, true)
 			So(completionClient.appConfig, ShouldResemble, appConfig)
-			So(len(completionClient.prompts), ShouldEqual, 4)
+			So(len(completionClient.messages), ShouldEqual, 4)
 		})
 
 		Convey("NewAIClient Azure Chat", func() {
@@ -51,7 +76,7 @@ func TestOpenAI(t *testing.T) {
 
 		Convey("NewAIClient OpenAI Completion", func() {
 			appConfig.OpenaiDeploymentName = "text-davinci-003"
-			appConfig.OpenaiDeployment = models.TextDavinci003
+			appConfig.OpenaiDeployment = textDavinci
 			appConfig.AzureOpenaiEndpoint = ""
 
 			client, err := NewAIClient(appConfig)
@@ -61,7 +86,7 @@ func TestOpenAI(t *testing.T) {
 
 			So(ok, ShouldEqual, true)
 			So(completionClient.appConfig, ShouldResemble, appConfig)
-			So(len(completionClient.prompts), ShouldEqual, 4)
+			So(len(completionClient.messages), ShouldEqual, 4)
 		})
 
 		Convey("NewAIClient OpenAI Chat", func() {
@@ -77,25 +102,429 @@ func TestOpenAI(t *testing.T) {
 			So(len(chatClient.messages), ShouldEqual, 3)
 		})
 
-		Convey("calculateMaxTokens no user tokens", func() {
-			tokens, err := calculateMaxTokens("hello", models.Gpt4_0314, 0)
+		Convey("NewAIClient Ollama", func() {
+			appConfig.Provider = config.OllamaProvider
+			appConfig.OpenaiDeploymentName = "llama2"
+			appConfig.OpenaiDeployment = models.LocalDeployment("llama2")
 
+			client, err := NewAIClient(appConfig)
 			So(err, ShouldBeNil)
-			So(*tokens, ShouldEqual, 7991)
+
+			chatClient, ok := client.(*openAIChatClient)
+
+			So(ok, ShouldEqual, true)
+			So(chatClient.appConfig, ShouldResemble, appConfig)
+			So(len(chatClient.messages), ShouldEqual, 3)
+		})
+
+		Convey("NewAIClient unknown provider", func() {
+			appConfig.Provider = "bard"
+
+			_, err := NewAIClient(appConfig)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "azure, ollama, openai")
 		})
 
-		Convey("calculateMaxTokens good user tokens", func() {
-			tokens, err := calculateMaxTokens("hello", models.Gpt4_0314, 1000)
+		Convey("RegisterProvider", func() {
+			RegisterProvider("test", func(appConfig config.AppConfig) (AIClient, error) {
+				return &openAIChatClient{appConfig: appConfig}, nil
+			}, config.ProviderCapabilities{AnyModel: true})
+			defer delete(providers, "test")
+			appConfig.Provider = "test"
 
+			client, err := NewAIClient(appConfig)
 			So(err, ShouldBeNil)
-			So(*tokens, ShouldEqual, 799)
+			So(client.(*openAIChatClient).appConfig, ShouldResemble, appConfig)
+			So(Providers(), ShouldResemble, []string{"azure", "ollama", "openai", "test"})
+			So(appConfig.Capabilities(), ShouldResemble, config.ProviderCapabilities{AnyModel: true})
 		})
 
-		Convey("calculateMaxTokens bad user tokens", func() {
-			tokens, err := calculateMaxTokens("hello", models.Gpt4_0314, 10000)
+		Convey("History Chat", func() {
+			client, err := NewAIClient(appConfig)
+			So(err, ShouldBeNil)
+
+			history := client.History()
+			So(len(history), ShouldEqual, 3)
+			So(history[0].Role, ShouldEqual, models.System)
+
+			history = append(history, models.Message{Role: models.User, Content: "Add a css file"})
+			client.SetHistory(history)
+			So(client.History(), ShouldResemble, history)
+			So(len(client.(*azureAIChatClient).messages), ShouldEqual, 4)
+		})
+
+		Convey("History Completion", func() {
+			appConfig.OpenaiDeploymentName = "text-davinci-003"
+			appConfig.OpenaiDeployment = textDavinci
+
+			client, err := NewAIClient(appConfig)
+			So(err, ShouldBeNil)
+
+			history := client.History()
+			So(len(history), ShouldEqual, 4)
+			So(history[1].Content, ShouldEqual, "You create html applications")
+
+			client.SetHistory(history[:2])
+			So(messagesToPrompts(client.(*azureAICompletionClient).messages), ShouldResemble, []string{baseContext, "You create html applications"})
+		})
+
+		Convey("QueryOpenAIStream Azure Chat", func() {
+			var path, apiKey string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				path = r.URL.Path
+				apiKey = r.Header.Get("api-key")
+				fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"role\":\"assistant\"}}]}\n\n")
+				fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"[{\\\"fileName\\\"\"}}]}\n\n")
+				fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\":\\\"a\\\"}]\"}}]}\n\n")
+				fmt.Fprint(w, "data: [DONE]\n\n")
+			}))
+			defer server.Close()
+			appConfig.AzureOpenaiEndpoint = server.URL + "/"
+
+			client, err := NewAIClient(appConfig)
+			So(err, ShouldBeNil)
+
+			chunks := []string{}
+			answer, err := client.QueryOpenAIStream(context.Background(), "Create an html page", func(chunk string) {
+				chunks = append(chunks, chunk)
+			})
+
+			So(err, ShouldBeNil)
+			So(path, ShouldEqual, "/openai/deployments/gpt-4-0314/chat/completions")
+			So(apiKey, ShouldEqual, "123456")
+			So(answer, ShouldEqual, `[{"fileName":"a"}]`)
+			So(chunks, ShouldResemble, []string{"", `[{"fileName"`, `:"a"}]`})
+
+			usage := client.LastUsage()
+			So(usage.Estimated, ShouldBeTrue)
+			So(usage.PromptTokens, ShouldBeGreaterThan, 0)
+			So(usage.CompletionTokens, ShouldBeGreaterThan, 0)
+
+			chatClient := client.(*azureAIChatClient)
+			So(len(chatClient.messages), ShouldEqual, 5)
+			So(chatClient.messages[4].Content, ShouldEqual, answer)
+		})
+
+		Convey("QueryOpenAI Azure Chat keeps the answer in the history", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, chatAnswer)
+			}))
+			defer server.Close()
+			appConfig.AzureOpenaiEndpoint = server.URL + "/"
+
+			client, err := NewAIClient(appConfig)
+			So(err, ShouldBeNil)
+
+			answer, err := client.QueryOpenAI(context.Background(), "Fix the answer")
+			So(err, ShouldBeNil)
+			So(answer, ShouldEqual, "[]")
+
+			history := client.History()
+			So(history, ShouldHaveLength, 5)
+			So(history[3], ShouldResemble, models.Message{Role: models.User, Content: "Fix the answer"})
+			So(history[4], ShouldResemble, models.Message{Role: models.Assistant, Content: "[]"})
+		})
+
+		Convey("QueryOpenAIStream OpenAI Chat with functions", func() {
+			var path, authorization string
+			var request functionChatRequest
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				path = r.URL.Path
+				authorization = r.Header.Get("Authorization")
+				_ = json.NewDecoder(r.Body).Decode(&request)
+				fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"role\":\"assistant\",\"function_call\":{\"name\":\"create_files\",\"arguments\":\"\"}}}]}\n\n")
+				fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"function_call\":{\"arguments\":\"{\\\"files\\\":[{\\\"fileName\\\"\"}}}]}\n\n")
+				fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"function_call\":{\"arguments\":\":\\\"a\\\"}]}\"}}}]}\n\n")
+				fmt.Fprint(w, "data: {\"choices\":[],\"usage\":{\"prompt_tokens\":120,\"completion_tokens\":12,\"total_tokens\":132}}\n\n")
+				fmt.Fprint(w, "data: [DONE]\n\n")
+			}))
+			defer server.Close()
+			gpt4Functions, _ := models.DeploymentFromName("gpt-4-0613")
+			appConfig.OpenaiDeploymentName = "gpt-4-0613"
+			appConfig.OpenaiDeployment = gpt4Functions
+			appConfig.AzureOpenaiEndpoint = ""
+			appConfig.BaseURL = server.URL + "/v1"
+			appConfig.StructuredOutput = true
+
+			client, err := NewAIClient(appConfig)
+			So(err, ShouldBeNil)
+
+			chunks := []string{}
+			answer, err := client.QueryOpenAIStream(context.Background(), "Create an html page", func(chunk string) {
+				chunks = append(chunks, chunk)
+			})
+
+			So(err, ShouldBeNil)
+			So(path, ShouldEqual, "/v1/chat/completions")
+			So(authorization, ShouldEqual, "Bearer 123456")
+			So(request.Model, ShouldEqual, "gpt-4-0613")
+			So(request.FunctionCall["name"], ShouldEqual, filesFunctionName)
+			So(request.Functions[0].Name, ShouldEqual, filesFunctionName)
+			So(answer, ShouldEqual, `[{"fileName":"a"}]`)
+			So(chunks, ShouldResemble, []string{`{"files":[{"fileName"`, `:"a"}]}`})
+
+			So(client.LastUsage(), ShouldResemble, TokenUsage{PromptTokens: 120, CompletionTokens: 12})
+
+			chatClient := client.(*openAIChatClient)
+			So(chatClient.messages[len(chatClient.messages)-1].Content, ShouldEqual, answer)
+		})
+
+		Convey("NewAIClient functions", func() {
+			gpt4Functions, _ := models.DeploymentFromName("gpt-4-0613")
+			appConfig.OpenaiDeployment = gpt4Functions
+			appConfig.StructuredOutput = true
+
+			client, err := NewAIClient(appConfig)
+			So(err, ShouldBeNil)
+			So(client.(*azureAIChatClient).functions.url, ShouldEqual,
+				"https://devsquad-openai-lab.openai.azure.com/openai/deployments/gpt-4-0613/chat/completions?api-version="+azureFunctionsAPIVersion)
 
+			appConfig.StructuredOutput = false
+			client, err = NewAIClient(appConfig)
 			So(err, ShouldBeNil)
-			So(*tokens, ShouldEqual, 7991)
+			So(client.(*azureAIChatClient).functions, ShouldBeNil)
+
+			appConfig.StructuredOutput = true
+			appConfig.OpenaiDeployment = gpt4
+			client, err = NewAIClient(appConfig)
+			So(err, ShouldBeNil)
+			So(client.(*azureAIChatClient).functions, ShouldBeNil)
+		})
+
+		Convey("QueryOpenAIStream Azure Chat falls back to text when functions are rejected", func() {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				request := map[string]json.RawMessage{}
+				_ = json.NewDecoder(r.Body).Decode(&request)
+				if _, ok := request["functions"]; ok {
+					w.WriteHeader(http.StatusBadRequest)
+					fmt.Fprint(w, `{"error":{"code":"BadRequest","message":"Unrecognized request argument supplied: functions"}}`)
+					return
+				}
+				fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{\"content\":\"[]\"}}]}\n\n")
+				fmt.Fprint(w, "data: [DONE]\n\n")
+			}))
+			defer server.Close()
+			gpt4Functions, _ := models.DeploymentFromName("gpt-4-0613")
+			appConfig.OpenaiDeployment = gpt4Functions
+			appConfig.AzureOpenaiEndpoint = server.URL + "/"
+			appConfig.StructuredOutput = true
+
+			client, err := NewAIClient(appConfig)
+			So(err, ShouldBeNil)
+			chatClient := client.(*azureAIChatClient)
+			var out strings.Builder
+			chatClient.functions.out = &out
+
+			answer, err := client.QueryOpenAIStream(context.Background(), "Create an html page", func(chunk string) {})
+
+			So(err, ShouldBeNil)
+			So(answer, ShouldEqual, "[]")
+			So(requests, ShouldEqual, 2)
+			So(out.String(), ShouldContainSubstring, "doesn't support functions")
+			So(chatClient.functions, ShouldBeNil)
+			So(chatClient.messages, ShouldHaveLength, 5)
+			So(chatClient.messages[3], ShouldResemble, models.Message{Role: models.User, Content: "Create an html page"})
+			So(chatClient.messages[4], ShouldResemble, models.Message{Role: models.Assistant, Content: "[]"})
+		})
+
+		Convey("QueryOpenAIStream Azure Chat returns the other errors of functions", func() {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				w.WriteHeader(http.StatusBadRequest)
+				fmt.Fprint(w, `{"error":{"code":"context_length_exceeded","message":"This model's maximum context length is 8192 tokens. However, you requested 9000 tokens (8000 in the messages, 200 in the functions, and 800 in the completion)."}}`)
+			}))
+			defer server.Close()
+			gpt4Functions, _ := models.DeploymentFromName("gpt-4-0613")
+			appConfig.OpenaiDeployment = gpt4Functions
+			appConfig.AzureOpenaiEndpoint = server.URL + "/"
+			appConfig.StructuredOutput = true
+
+			client, err := NewAIClient(appConfig)
+			So(err, ShouldBeNil)
+			chatClient := client.(*azureAIChatClient)
+			var out strings.Builder
+			chatClient.functions.out = &out
+
+			_, err = client.QueryOpenAIStream(context.Background(), "Create an html page", func(chunk string) {})
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "maximum context length")
+			So(requests, ShouldEqual, 1)
+			So(out.String(), ShouldBeEmpty)
+			So(chatClient.functions, ShouldNotBeNil)
+		})
+
+		Convey("functionsClient rejected", func() {
+			functions := &functionsClient{out: &strings.Builder{}}
+			So(functions.rejected(azureOpenAI.APIError{StatusCode: 400, Message: "Unrecognized request argument supplied: functions"}), ShouldBeTrue)
+			So(functions.rejected(openAI.APIError{StatusCode: 400, Message: "Additional properties are not allowed ('function_call' was unexpected)"}), ShouldBeTrue)
+			So(functions.rejected(openAI.APIError{StatusCode: 400, Message: "max_tokens must be at least 1"}), ShouldBeFalse)
+			So(functions.rejected(azureOpenAI.APIError{StatusCode: 400, Type: "content_filter", Message: "The response was filtered"}), ShouldBeFalse)
+			So(functions.rejected(openAI.APIError{StatusCode: 500, Message: "Unrecognized request argument supplied: functions"}), ShouldBeFalse)
+		})
+
+		Convey("NewAIClient Azure managed identity with a proxy", func() {
+			tokens := 0
+			identity := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tokens++
+				fmt.Fprint(w, `{"access_token":"identity-token","expires_in":"3600","token_type":"Bearer"}`)
+			}))
+			defer identity.Close()
+			proxy := stubserver.New()
+			defer proxy.Close()
+			proxy.APIKey = "identity-token"
+			proxy.Enqueue(stubserver.Answer("[]"))
+
+			// only the proxy can reach the endpoint, the identity is local
+			appConfig.AzureOpenaiEndpoint = "http://gateway.invalid"
+			appConfig.Proxy = proxy.URL
+			appConfig.AzureAuth = auth.Settings{Method: auth.ManagedIdentityMethod, IdentityEndpoint: identity.URL}
+
+			client, err := NewAIClient(appConfig)
+			So(err, ShouldBeNil)
+			answer, err := client.QueryOpenAI(context.Background(), "Create an html page")
+
+			So(err, ShouldBeNil)
+			So(answer, ShouldEqual, "[]")
+			So(tokens, ShouldEqual, 1)
+			So(proxy.Requests(), ShouldHaveLength, 1)
+			So(proxy.Requests()[0].Host, ShouldEqual, "gateway.invalid")
+			So(proxy.Requests()[0].Header.Get("Authorization"), ShouldEqual, "Bearer identity-token")
+		})
+
+		Convey("isLocalHost", func() {
+			So(isLocalHost("169.254.169.254"), ShouldBeTrue)
+			So(isLocalHost("127.0.0.1"), ShouldBeTrue)
+			So(isLocalHost("::1"), ShouldBeTrue)
+			So(isLocalHost("localhost"), ShouldBeTrue)
+			So(isLocalHost("gateway.example.com"), ShouldBeFalse)
+			So(isLocalHost("10.0.0.1"), ShouldBeFalse)
+		})
+
+		Convey("filesFromArguments", func() {
+			So(filesFromArguments(`{"files":[{"fileName":"a"}]}`), ShouldEqual, `[{"fileName":"a"}]`)
+			So(filesFromArguments(`{"files":[{"fileName":"a"`), ShouldEqual, `{"files":[{"fileName":"a"`)
+		})
+
+		Convey("remainingTokens no user tokens", func() {
+			So(*remainingTokens(1, gpt4, 0), ShouldEqual, 7991)
+		})
+
+		Convey("remainingTokens good user tokens", func() {
+			So(*remainingTokens(1, gpt4, 1000), ShouldEqual, 799)
+		})
+
+		Convey("remainingTokens max output tokens", func() {
+			gpt4Turbo, _ := models.DeploymentFromName("gpt-4-turbo")
+			So(*remainingTokens(1, gpt4Turbo, 0), ShouldEqual, 4096)
+		})
+
+		Convey("remainingTokens bad user tokens", func() {
+			So(*remainingTokens(1, gpt4, 10000), ShouldEqual, 7991)
+		})
+
+		Convey("countTokens", func() {
+			tokens, err := countTokens(gpt4, "hello")
+			So(err, ShouldBeNil)
+			So(tokens, ShouldEqual, 1)
+		})
+
+		Convey("countMessages", func() {
+			messages := []models.Message{
+				{Role: models.System, Content: "hello"},
+				{Role: models.User, Content: "hello"},
+			}
+			tokens, err := countMessages(gpt4, messages)
+			So(err, ShouldBeNil)
+			// role and content of each message, the message format and the reply priming
+			So(tokens, ShouldEqual, 2*(1+1+tokensPerMessage)+tokensPerReply)
+
+			legacy, _ := models.DeploymentFromName("gpt-35-turbo-0301")
+			tokens, err = countMessages(legacy, messages)
+			So(err, ShouldBeNil)
+			So(tokens, ShouldEqual, 2*(1+1+legacyTokensPerMessage)+tokensPerReply)
+		})
+
+		Convey("LastUsage", func() {
+			recorder := &usageRecorder{}
+			So(recorder.LastUsage(), ShouldResemble, TokenUsage{})
+			recorder.record(gpt4, 20, "hello", TokenUsage{})
+			So(recorder.LastUsage(), ShouldResemble, TokenUsage{PromptTokens: 20, CompletionTokens: 1, Estimated: true})
+
+			recorder.record(gpt4, 20, "hello", TokenUsage{PromptTokens: 18, CompletionTokens: 2})
+			So(recorder.LastUsage(), ShouldResemble, TokenUsage{PromptTokens: 18, CompletionTokens: 2})
+		})
+
+		Convey("fitHistory", func() {
+			appConfig.OpenaiDeployment = models.LocalDeployment("llama2")
+			appConfig.MaxTokens = 0
+			answer := `[{"fileName":"index.html","filePath":"./src","fileContent":"` + strings.Repeat("file content ", 300) + `"}]`
+			count := func(messages []models.Message) (int, error) {
+				content, err := json.Marshal(messages)
+				if err != nil {
+					return 0, err
+				}
+				return countTokens(appConfig.OpenaiDeployment, string(content))
+			}
+			conversation := func(turns int) []models.Message {
+				messages := initializeMessages("")
+				for turn := 0; turn < turns; turn++ {
+					messages = append(messages,
+						models.Message{Role: models.User, Content: fmt.Sprintf("prompt %d", turn)},
+						models.Message{Role: models.Assistant, Content: answer})
+				}
+				return append(messages, models.Message{Role: models.User, Content: "last prompt"})
+			}
+
+			Convey("Keeps a conversation that fits", func() {
+				messages := conversation(1)
+				fitted, maxTokens, _, err := fitHistory(messages, 3, appConfig, count)
+
+				So(err, ShouldBeNil)
+				So(fitted, ShouldResemble, messages)
+				So(*maxTokens, ShouldBeGreaterThanOrEqualTo, minCompletionTokens)
+			})
+
+			Convey("Drops the oldest turns keeping their prompts and files", func() {
+				messages := conversation(6)
+				fitted, maxTokens, _, err := fitHistory(messages, 3, appConfig, count)
+
+				So(err, ShouldBeNil)
+				So(*maxTokens, ShouldBeGreaterThanOrEqualTo, minCompletionTokens)
+				So(fitted[:3], ShouldResemble, messages[:3])
+				So(fitted[len(fitted)-1].Content, ShouldEqual, "last prompt")
+				So(fitted[3].Content, ShouldStartWith, droppedPrefix)
+				So(fitted[3].Content, ShouldContainSubstring, "- prompt 0 (files: src/index.html)\n- prompt 1 (files: src/index.html)")
+				So(len(fitted), ShouldBeLessThan, len(messages))
+
+				// fitting again keeps a single list of dropped turns
+				fitted = append(fitted, models.Message{Role: models.Assistant, Content: answer}, models.Message{Role: models.User, Content: "another prompt"})
+				fitted, _, _, err = fitHistory(fitted, 3, appConfig, count)
+				So(err, ShouldBeNil)
+				lists := 0
+				for _, message := range fitted {
+					if isDroppedTurns(message) {
+						lists++
+					}
+				}
+				So(lists, ShouldEqual, 1)
+			})
+
+			Convey("Fails when the prompt alone doesn't fit", func() {
+				messages := append(initializeMessages(""), models.Message{Role: models.User, Content: strings.Repeat(answer, 6)})
+				_, _, _, err := fitHistory(messages, 3, appConfig, count)
+
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "bigger context window")
+			})
+
+			Convey("Uses a smaller minimum with a small max tokens", func() {
+				So(minimumCompletionTokens(gpt4, 0), ShouldEqual, minCompletionTokens)
+				So(minimumCompletionTokens(gpt4, 1000), ShouldEqual, 250)
+			})
 		})
 
 		Convey("initializeMessages", func() {
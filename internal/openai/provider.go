@@ -0,0 +1,174 @@
+package openai
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	openAI "github.com/PullRequestInc/go-gpt3"
+	"github.com/afrancoc2000/application-helper-ai/internal/auth"
+	"github.com/afrancoc2000/application-helper-ai/internal/config"
+	azureOpenAI "github.com/sozercan/kubectl-ai/pkg/gpt3"
+)
+
+const defaultOllamaBaseURL = "http://localhost:11434/v1"
+
+// ProviderFactory creates the AIClient of a provider for the given configuration.
+type ProviderFactory func(appConfig config.AppConfig) (AIClient, error)
+
+var providers = map[string]ProviderFactory{}
+
+// the capabilities of the built-in providers are declared by the config package
+func init() {
+	providers[config.OpenAIProvider] = newOpenAIClient
+	providers[config.AzureProvider] = newAzureClient
+	providers[config.OllamaProvider] = newOllamaClient
+}
+
+// RegisterProvider makes a provider available to NewAIClient under the given
+// name, registering a name twice replaces the previous factory. The
+// capabilities tell the configuration whether the provider needs an API key
+// and whether it accepts models that aren't in the catalog.
+func RegisterProvider(name string, factory ProviderFactory, capabilities config.ProviderCapabilities) {
+	providers[name] = factory
+	config.RegisterProvider(name, capabilities)
+}
+
+// Providers returns the names of the registered providers in alphabetical order.
+func Providers() []string {
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewAIClient creates the client of the configured provider, retrying the
+// failed queries and recording them in a cassette when configured. When a
+// cassette is replayed no provider is used.
+func NewAIClient(appConfig config.AppConfig) (AIClient, error) {
+	if appConfig.ReplayCassette != "" {
+		return newReplayClient(appConfig)
+	}
+
+	name := appConfig.ProviderName()
+	factory, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("The specified provider %q does not exist, please choose one of these options: %s", name, strings.Join(Providers(), ", "))
+	}
+
+	client, err := factory(appConfig)
+	if err != nil {
+		return nil, err
+	}
+	if appConfig.MaxRetries > 0 {
+		client = newRetryingClient(client, appConfig)
+	}
+	if appConfig.RecordCassette != "" {
+		client = newRecordingClient(client, appConfig)
+	}
+	return client, nil
+}
+
+func newOpenAIClient(appConfig config.AppConfig) (AIClient, error) {
+	httpClient, err := newHTTPClient(appConfig, openAITimeout)
+	if err != nil {
+		return nil, err
+	}
+	options := []openAI.ClientOption{openAI.WithHTTPClient(httpClient)}
+	if appConfig.BaseURL != "" {
+		options = append(options, openAI.WithBaseURL(appConfig.BaseURL))
+	}
+	client := openAI.NewClient(appConfig.OpenaiApiKey, options...)
+
+	if isChat(appConfig.OpenaiDeployment) {
+		messages := initializeMessages(appConfig.ChatContext)
+		chatClient := &openAIChatClient{client: client, appConfig: appConfig, messages: messages}
+		if useFunctions(appConfig) {
+			chatClient.functions = newOpenAIFunctionsClient(httpClient, appConfig.BaseURL, appConfig.OpenaiApiKey)
+		}
+		return chatClient, nil
+	}
+
+	messages := promptsToMessages(initializePrompts(appConfig.ChatContext))
+	return &openAICompletionClient{client: client, appConfig: appConfig, messages: messages}, nil
+}
+
+func newAzureClient(appConfig config.AppConfig) (AIClient, error) {
+	if appConfig.AzureOpenaiEndpoint == "" {
+		return nil, fmt.Errorf("%s must be set to use the %s provider", config.AzureOpenaiEndpointLabel, config.AzureProvider)
+	}
+
+	httpClient, err := newHTTPClient(appConfig, azureTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if appConfig.AzureAuth.UsesTokens() {
+		// the tokens are requested through the same proxy, trusting the same
+		// certificates, but the extra headers are only meant for the API. The
+		// proxy is skipped for the local managed identity endpoint.
+		tokenConfig := appConfig
+		tokenConfig.Headers = nil
+		tokenClient, err := newHTTPClient(tokenConfig, azureTimeout)
+		if err != nil {
+			return nil, err
+		}
+		tokens, err := auth.NewTokenProvider(appConfig.AzureAuth, tokenClient)
+		if err != nil {
+			return nil, err
+		}
+		httpClient = &http.Client{
+			Timeout:   httpClient.Timeout,
+			Transport: &auth.Transport{Base: httpClient.Transport, Tokens: tokens},
+		}
+	}
+	client, err := azureOpenAI.NewClient(
+		appConfig.AzureOpenaiEndpoint,
+		appConfig.OpenaiApiKey,
+		appConfig.OpenaiDeployment.String(),
+		azureOpenAI.WithHTTPClient(httpClient))
+	if err != nil {
+		return nil, err
+	}
+
+	if isChat(appConfig.OpenaiDeployment) {
+		messages := initializeMessages(appConfig.ChatContext)
+		chatClient := &azureAIChatClient{client: client, httpClient: httpClient, appConfig: appConfig, messages: messages}
+		if useFunctions(appConfig) {
+			chatClient.functions = newAzureFunctionsClient(httpClient, appConfig.AzureOpenaiEndpoint, appConfig.OpenaiDeployment.String(), appConfig.OpenaiApiKey)
+		}
+		return chatClient, nil
+	}
+
+	messages := promptsToMessages(initializePrompts(appConfig.ChatContext))
+	return &azureAICompletionClient{client: client, appConfig: appConfig, messages: messages}, nil
+}
+
+// useFunctions returns whether the files are requested as function arguments,
+// models without function calling get them as text.
+func useFunctions(appConfig config.AppConfig) bool {
+	return appConfig.StructuredOutput && appConfig.OpenaiDeployment.SupportsFunctions()
+}
+
+// newOllamaClient talks to a local server exposing the OpenAI chat API, like
+// Ollama or the llama.cpp server. Only the chat endpoint is used because these
+// servers don't implement the engines based completion endpoint.
+func newOllamaClient(appConfig config.AppConfig) (AIClient, error) {
+	baseURL := appConfig.BaseURL
+	if baseURL == "" {
+		baseURL = defaultOllamaBaseURL
+	}
+	httpClient, err := newHTTPClient(appConfig, localTimeout)
+	if err != nil {
+		return nil, err
+	}
+	client := openAI.NewClient(
+		appConfig.OpenaiApiKey,
+		openAI.WithBaseURL(strings.TrimSuffix(baseURL, "/")),
+		openAI.WithHTTPClient(httpClient))
+
+	messages := initializeMessages(appConfig.ChatContext)
+	return &openAIChatClient{client: client, appConfig: appConfig, messages: messages}, nil
+}
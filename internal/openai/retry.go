@@ -0,0 +1,243 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	openAI "github.com/PullRequestInc/go-gpt3"
+	"github.com/afrancoc2000/application-helper-ai/internal/config"
+	azureOpenAI "github.com/sozercan/kubectl-ai/pkg/gpt3"
+)
+
+// insufficientQuota is the type of the 429 errors OpenAI returns when the
+// account ran out of credit, retrying them doesn't help.
+const insufficientQuota = "insufficient_quota"
+
+var retryableStatusCodes = map[int]bool{
+	http.StatusRequestTimeout:      true,
+	http.StatusConflict:            true,
+	http.StatusTooManyRequests:     true,
+	http.StatusInternalServerError: true,
+	http.StatusBadGateway:          true,
+	http.StatusServiceUnavailable:  true,
+	http.StatusGatewayTimeout:      true,
+}
+
+// retryingClient retries the queries of a client that fail with a rate limit,
+// a server error or a network error, waiting longer after every attempt. The
+// conversation is restored before every retry so the prompt is only sent
+// once, and a stream is only retried if nothing was received yet because the
+// user already saw the chunks.
+type retryingClient struct {
+	AIClient
+	maxRetries int
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+	out        io.Writer
+	// sleep and jitter are replaced in tests
+	sleep  func(ctx context.Context, delay time.Duration) error
+	jitter func(delay time.Duration) time.Duration
+}
+
+func newRetryingClient(client AIClient, appConfig config.AppConfig) *retryingClient {
+	return &retryingClient{
+		AIClient:   client,
+		maxRetries: appConfig.MaxRetries,
+		baseDelay:  appConfig.RetryDelay,
+		maxDelay:   appConfig.RetryMaxDelay,
+		out:        os.Stderr,
+		sleep:      sleep,
+		jitter:     equalJitter,
+	}
+}
+
+func (c *retryingClient) QueryOpenAI(ctx context.Context, prompt string) (string, error) {
+	return c.retry(ctx, func(ctx context.Context) (string, error) {
+		return c.AIClient.QueryOpenAI(ctx, prompt)
+	}, nil)
+}
+
+func (c *retryingClient) QueryOpenAIStream(ctx context.Context, prompt string, onData func(chunk string)) (string, error) {
+	streamed := false
+	return c.retry(ctx, func(ctx context.Context) (string, error) {
+		return c.AIClient.QueryOpenAIStream(ctx, prompt, func(chunk string) {
+			if chunk != "" {
+				streamed = true
+			}
+			onData(chunk)
+		})
+	}, func() bool { return streamed })
+}
+
+func (c *retryingClient) retry(ctx context.Context, query func(ctx context.Context) (string, error), streamed func() bool) (string, error) {
+	history := c.AIClient.History()
+	for retry := 0; ; retry++ {
+		hint := &retryAfterHint{}
+		answer, err := query(context.WithValue(ctx, retryAfterKey{}, hint))
+		if err == nil {
+			return answer, nil
+		}
+
+		// a failed query never leaves its prompt in the conversation
+		c.AIClient.SetHistory(history)
+		if retry >= c.maxRetries || ctx.Err() != nil || !isRetryable(err) || (streamed != nil && streamed()) {
+			return "", err
+		}
+
+		delay := c.jitter(backoff(retry, c.baseDelay, c.maxDelay))
+		if after, ok := hint.get(); ok {
+			if after > c.maxDelay {
+				return "", fmt.Errorf("%w, the API asked to wait %s before retrying, more than the %s allowed", err, after, c.maxDelay)
+			}
+			delay = after
+		}
+
+		fmt.Fprintf(c.out, "%s\nRetrying in %s (retry %d of %d)...\n", err, delay.Round(time.Millisecond), retry+1, c.maxRetries)
+		if err := c.sleep(ctx, delay); err != nil {
+			return "", err
+		}
+	}
+}
+
+// backoff doubles the base delay after every retry up to the max delay.
+func backoff(retry int, baseDelay time.Duration, maxDelay time.Duration) time.Duration {
+	delay := baseDelay
+	for i := 0; i < retry && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		return maxDelay
+	}
+	return delay
+}
+
+// equalJitter waits between half and the whole delay so clients limited at
+// the same time don't retry at the same time.
+func equalJitter(delay time.Duration) time.Duration {
+	if delay <= 0 {
+		return delay
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+func sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// isRetryable returns whether an error is likely to go away by sending the
+// same request again.
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var openAIError openAI.APIError
+	if errors.As(err, &openAIError) {
+		return isRetryableStatus(openAIError.StatusCode, openAIError.Type)
+	}
+	var azureError azureOpenAI.APIError
+	if errors.As(err, &azureError) {
+		return isRetryableStatus(azureError.StatusCode, azureError.Type)
+	}
+
+	var netError net.Error
+	return errors.As(err, &netError) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
+
+func isRetryableStatus(statusCode int, errorType string) bool {
+	if statusCode == http.StatusTooManyRequests && errorType == insufficientQuota {
+		return false
+	}
+	return retryableStatusCodes[statusCode]
+}
+
+type retryAfterKey struct{}
+
+// retryAfterHint receives the wait asked by the API in the Retry-After
+// headers of a failed response. The clients we depend on don't return the
+// headers with their errors, so the transport of every HTTP client stores
+// them in the hint found in the context of the request.
+type retryAfterHint struct {
+	mutex sync.Mutex
+	after time.Duration
+	set   bool
+}
+
+func (h *retryAfterHint) get() (time.Duration, bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.after, h.set
+}
+
+func (h *retryAfterHint) record(header http.Header, now time.Time) {
+	after, ok := parseRetryAfter(header, now)
+	if !ok {
+		return
+	}
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.after, h.set = after, true
+}
+
+// parseRetryAfter reads the milliseconds headers sent by Azure and OpenAI or
+// the standard Retry-After header, in seconds or as a date.
+func parseRetryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	for _, name := range []string{"Retry-After-Ms", "X-Ms-Retry-After-Ms"} {
+		if value := header.Get(name); value != "" {
+			milliseconds, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err == nil && milliseconds >= 0 {
+				return time.Duration(milliseconds * float64(time.Millisecond)), true
+			}
+		}
+	}
+
+	value := strings.TrimSpace(header.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if date.Before(now) {
+			return 0, true
+		}
+		return date.Sub(now), true
+	}
+	return 0, false
+}
+
+// retryAfterTransport records the Retry-After headers of the failed responses
+// in the hint of the request context, if there is one.
+type retryAfterTransport struct {
+	base http.RoundTripper
+}
+
+func (t *retryAfterTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode < 400 {
+		return resp, err
+	}
+	if hint, ok := req.Context().Value(retryAfterKey{}).(*retryAfterHint); ok {
+		hint.record(resp.Header, time.Now())
+	}
+	return resp, err
+}
@@ -0,0 +1,203 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	openAI "github.com/PullRequestInc/go-gpt3"
+	"github.com/afrancoc2000/application-helper-ai/internal/config"
+	"github.com/afrancoc2000/application-helper-ai/internal/models"
+	. "github.com/smartystreets/goconvey/convey"
+	azureOpenAI "github.com/sozercan/kubectl-ai/pkg/gpt3"
+)
+
+const chatAnswer = `{"choices":[{"message":{"role":"assistant","content":"[]"}}],"usage":{"prompt_tokens":10,"completion_tokens":1,"total_tokens":11}}`
+
+func TestRetry(t *testing.T) {
+	offlineTokenizers(t)
+
+	Convey("retryingClient", t, func() {
+
+		// responses are sent in order, the last one is repeated
+		var responses []func(w http.ResponseWriter)
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			response := responses[len(responses)-1]
+			if requests < len(responses) {
+				response = responses[requests]
+			}
+			requests++
+			response(w)
+		}))
+		defer server.Close()
+
+		status := func(code int, headers map[string]string, body string) func(w http.ResponseWriter) {
+			return func(w http.ResponseWriter) {
+				for name, value := range headers {
+					w.Header().Set(name, value)
+				}
+				w.WriteHeader(code)
+				fmt.Fprint(w, body)
+			}
+		}
+
+		appConfig := config.AppConfig{
+			Provider:         config.OllamaProvider,
+			BaseURL:          server.URL + "/v1",
+			OpenaiDeployment: models.LocalDeployment("llama2"),
+			Choices:          1,
+			MaxRetries:       3,
+			RetryDelay:       time.Second,
+			RetryMaxDelay:    time.Minute,
+		}
+		aiClient, err := NewAIClient(appConfig)
+		So(err, ShouldBeNil)
+		client := aiClient.(*retryingClient)
+
+		delays := []time.Duration{}
+		client.sleep = func(ctx context.Context, delay time.Duration) error {
+			delays = append(delays, delay)
+			return nil
+		}
+		client.jitter = func(delay time.Duration) time.Duration { return delay }
+		out := &bytes.Buffer{}
+		client.out = out
+		history := len(client.History())
+
+		Convey("Retries a rate limit waiting what the API asked", func() {
+			responses = []func(w http.ResponseWriter){
+				status(http.StatusTooManyRequests, map[string]string{"Retry-After": "7"}, `{"error":{"message":"Rate limit reached","type":"requests"}}`),
+				status(http.StatusOK, nil, chatAnswer),
+			}
+
+			answer, err := client.QueryOpenAI(context.Background(), "Create a page")
+			So(err, ShouldBeNil)
+			So(answer, ShouldEqual, "[]")
+			So(requests, ShouldEqual, 2)
+			So(delays, ShouldResemble, []time.Duration{7 * time.Second})
+			So(out.String(), ShouldContainSubstring, "Retrying in 7s (retry 1 of 3)")
+
+			// the prompt is only once in the conversation
+			So(len(client.History()), ShouldEqual, history+2)
+		})
+
+		Convey("Backs off exponentially on server errors", func() {
+			responses = []func(w http.ResponseWriter){
+				status(http.StatusBadGateway, nil, "Bad gateway"),
+				status(http.StatusServiceUnavailable, nil, "Unavailable"),
+				status(http.StatusOK, nil, chatAnswer),
+			}
+
+			_, err := client.QueryOpenAI(context.Background(), "Create a page")
+			So(err, ShouldBeNil)
+			So(delays, ShouldResemble, []time.Duration{time.Second, 2 * time.Second})
+		})
+
+		Convey("Gives up after the max retries", func() {
+			responses = []func(w http.ResponseWriter){status(http.StatusInternalServerError, nil, "Error")}
+
+			_, err := client.QueryOpenAI(context.Background(), "Create a page")
+			So(err, ShouldNotBeNil)
+			So(requests, ShouldEqual, 4)
+			So(len(client.History()), ShouldEqual, history)
+		})
+
+		Convey("Doesn't retry client errors", func() {
+			responses = []func(w http.ResponseWriter){
+				status(http.StatusUnauthorized, nil, `{"error":{"message":"Invalid API key","type":"invalid_request_error"}}`),
+			}
+
+			_, err := client.QueryOpenAI(context.Background(), "Create a page")
+			So(err, ShouldNotBeNil)
+			So(requests, ShouldEqual, 1)
+			So(len(client.History()), ShouldEqual, history)
+		})
+
+		Convey("Doesn't retry an exhausted quota", func() {
+			responses = []func(w http.ResponseWriter){
+				status(http.StatusTooManyRequests, nil, `{"error":{"message":"You exceeded your current quota","type":"insufficient_quota"}}`),
+			}
+
+			_, err := client.QueryOpenAI(context.Background(), "Create a page")
+			So(err, ShouldNotBeNil)
+			So(requests, ShouldEqual, 1)
+		})
+
+		Convey("Doesn't wait longer than the max delay", func() {
+			responses = []func(w http.ResponseWriter){
+				status(http.StatusTooManyRequests, map[string]string{"Retry-After": "120"}, "Slow down"),
+			}
+
+			_, err := client.QueryOpenAI(context.Background(), "Create a page")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "asked to wait 2m0s")
+			So(requests, ShouldEqual, 1)
+		})
+
+		Convey("Retries a stream that failed before any chunk", func() {
+			responses = []func(w http.ResponseWriter){
+				status(http.StatusServiceUnavailable, nil, "Unavailable"),
+				status(http.StatusOK, nil, "data: {\"choices\":[{\"delta\":{\"content\":\"[]\"}}]}\n\ndata: [DONE]\n\n"),
+			}
+
+			chunks := []string{}
+			answer, err := client.QueryOpenAIStream(context.Background(), "Create a page", func(chunk string) {
+				chunks = append(chunks, chunk)
+			})
+			So(err, ShouldBeNil)
+			So(answer, ShouldEqual, "[]")
+			So(chunks, ShouldResemble, []string{"[]"})
+		})
+
+		Convey("Doesn't retry a stream cut after a chunk", func() {
+			responses = []func(w http.ResponseWriter){
+				status(http.StatusOK, nil, "data: {\"choices\":[{\"delta\":{\"content\":\"[{\"}}]}\n\n"),
+			}
+
+			_, err := client.QueryOpenAIStream(context.Background(), "Create a page", func(chunk string) {})
+			So(err, ShouldNotBeNil)
+			So(requests, ShouldEqual, 1)
+			So(len(client.History()), ShouldEqual, history)
+		})
+	})
+
+	Convey("isRetryable", t, func() {
+		So(isRetryable(openAI.APIError{StatusCode: http.StatusTooManyRequests}), ShouldBeTrue)
+		So(isRetryable(azureOpenAI.APIError{StatusCode: http.StatusGatewayTimeout}), ShouldBeTrue)
+		So(isRetryable(fmt.Errorf("wrapped: %w", azureOpenAI.APIError{StatusCode: http.StatusBadRequest})), ShouldBeFalse)
+		So(isRetryable(context.Canceled), ShouldBeFalse)
+	})
+
+	Convey("parseRetryAfter", t, func() {
+		now := time.Date(2023, 6, 12, 10, 0, 0, 0, time.UTC)
+
+		after, ok := parseRetryAfter(http.Header{"Retry-After": {"3"}}, now)
+		So(ok, ShouldBeTrue)
+		So(after, ShouldEqual, 3*time.Second)
+
+		after, ok = parseRetryAfter(http.Header{"Retry-After-Ms": {"1500"}, "Retry-After": {"2"}}, now)
+		So(ok, ShouldBeTrue)
+		So(after, ShouldEqual, 1500*time.Millisecond)
+
+		after, ok = parseRetryAfter(http.Header{"Retry-After": {now.Add(time.Minute).Format(http.TimeFormat)}}, now)
+		So(ok, ShouldBeTrue)
+		So(after, ShouldEqual, time.Minute)
+
+		_, ok = parseRetryAfter(http.Header{"Retry-After": {"soon"}}, now)
+		So(ok, ShouldBeFalse)
+	})
+
+	Convey("backoff", t, func() {
+		So(backoff(0, time.Second, time.Minute), ShouldEqual, time.Second)
+		So(backoff(3, time.Second, time.Minute), ShouldEqual, 8*time.Second)
+		So(backoff(10, time.Second, time.Minute), ShouldEqual, time.Minute)
+
+		jittered := equalJitter(10 * time.Second)
+		So(jittered, ShouldBeBetweenOrEqual, 5*time.Second, 10*time.Second)
+	})
+}
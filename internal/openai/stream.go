@@ -0,0 +1,141 @@
+package openai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	azureOpenAI "github.com/sozercan/kubectl-ai/pkg/gpt3"
+)
+
+const azureAPIVersion = "2023-03-15-preview"
+
+var (
+	dataPrefix   = []byte("data: ")
+	doneSequence = []byte("[DONE]")
+)
+
+type chatCompletionStreamResponse struct {
+	ID      string                       `json:"id"`
+	Object  string                       `json:"object"`
+	Created int                          `json:"created"`
+	Model   string                       `json:"model"`
+	Choices []chatCompletionStreamChoice `json:"choices"`
+	// Usage is only sent in the last chunk, and only by the API versions that
+	// support it.
+	Usage *responseUsage `json:"usage,omitempty"`
+}
+
+type responseUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+func (u *responseUsage) tokenUsage() TokenUsage {
+	return TokenUsage{PromptTokens: u.PromptTokens, CompletionTokens: u.CompletionTokens}
+}
+
+type chatCompletionStreamChoice struct {
+	Index        int                       `json:"index"`
+	FinishReason string                    `json:"finish_reason"`
+	Delta        chatCompletionStreamDelta `json:"delta"`
+}
+
+type chatCompletionStreamDelta struct {
+	Role         string        `json:"role"`
+	Content      string        `json:"content"`
+	FunctionCall *functionCall `json:"function_call,omitempty"`
+}
+
+// chatCompletionStream streams a chat completion from Azure OpenAI, the Azure
+// client we depend on only supports streaming for the completions endpoint.
+func (c *azureAIChatClient) chatCompletionStream(
+	ctx context.Context,
+	request azureOpenAI.ChatCompletionRequest,
+	onData func(*chatCompletionStreamResponse)) error {
+	request.Stream = true
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/openai/deployments/%s/chat/completions?api-version=%s",
+		strings.TrimSuffix(c.appConfig.AzureOpenaiEndpoint, "/"),
+		c.appConfig.OpenaiDeployment.String(),
+		azureAPIVersion)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-type", "application/json")
+	req.Header.Set("api-key", c.appConfig.OpenaiApiKey)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return azureErrorFromResponse(resp)
+	}
+
+	return readEventStream(resp.Body, func(data []byte) error {
+		output := new(chatCompletionStreamResponse)
+		if err := json.Unmarshal(data, output); err != nil {
+			return fmt.Errorf("invalid json stream data: %w", err)
+		}
+		onData(output)
+		return nil
+	})
+}
+
+// readEventStream reads server sent events until the [DONE] sequence is
+// received, calling onEvent with the data of every event.
+func readEventStream(body io.Reader, onEvent func(data []byte) error) error {
+	reader := bufio.NewReader(body)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return err
+		}
+
+		line = bytes.TrimSpace(line)
+		if !bytes.HasPrefix(line, dataPrefix) {
+			continue
+		}
+		line = bytes.TrimPrefix(line, dataPrefix)
+
+		if bytes.HasPrefix(line, doneSequence) {
+			return nil
+		}
+		if err := onEvent(line); err != nil {
+			return err
+		}
+	}
+}
+
+func azureErrorFromResponse(resp *http.Response) error {
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read from body: %w", err)
+	}
+
+	var result azureOpenAI.APIErrorResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		return azureOpenAI.APIError{
+			StatusCode: resp.StatusCode,
+			Type:       "Unexpected",
+			Message:    string(data),
+		}
+	}
+	result.Error.StatusCode = resp.StatusCode
+	return result.Error
+}
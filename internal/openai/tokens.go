@@ -0,0 +1,134 @@
+package openai
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/afrancoc2000/application-helper-ai/internal/models"
+	"github.com/afrancoc2000/application-helper-ai/internal/tokenizer"
+)
+
+const (
+	// tokensPerMessage and tokensPerReply are the tokens the chat format adds
+	// around every message and to prime the answer of the assistant.
+	tokensPerMessage       = 3
+	legacyTokensPerMessage = 4
+	legacyChatModel        = "gpt-3.5-turbo-0301"
+	tokensPerReply         = 3
+)
+
+// TokenUsage is the number of tokens sent and received in a query.
+type TokenUsage struct {
+	PromptTokens     int `json:"promptTokens"`
+	CompletionTokens int `json:"completionTokens"`
+	// Estimated is set when the API didn't report the usage, usually while
+	// streaming, and the tokens were counted with the tokenizer of the model.
+	Estimated bool `json:"estimated,omitempty"`
+}
+
+// Add returns the sum of both usages, estimated if any of them is.
+func (u TokenUsage) Add(other TokenUsage) TokenUsage {
+	return TokenUsage{
+		PromptTokens:     u.PromptTokens + other.PromptTokens,
+		CompletionTokens: u.CompletionTokens + other.CompletionTokens,
+		Estimated:        u.Estimated || other.Estimated,
+	}
+}
+
+func (u TokenUsage) reported() bool {
+	return u.PromptTokens > 0 || u.CompletionTokens > 0
+}
+
+// usageRecorder keeps the usage of the last successful query of a client.
+type usageRecorder struct {
+	mutex sync.Mutex
+	last  TokenUsage
+}
+
+// record stores the usage reported by the API. When there is none the
+// tokens of the answer are counted and stored with the prompt tokens counted
+// before the request, an answer that can't be counted is recorded with no
+// completion tokens.
+func (r *usageRecorder) record(deployment models.Deployment, promptTokens int, answer string, reported TokenUsage) {
+	usage := reported
+	if !usage.reported() {
+		completionTokens, err := countTokens(deployment, answer)
+		if err != nil {
+			completionTokens = 0
+		}
+		usage = TokenUsage{PromptTokens: promptTokens, CompletionTokens: completionTokens, Estimated: true}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.last = usage
+}
+
+func (r *usageRecorder) LastUsage() TokenUsage {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.last
+}
+
+// countTokens counts the tokens of a text with the tokenizer of the model.
+func countTokens(deployment models.Deployment, text string) (int, error) {
+	encoding, err := tokenizer.ForName(deployment.Tokenizer())
+	if err != nil {
+		return 0, err
+	}
+	return encoding.Count(text)
+}
+
+// countMessages counts the tokens of a chat request the way the API does,
+// the role and content of every message plus the tokens of the chat format.
+func countMessages(deployment models.Deployment, messages []models.Message) (int, error) {
+	encoding, err := tokenizer.ForName(deployment.Tokenizer())
+	if err != nil {
+		return 0, err
+	}
+
+	perMessage := tokensPerMessage
+	if deployment.Model.Name == legacyChatModel {
+		perMessage = legacyTokensPerMessage
+	}
+
+	total := tokensPerReply
+	for _, message := range messages {
+		role, err := encoding.Count(message.Role.String())
+		if err != nil {
+			return 0, err
+		}
+		content, err := encoding.Count(message.Content)
+		if err != nil {
+			return 0, err
+		}
+		total += perMessage + role + content
+	}
+	return total, nil
+}
+
+// countFunction approximates the tokens of a function definition with the
+// tokens of its JSON, the API doesn't document how they are rendered.
+func countFunction(deployment models.Deployment, function functionDefinition) (int, error) {
+	definition, err := json.Marshal(function)
+	if err != nil {
+		return 0, err
+	}
+	return countTokens(deployment, string(definition))
+}
+
+// remainingTokens returns the tokens left for the completion after the
+// prompt, limited by the max tokens of the user and the max output of the
+// model.
+func remainingTokens(promptTokens int, deployment models.Deployment, userMaxTokens int) *int {
+	maxTokens := deployment.MaxTokens()
+	if userMaxTokens > 0 && userMaxTokens < maxTokens {
+		maxTokens = userMaxTokens
+	}
+
+	remaining := maxTokens - reservedTokens - promptTokens
+	if remaining > deployment.MaxOutputTokens() {
+		remaining = deployment.MaxOutputTokens()
+	}
+	return &remaining
+}
@@ -0,0 +1,153 @@
+package session
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/afrancoc2000/application-helper-ai/internal/config"
+	"github.com/afrancoc2000/application-helper-ai/internal/models"
+	"github.com/afrancoc2000/application-helper-ai/internal/usage"
+)
+
+// Session is a generation conversation saved to disk so it can be resumed later.
+type Session struct {
+	ID        string           `json:"id"`
+	CreatedAt time.Time        `json:"createdAt"`
+	UpdatedAt time.Time        `json:"updatedAt"`
+	Config    Config           `json:"config"`
+	Messages  []models.Message `json:"messages"`
+	Turns     []Turn           `json:"turns"`
+}
+
+// Turn is a prompt sent in the session together with the files generated for it.
+type Turn struct {
+	Prompt  string           `json:"prompt"`
+	Answer  string           `json:"answer"`
+	Files   []models.AppFile `json:"files"`
+	Applied bool             `json:"applied"`
+	// RepairRounds is how many times the model was asked to fix an answer that couldn't be parsed.
+	RepairRounds int `json:"repairRounds,omitempty"`
+	// PromptTokens and CompletionTokens add up all the queries of the turn, repairs included.
+	PromptTokens     int `json:"promptTokens,omitempty"`
+	CompletionTokens int `json:"completionTokens,omitempty"`
+	// Cost is in US dollars, nil when the model had no price.
+	Cost           *float64  `json:"cost,omitempty"`
+	UsageEstimated bool      `json:"usageEstimated,omitempty"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+// Config holds the settings the conversation was started with, the API key is
+// never saved.
+type Config struct {
+	Provider             string  `json:"provider"`
+	OpenaiDeploymentName string  `json:"openaiDeploymentName"`
+	AzureOpenaiEndpoint  string  `json:"azureOpenaiEndpoint,omitempty"`
+	BaseURL              string  `json:"baseUrl,omitempty"`
+	MaxTokens            int     `json:"maxTokens,omitempty"`
+	Temperature          float32 `json:"temperature"`
+	ChatContext          string  `json:"chatContext,omitempty"`
+	OutputDir            string  `json:"outputDir"`
+}
+
+// New starts a session for the given configuration.
+func New(appConfig config.AppConfig) *Session {
+	now := time.Now().UTC()
+	return &Session{
+		ID:        newID(now),
+		CreatedAt: now,
+		UpdatedAt: now,
+		Config:    ConfigFrom(appConfig),
+		Messages:  []models.Message{},
+		Turns:     []Turn{},
+	}
+}
+
+// ConfigFrom returns the settings of appConfig that are saved with a session.
+func ConfigFrom(appConfig config.AppConfig) Config {
+	return Config{
+		Provider:             appConfig.ProviderName(),
+		OpenaiDeploymentName: appConfig.OpenaiDeploymentName,
+		AzureOpenaiEndpoint:  appConfig.AzureOpenaiEndpoint,
+		BaseURL:              appConfig.BaseURL,
+		MaxTokens:            appConfig.MaxTokens,
+		Temperature:          appConfig.Temperature,
+		ChatContext:          appConfig.ChatContext,
+		OutputDir:            appConfig.OutputDir,
+	}
+}
+
+// Settings returns the saved settings by their configuration label, to be used
+// as defaults when the session is resumed.
+func (c Config) Settings() map[string]interface{} {
+	return map[string]interface{}{
+		config.ProviderLabel:             c.Provider,
+		config.OpenaiDeploymentNameLabel: c.OpenaiDeploymentName,
+		config.AzureOpenaiEndpointLabel:  c.AzureOpenaiEndpoint,
+		config.BaseURLLabel:              c.BaseURL,
+		config.MaxTokensLabel:            c.MaxTokens,
+		config.TemperatureLabel:          c.Temperature,
+		config.ChatContextLabel:          c.ChatContext,
+		config.OutputDirLabel:            c.OutputDir,
+	}
+}
+
+// AddTurn records the answer to a prompt and the files parsed from it.
+func (s *Session) AddTurn(prompt string, answer string, files []models.AppFile) {
+	now := time.Now().UTC()
+	s.Turns = append(s.Turns, Turn{
+		Prompt:    prompt,
+		Answer:    answer,
+		Files:     files,
+		CreatedAt: now,
+	})
+	s.UpdatedAt = now
+}
+
+// SetUsage keeps the usage of the last turn.
+func (s *Session) SetUsage(record usage.Record) {
+	turn := s.LastTurn()
+	if turn == nil {
+		return
+	}
+	turn.PromptTokens = record.PromptTokens
+	turn.CompletionTokens = record.CompletionTokens
+	turn.Cost = record.Cost
+	turn.UsageEstimated = record.Estimated
+}
+
+// Usage adds up the tokens and cost of all the turns.
+func (s *Session) Usage() usage.Total {
+	total := usage.Total{Key: s.ID}
+	for _, turn := range s.Turns {
+		total.Add(usage.Record{
+			PromptTokens:     turn.PromptTokens,
+			CompletionTokens: turn.CompletionTokens,
+			Cost:             turn.Cost,
+			Estimated:        turn.UsageEstimated,
+		})
+	}
+	return total
+}
+
+// LastTurn returns the most recent turn, or nil if nothing was generated yet.
+func (s *Session) LastTurn() *Turn {
+	if len(s.Turns) == 0 {
+		return nil
+	}
+	return &s.Turns[len(s.Turns)-1]
+}
+
+// Title returns the first prompt of the session, which describes what it is about.
+func (s *Session) Title() string {
+	if len(s.Turns) == 0 {
+		return ""
+	}
+	return s.Turns[0].Prompt
+}
+
+func newID(now time.Time) string {
+	suffix := make([]byte, 3)
+	_, _ = rand.Read(suffix)
+	return now.Format("20060102-150405") + "-" + hex.EncodeToString(suffix)
+}
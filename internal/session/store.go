@@ -0,0 +1,113 @@
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/afrancoc2000/application-helper-ai/internal/config"
+)
+
+const sessionsDir = "sessions"
+
+// Store saves sessions as JSON files in a directory.
+type Store struct {
+	dir string
+}
+
+// NewStore returns a Store that keeps the sessions in dir.
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+// DefaultStore returns the Store in the sessions directory of the application
+// config directory.
+func DefaultStore() (*Store, error) {
+	dir, err := config.ConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	return NewStore(filepath.Join(dir, sessionsDir)), nil
+}
+
+// Save writes the session, only readable by the user because prompts and
+// generated files can contain sensitive information.
+func (s *Store) Save(session *Session) error {
+	path, err := s.path(session.ID)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(s.dir, 0o700)
+	if err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0o600)
+}
+
+// Load reads the session with the given ID.
+func (s *Store) Load(id string) (*Session, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("the session %s does not exist, run the sessions list command to see the saved sessions", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	session := &Session{}
+	err = json.Unmarshal(content, session)
+	if err != nil {
+		return nil, fmt.Errorf("invalid session %s: %w", path, err)
+	}
+	return session, nil
+}
+
+// List returns every saved session, the most recently updated first.
+func (s *Store) List() ([]*Session, error) {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []*Session{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []*Session{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		session, err := s.Load(strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	sort.SliceStable(sessions, func(i, j int) bool {
+		return sessions[i].UpdatedAt.After(sessions[j].UpdatedAt)
+	})
+	return sessions, nil
+}
+
+func (s *Store) path(id string) (string, error) {
+	if id == "" || id != filepath.Base(id) || strings.HasPrefix(id, ".") {
+		return "", fmt.Errorf("invalid session ID %q", id)
+	}
+	return filepath.Join(s.dir, id+".json"), nil
+}
@@ -0,0 +1,429 @@
+// Package stubserver is an HTTP server implementing the chat and completion
+// endpoints of OpenAI and Azure OpenAI with scripted responses, so the
+// clients can be tested end to end without network.
+package stubserver
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ChatEndpoint       Endpoint = "chat"
+	CompletionEndpoint Endpoint = "completion"
+)
+
+const (
+	openAIPrefix = "/v1"
+	azurePrefix  = "/openai/deployments/"
+)
+
+// Endpoint is the API called by a request.
+type Endpoint string
+
+// Usage is the token usage reported in a response.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// Response is what the server answers to a request.
+type Response struct {
+	// Content is the answer of the model, used when Chunks is empty.
+	Content string
+	// Chunks are the parts a streamed answer is sent in, a response that isn't
+	// streamed joins them.
+	Chunks []string
+	// Function sends the answer as the arguments of the function the request
+	// asked for instead of as content.
+	Function bool
+	Usage    *Usage
+	// Status is the status code of an error response, 0 answers with 200.
+	Status       int
+	ErrorType    string
+	ErrorMessage string
+	Header       http.Header
+	// Delay is waited before answering and ChunkDelay before every chunk.
+	Delay      time.Duration
+	ChunkDelay time.Duration
+	// Disconnect closes the connection after the chunks without ending the
+	// stream, like a connection cut in the middle of an answer.
+	Disconnect bool
+}
+
+// Answer returns a response with the given content.
+func Answer(content string) Response {
+	return Response{Content: content}
+}
+
+// FunctionAnswer returns a response with the given function arguments.
+func FunctionAnswer(arguments string) Response {
+	return Response{Content: arguments, Function: true}
+}
+
+// Error returns an error response in the format of the API.
+func Error(status int, errorType string, message string) Response {
+	return Response{Status: status, ErrorType: errorType, ErrorMessage: message}
+}
+
+// RateLimited returns a 429 response asking to wait the given time before
+// retrying, in the headers sent by OpenAI and Azure.
+func RateLimited(retryAfter time.Duration) Response {
+	response := Error(http.StatusTooManyRequests, "requests", "Rate limit reached")
+	response.Header = http.Header{
+		"Retry-After":    {strconv.Itoa(int(retryAfter.Seconds()))},
+		"Retry-After-Ms": {strconv.FormatInt(retryAfter.Milliseconds(), 10)},
+	}
+	return response
+}
+
+func (r Response) text() string {
+	if len(r.Chunks) == 0 {
+		return r.Content
+	}
+	return strings.Join(r.Chunks, "")
+}
+
+func (r Response) chunks() []string {
+	if len(r.Chunks) == 0 {
+		return []string{r.Content}
+	}
+	return r.Chunks
+}
+
+// Message is a message of a chat request.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Request is a request received by the server.
+type Request struct {
+	Method string
+	// Host is the host the request was sent to, which isn't the server when
+	// it is used as a proxy.
+	Host     string
+	Path     string
+	Query    url.Values
+	Header   http.Header
+	Endpoint Endpoint
+	// Azure tells whether the request was sent to the Azure endpoints.
+	Azure bool
+	// Deployment is the model of an OpenAI request or the deployment in the
+	// path of an Azure request.
+	Deployment string
+	// APIKey is the key or the bearer token the request was sent with.
+	APIKey string
+	Body   []byte
+
+	Model        string            `json:"model"`
+	Messages     []Message         `json:"messages"`
+	Prompt       []string          `json:"prompt"`
+	Stream       bool              `json:"stream"`
+	MaxTokens    int               `json:"max_tokens"`
+	Functions    []json.RawMessage `json:"functions"`
+	FunctionCall map[string]string `json:"function_call"`
+}
+
+// LastMessage returns the content of the last message of a chat request.
+func (r Request) LastMessage() string {
+	if len(r.Messages) == 0 {
+		return ""
+	}
+	return r.Messages[len(r.Messages)-1].Content
+}
+
+// Server answers the requests with the scripted responses in the order they
+// were enqueued, and with the default response once they run out.
+type Server struct {
+	*httptest.Server
+	// APIKey, when set, rejects the requests sent with another key or token.
+	APIKey string
+
+	mutex     sync.Mutex
+	responses []Response
+	fallback  *Response
+	requests  []Request
+}
+
+// New starts a server, it must be closed when the test ends.
+func New() *Server {
+	server := &Server{}
+	server.Server = httptest.NewServer(http.HandlerFunc(server.serve))
+	return server
+}
+
+// NewTLS starts a server using HTTPS with a self-signed certificate, see
+// CertificatePEM.
+func NewTLS() *Server {
+	server := &Server{}
+	server.Server = httptest.NewTLSServer(http.HandlerFunc(server.serve))
+	return server
+}
+
+// CertificatePEM returns the certificate of a server started with NewTLS,
+// PEM encoded to be used as a CA bundle.
+func (s *Server) CertificatePEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.Certificate().Raw})
+}
+
+// OpenAIBaseURL is the base URL of the OpenAI API served.
+func (s *Server) OpenAIBaseURL() string {
+	return s.URL + openAIPrefix
+}
+
+// AzureEndpoint is the endpoint of the Azure OpenAI resource served.
+func (s *Server) AzureEndpoint() string {
+	return s.URL
+}
+
+// Enqueue adds responses to send to the next requests.
+func (s *Server) Enqueue(responses ...Response) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.responses = append(s.responses, responses...)
+}
+
+// SetDefault sets the response sent when there are no responses enqueued,
+// without one those requests fail with a 500.
+func (s *Server) SetDefault(response Response) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.fallback = &response
+}
+
+// Requests returns the requests received so far.
+func (s *Server) Requests() []Request {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]Request{}, s.requests...)
+}
+
+// Pending returns the number of enqueued responses not sent yet.
+func (s *Server) Pending() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.responses)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	request, err := parseRequest(r)
+	if err != nil {
+		writeError(w, Error(http.StatusNotFound, "invalid_request_error", err.Error()))
+		return
+	}
+
+	s.mutex.Lock()
+	s.requests = append(s.requests, request)
+	if s.APIKey != "" && request.APIKey != s.APIKey {
+		s.mutex.Unlock()
+		writeError(w, Error(http.StatusUnauthorized, "invalid_request_error", "Incorrect API key provided"))
+		return
+	}
+	response, ok := s.next()
+	s.mutex.Unlock()
+
+	if !ok {
+		writeError(w, Error(http.StatusInternalServerError, "server_error", "There is no response scripted for this request"))
+		return
+	}
+
+	if !wait(r, response.Delay) {
+		return
+	}
+	for name, values := range response.Header {
+		w.Header()[name] = values
+	}
+	if response.Status != 0 && response.Status != http.StatusOK {
+		writeError(w, response)
+		return
+	}
+	if request.Stream {
+		stream(w, r, request, response)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(answer(request, response))
+}
+
+// next must be called holding the mutex.
+func (s *Server) next() (Response, bool) {
+	if len(s.responses) > 0 {
+		response := s.responses[0]
+		s.responses = s.responses[1:]
+		return response, true
+	}
+	if s.fallback != nil {
+		return *s.fallback, true
+	}
+	return Response{}, false
+}
+
+func parseRequest(r *http.Request) (Request, error) {
+	request := Request{
+		Method: r.Method,
+		Host:   r.Host,
+		Path:   r.URL.Path,
+		Query:  r.URL.Query(),
+		Header: r.Header.Clone(),
+	}
+	if r.Method != http.MethodPost {
+		return request, fmt.Errorf("unsupported method %s", r.Method)
+	}
+
+	path := r.URL.Path
+	switch {
+	case path == openAIPrefix+"/chat/completions":
+		request.Endpoint = ChatEndpoint
+	case strings.HasPrefix(path, openAIPrefix+"/engines/") && strings.HasSuffix(path, "/completions"):
+		request.Endpoint = CompletionEndpoint
+		request.Deployment = strings.TrimSuffix(strings.TrimPrefix(path, openAIPrefix+"/engines/"), "/completions")
+	case strings.HasPrefix(path, azurePrefix):
+		deployment, endpoint, ok := strings.Cut(strings.TrimPrefix(path, azurePrefix), "/")
+		switch {
+		case !ok:
+			return request, fmt.Errorf("unknown path %s", path)
+		case endpoint == "chat/completions":
+			request.Endpoint = ChatEndpoint
+		case endpoint == "completions":
+			request.Endpoint = CompletionEndpoint
+		default:
+			return request, fmt.Errorf("unknown path %s", path)
+		}
+		if request.Query.Get("api-version") == "" {
+			return request, fmt.Errorf("the api-version query parameter is required")
+		}
+		request.Azure = true
+		request.Deployment = deployment
+	default:
+		return request, fmt.Errorf("unknown path %s", path)
+	}
+
+	// Azure also accepts Azure AD tokens as bearer tokens
+	if request.Azure {
+		request.APIKey = r.Header.Get("api-key")
+	}
+	if request.APIKey == "" {
+		request.APIKey = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return request, err
+	}
+	request.Body = body
+	if err := json.Unmarshal(body, &request); err != nil {
+		return request, fmt.Errorf("invalid request body: %w", err)
+	}
+	if request.Deployment == "" {
+		request.Deployment = request.Model
+	}
+	return request, nil
+}
+
+// wait sleeps the given delay unless the client goes away first.
+func wait(r *http.Request, delay time.Duration) bool {
+	if delay <= 0 {
+		return true
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-r.Context().Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func writeError(w http.ResponseWriter, response Response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(response.Status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": response.ErrorMessage,
+			"type":    response.ErrorType,
+		},
+	})
+}
+
+func answer(request Request, response Response) map[string]interface{} {
+	choice := map[string]interface{}{"index": 0, "finish_reason": "stop"}
+	object := "text_completion"
+	if request.Endpoint == ChatEndpoint {
+		object = "chat.completion"
+		message := map[string]interface{}{"role": "assistant", "content": response.text()}
+		if response.Function {
+			message["content"] = nil
+			message["function_call"] = map[string]string{"name": request.FunctionCall["name"], "arguments": response.text()}
+		}
+		choice["message"] = message
+	} else {
+		choice["text"] = response.text()
+	}
+
+	body := map[string]interface{}{
+		"id":      "stub",
+		"object":  object,
+		"created": time.Now().Unix(),
+		"model":   request.Deployment,
+		"choices": []interface{}{choice},
+	}
+	if response.Usage != nil {
+		body["usage"] = response.Usage
+	}
+	return body
+}
+
+// stream sends the chunks as server sent events, ending with [DONE].
+func stream(w http.ResponseWriter, r *http.Request, request Request, response Response) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	send := func(data interface{}) {
+		content, _ := json.Marshal(data)
+		fmt.Fprintf(w, "data: %s\n\n", content)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	for i, chunk := range response.chunks() {
+		if !wait(r, response.ChunkDelay) {
+			return
+		}
+		choice := map[string]interface{}{"index": 0}
+		if request.Endpoint == CompletionEndpoint {
+			choice["text"] = chunk
+		} else if response.Function {
+			call := map[string]string{"arguments": chunk}
+			if i == 0 {
+				call["name"] = request.FunctionCall["name"]
+			}
+			choice["delta"] = map[string]interface{}{"function_call": call}
+		} else {
+			choice["delta"] = map[string]interface{}{"content": chunk}
+		}
+		send(map[string]interface{}{"id": "stub", "model": request.Deployment, "choices": []interface{}{choice}})
+	}
+
+	if response.Disconnect {
+		// aborting the handler closes the connection without ending the body
+		panic(http.ErrAbortHandler)
+	}
+	if response.Usage != nil {
+		send(map[string]interface{}{"id": "stub", "model": request.Deployment, "choices": []interface{}{}, "usage": response.Usage})
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
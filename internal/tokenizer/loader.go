@@ -0,0 +1,151 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// CacheDirVariable is the environment variable with the directory where
+	// the downloaded ranks are kept, read every time ranks are loaded. It
+	// defaults to the application directory in the user cache directory.
+	CacheDirVariable = "APPLICATION_AI_TOKENIZER_CACHE"
+	appDirName       = "application-ai"
+	downloadTimeout  = 30 * time.Second
+	maxDownloadBytes = 16 << 20
+)
+
+// Downloader returns the ranks file found at a URL.
+type Downloader func(url string) ([]byte, error)
+
+var (
+	downloader Downloader = download
+	// httpClient downloads the ranks, replaced in tests.
+	httpClient = &http.Client{Timeout: downloadTimeout}
+)
+
+// SetDownloader replaces how the ranks missing from the cache are fetched,
+// so tests never reach the network, and returns a function that restores
+// the previous one.
+func SetDownloader(download Downloader) func() {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	previous := downloader
+	downloader = download
+	return func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+		downloader = previous
+	}
+}
+
+// cachedLoader loads the ranks of an encoding from the cache directory,
+// downloading them the first time. It replaces the tiktoken loader, which
+// downloads without a timeout to the temp directory.
+type cachedLoader struct {
+	download Downloader
+}
+
+func (l *cachedLoader) LoadTiktokenBpe(url string) (map[string]int, error) {
+	dir := cacheDir()
+	if dir == "" {
+		return nil, fmt.Errorf("there is no cache directory to keep the tokenizer ranks")
+	}
+
+	file := filepath.Join(dir, path.Base(url))
+	contents, err := os.ReadFile(file)
+	if err != nil {
+		contents, err = l.download(url)
+		if err != nil {
+			return nil, err
+		}
+		if err := save(file, contents); err != nil {
+			return nil, err
+		}
+	}
+	return parseRanks(contents)
+}
+
+func download(url string) ([]byte, error) {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("couldn't download the tokenizer ranks from %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxDownloadBytes))
+}
+
+// save writes the ranks through a temporary file so a failed download never
+// leaves a truncated file in the cache.
+func save(file string, contents []byte) error {
+	err := os.MkdirAll(filepath.Dir(file), 0o700)
+	if err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = temp.Write(contents)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), file)
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+	}
+	return err
+}
+
+// parseRanks reads the tiktoken format, a base64 token and its rank per line.
+func parseRanks(contents []byte) (map[string]int, error) {
+	ranks := map[string]int{}
+	for number, line := range strings.Split(string(contents), "\n") {
+		if line == "" {
+			continue
+		}
+		parts := strings.Fields(line)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid tokenizer ranks on line %d", number+1)
+		}
+		token, err := base64.StdEncoding.DecodeString(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid tokenizer ranks on line %d: %w", number+1, err)
+		}
+		rank, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid tokenizer ranks on line %d: %w", number+1, err)
+		}
+		ranks[string(token)] = rank
+	}
+	return ranks, nil
+}
+
+// cacheDir returns the directory of the ranks, resolved from the environment
+// when they are loaded.
+func cacheDir() string {
+	if dir := os.Getenv(CacheDirVariable); dir != "" {
+		return dir
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, appDirName, "tokenizers")
+}
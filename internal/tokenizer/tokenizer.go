@@ -0,0 +1,125 @@
+package tokenizer
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/pkoukk/tiktoken-go"
+	gptEncoder "github.com/samber/go-gpt-3-encoder"
+)
+
+const (
+	R50KBase   = "r50k_base"
+	P50KBase   = "p50k_base"
+	CL100KBase = "cl100k_base"
+	O200KBase  = "o200k_base"
+)
+
+// Tokenizer counts the tokens a model sees in a text.
+type Tokenizer interface {
+	// Name returns the encoding used to count, which differs from the
+	// requested one when it had to be approximated.
+	Name() string
+	Count(text string) (int, error)
+}
+
+var (
+	mutex      sync.Mutex
+	tokenizers = map[string]Tokenizer{}
+	// out is where the fallback to the GPT-3 encoder is reported, replaced
+	// in tests.
+	out io.Writer = os.Stderr
+)
+
+// Names returns the encodings that can be used in the model catalog.
+func Names() []string {
+	names := []string{R50KBase, P50KBase, CL100KBase, O200KBase}
+	sort.Strings(names)
+	return names
+}
+
+// ForName returns the tokenizer of an encoding, loading it only once. The
+// GPT-3 encodings are embedded in the application, the ranks of the newer
+// ones are downloaded on first use and cached. If they can't be loaded the
+// GPT-3 encoder is used instead, which counts more tokens than there are so
+// the budgets computed with it stay safe, and the user is told why.
+func ForName(name string) (Tokenizer, error) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if tokenizer, ok := tokenizers[name]; ok {
+		return tokenizer, nil
+	}
+
+	var tokenizer Tokenizer
+	var err error
+	switch name {
+	case R50KBase, P50KBase:
+		tokenizer, err = newGPT3Tokenizer(name)
+	case CL100KBase, O200KBase:
+		tokenizer, err = newTiktokenTokenizer(name)
+		if err != nil {
+			fmt.Fprintf(out, "Couldn't load the %s tokenizer, counting tokens with %s instead: %s\n", name, R50KBase, err)
+			tokenizer, err = newGPT3Tokenizer(fmt.Sprintf("%s approximating %s", R50KBase, name))
+		}
+	default:
+		return nil, fmt.Errorf("unknown tokenizer %q, please choose one of these options: %v", name, Names())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tokenizers[name] = tokenizer
+	return tokenizer, nil
+}
+
+type gpt3Tokenizer struct {
+	name    string
+	encoder *gptEncoder.Encoder
+}
+
+func newGPT3Tokenizer(name string) (Tokenizer, error) {
+	encoder, err := gptEncoder.NewEncoder()
+	if err != nil {
+		return nil, err
+	}
+	return &gpt3Tokenizer{name: name, encoder: encoder}, nil
+}
+
+func (t *gpt3Tokenizer) Name() string {
+	return t.name
+}
+
+func (t *gpt3Tokenizer) Count(text string) (int, error) {
+	tokens, err := t.encoder.Encode(text)
+	if err != nil {
+		return 0, err
+	}
+	return len(tokens), nil
+}
+
+type tiktokenTokenizer struct {
+	name     string
+	encoding *tiktoken.Tiktoken
+}
+
+func newTiktokenTokenizer(name string) (Tokenizer, error) {
+	tiktoken.SetBpeLoader(&cachedLoader{download: downloader})
+	encoding, err := tiktoken.GetEncoding(name)
+	if err != nil {
+		return nil, err
+	}
+	return &tiktokenTokenizer{name: name, encoding: encoding}, nil
+}
+
+func (t *tiktokenTokenizer) Name() string {
+	return t.name
+}
+
+func (t *tiktokenTokenizer) Count(text string) (int, error) {
+	// special tokens in generated code are just text for the model
+	return len(t.encoding.EncodeOrdinary(text)), nil
+}
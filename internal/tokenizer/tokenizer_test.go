@@ -0,0 +1,113 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTokenizer(t *testing.T) {
+	Convey("Tokenizer", t, func() {
+
+		Convey("ForName GPT-3 encodings", func() {
+			tokenizer, err := ForName(P50KBase)
+			So(err, ShouldBeNil)
+			So(tokenizer.Name(), ShouldEqual, P50KBase)
+
+			tokens, err := tokenizer.Count("hello world")
+			So(err, ShouldBeNil)
+			So(tokens, ShouldEqual, 2)
+		})
+
+		Convey("ForName unknown encoding", func() {
+			_, err := ForName("llama")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "unknown tokenizer")
+		})
+
+		Convey("cachedLoader downloads and caches the ranks", func() {
+			ranks := ""
+			for rank, token := range []string{"a", "b", "ab"} {
+				ranks += fmt.Sprintf("%s %d\n", base64.StdEncoding.EncodeToString([]byte(token)), rank)
+			}
+			downloads := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				downloads++
+				fmt.Fprint(w, ranks)
+			}))
+			defer server.Close()
+
+			dir := t.TempDir()
+			t.Setenv(CacheDirVariable, dir)
+			previousClient := httpClient
+			httpClient = server.Client()
+			defer func() { httpClient = previousClient }()
+
+			loader := &cachedLoader{download: download}
+			loaded, err := loader.LoadTiktokenBpe(server.URL + "/test.tiktoken")
+			So(err, ShouldBeNil)
+			So(loaded, ShouldResemble, map[string]int{"a": 0, "b": 1, "ab": 2})
+			_, err = os.Stat(filepath.Join(dir, "test.tiktoken"))
+			So(err, ShouldBeNil)
+
+			_, err = loader.LoadTiktokenBpe(server.URL + "/test.tiktoken")
+			So(err, ShouldBeNil)
+			So(downloads, ShouldEqual, 1)
+		})
+
+		Convey("cachedLoader failed download", func() {
+			server := httptest.NewServer(http.NotFoundHandler())
+			defer server.Close()
+
+			dir := t.TempDir()
+			t.Setenv(CacheDirVariable, dir)
+			previousClient := httpClient
+			httpClient = server.Client()
+			defer func() { httpClient = previousClient }()
+
+			_, err := (&cachedLoader{download: download}).LoadTiktokenBpe(server.URL + "/test.tiktoken")
+			So(err, ShouldNotBeNil)
+			entries, _ := os.ReadDir(dir)
+			So(entries, ShouldBeEmpty)
+		})
+
+		Convey("ForName reports the fallback to the GPT-3 encoder", func() {
+			t.Setenv(CacheDirVariable, t.TempDir())
+			defer SetDownloader(func(url string) ([]byte, error) {
+				return nil, errors.New("offline")
+			})()
+			var output strings.Builder
+			previousOut := out
+			out = &output
+			defer func() { out = previousOut }()
+			mutex.Lock()
+			delete(tokenizers, O200KBase)
+			mutex.Unlock()
+
+			tokenizer, err := ForName(O200KBase)
+			So(err, ShouldBeNil)
+			So(tokenizer.Name(), ShouldEqual, "r50k_base approximating o200k_base")
+			So(output.String(), ShouldContainSubstring, "Couldn't load the o200k_base tokenizer")
+			So(output.String(), ShouldContainSubstring, "offline")
+		})
+
+		Convey("cacheDir follows the environment", func() {
+			t.Setenv(CacheDirVariable, "/tmp/tokenizers")
+			So(cacheDir(), ShouldEqual, "/tmp/tokenizers")
+		})
+
+		Convey("parseRanks invalid line", func() {
+			_, err := parseRanks([]byte("YQ== 0\nnot-a-rank\n"))
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "line 2")
+		})
+	})
+}
@@ -0,0 +1,201 @@
+package tui
+
+import (
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+const (
+	colorReset   = "\033[0m"
+	colorRed     = "\033[31m"
+	colorGreen   = "\033[32m"
+	colorYellow  = "\033[33m"
+	colorBlue    = "\033[34m"
+	colorMagenta = "\033[35m"
+	colorCyan    = "\033[36m"
+	colorGray    = "\033[90m"
+	styleBold    = "\033[1m"
+	styleReverse = "\033[7m"
+)
+
+// syntax is how the comments of a language start, markup languages are
+// highlighted by tag instead.
+type syntax struct {
+	comments []string
+	markup   bool
+}
+
+var (
+	slashSyntax  = syntax{comments: []string{"//", "/*"}}
+	hashSyntax   = syntax{comments: []string{"#"}}
+	sqlSyntax    = syntax{comments: []string{"--"}}
+	markupSyntax = syntax{comments: []string{"<!--"}, markup: true}
+	plainSyntax  = syntax{}
+)
+
+var syntaxes = map[string]syntax{
+	".go": slashSyntax, ".js": slashSyntax, ".jsx": slashSyntax, ".ts": slashSyntax, ".tsx": slashSyntax,
+	".java": slashSyntax, ".kt": slashSyntax, ".c": slashSyntax, ".h": slashSyntax, ".cpp": slashSyntax,
+	".cs": slashSyntax, ".rs": slashSyntax, ".swift": slashSyntax, ".php": slashSyntax, ".css": slashSyntax,
+	".scss": slashSyntax, ".json": slashSyntax,
+	".py": hashSyntax, ".rb": hashSyntax, ".sh": hashSyntax, ".yaml": hashSyntax, ".yml": hashSyntax,
+	".toml": hashSyntax, ".dockerfile": hashSyntax, ".tf": hashSyntax, ".r": hashSyntax,
+	".sql":  sqlSyntax,
+	".html": markupSyntax, ".htm": markupSyntax, ".xml": markupSyntax, ".svg": markupSyntax, ".vue": markupSyntax,
+}
+
+// keywords of the common languages, highlighted in any of them
+var keywords = map[string]bool{}
+
+func init() {
+	for _, keyword := range strings.Fields(`break case catch class const continue def default defer do elif else
+		enum except export extends false finally fn for from func function go if impl import in interface let
+		match new nil None null package private protected public raise return select self static struct super
+		switch this throw true True False try type typeof undefined use var void while with yield async await
+		SELECT FROM WHERE INSERT UPDATE DELETE CREATE TABLE JOIN`) {
+		keywords[keyword] = true
+	}
+}
+
+// syntaxOf returns the syntax of a file by its extension or name.
+func syntaxOf(name string) syntax {
+	if strings.EqualFold(name, "Dockerfile") || strings.EqualFold(name, "Makefile") {
+		return hashSyntax
+	}
+	if syntax, ok := syntaxes[strings.ToLower(filepath.Ext(name))]; ok {
+		return syntax
+	}
+	return plainSyntax
+}
+
+// highlight colors a line of code, each line is highlighted on its own so
+// comments and strings spanning several lines are only colored on the first.
+func highlight(line string, syntax syntax) string {
+	if syntax.markup {
+		return highlightMarkup(line)
+	}
+	// plain text, like markdown, isn't highlighted
+	if len(syntax.comments) == 0 {
+		return line
+	}
+
+	var builder strings.Builder
+	runes := []rune(line)
+	for i := 0; i < len(runes); {
+		rest := string(runes[i:])
+		switch {
+		case startsWithAny(rest, syntax.comments):
+			builder.WriteString(colorGray + rest + colorReset)
+			return builder.String()
+		case runes[i] == '"' || runes[i] == '\'' || runes[i] == '`':
+			end := closingQuote(runes, i)
+			builder.WriteString(colorGreen + string(runes[i:end]) + colorReset)
+			i = end
+		case unicode.IsLetter(runes[i]) || runes[i] == '_':
+			end := i
+			for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end]) || runes[end] == '_') {
+				end++
+			}
+			word := string(runes[i:end])
+			if keywords[word] {
+				word = colorMagenta + word + colorReset
+			}
+			builder.WriteString(word)
+			i = end
+		case unicode.IsDigit(runes[i]):
+			end := i
+			for end < len(runes) && (unicode.IsDigit(runes[end]) || runes[end] == '.') {
+				end++
+			}
+			builder.WriteString(colorYellow + string(runes[i:end]) + colorReset)
+			i = end
+		default:
+			builder.WriteRune(runes[i])
+			i++
+		}
+	}
+	return builder.String()
+}
+
+// highlightMarkup colors the tags and their attribute values.
+func highlightMarkup(line string) string {
+	var builder strings.Builder
+	runes := []rune(line)
+	for i := 0; i < len(runes); {
+		rest := string(runes[i:])
+		switch {
+		case strings.HasPrefix(rest, "<!--"):
+			end := strings.Index(rest, "-->")
+			if end < 0 {
+				builder.WriteString(colorGray + rest + colorReset)
+				return builder.String()
+			}
+			builder.WriteString(colorGray + rest[:end+3] + colorReset)
+			i += len([]rune(rest[:end+3]))
+		case runes[i] == '<':
+			// the tag is blue up to its closing bracket, except for the quoted values
+			builder.WriteString(colorBlue)
+			end := i
+			for end < len(runes) && runes[end] != '>' {
+				if runes[end] == '"' || runes[end] == '\'' {
+					quoteEnd := closingQuote(runes, end)
+					builder.WriteString(colorGreen + string(runes[end:quoteEnd]) + colorBlue)
+					end = quoteEnd
+					continue
+				}
+				builder.WriteRune(runes[end])
+				end++
+			}
+			if end < len(runes) {
+				builder.WriteRune('>')
+				end++
+			}
+			builder.WriteString(colorReset)
+			i = end
+		default:
+			builder.WriteRune(runes[i])
+			i++
+		}
+	}
+	return builder.String()
+}
+
+// colorDiff colors a line of a unified diff.
+func colorDiff(line string) string {
+	switch {
+	case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+		return styleBold + line + colorReset
+	case strings.HasPrefix(line, "@@"):
+		return colorCyan + line + colorReset
+	case strings.HasPrefix(line, "+"):
+		return colorGreen + line + colorReset
+	case strings.HasPrefix(line, "-"):
+		return colorRed + line + colorReset
+	}
+	return line
+}
+
+// closingQuote returns the index after the quote closing the one at start,
+// or the end of the line.
+func closingQuote(runes []rune, start int) int {
+	for i := start + 1; i < len(runes); i++ {
+		if runes[i] == '\\' {
+			i++
+			continue
+		}
+		if runes[i] == runes[start] {
+			return i + 1
+		}
+	}
+	return len(runes)
+}
+
+func startsWithAny(text string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(text, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package tui
+
+import "unicode/utf8"
+
+// KeyType is a key pressed by the user, KeyRune for the printable ones.
+type KeyType int
+
+const (
+	KeyRune KeyType = iota
+	KeyUp
+	KeyDown
+	KeyLeft
+	KeyRight
+	KeyPageUp
+	KeyPageDown
+	KeyHome
+	KeyEnd
+	KeyEnter
+	KeyEscape
+	KeyBackspace
+	KeyTab
+	KeyCtrlC
+	KeyCtrlD
+	KeyCtrlU
+)
+
+// Key is a key pressed by the user.
+type Key struct {
+	Type KeyType
+	Rune rune
+}
+
+// escapeSequences are the keys sent by terminals as escape sequences, in the
+// normal and the application cursor modes.
+var escapeSequences = map[string]KeyType{
+	"\x1b[A":  KeyUp,
+	"\x1b[B":  KeyDown,
+	"\x1b[C":  KeyRight,
+	"\x1b[D":  KeyLeft,
+	"\x1bOA":  KeyUp,
+	"\x1bOB":  KeyDown,
+	"\x1bOC":  KeyRight,
+	"\x1bOD":  KeyLeft,
+	"\x1b[5~": KeyPageUp,
+	"\x1b[6~": KeyPageDown,
+	"\x1b[H":  KeyHome,
+	"\x1b[F":  KeyEnd,
+	"\x1bOH":  KeyHome,
+	"\x1bOF":  KeyEnd,
+	"\x1b[1~": KeyHome,
+	"\x1b[4~": KeyEnd,
+}
+
+// ParseKeys reads the keys of the input of a terminal in raw mode, unknown
+// escape sequences are ignored.
+func ParseKeys(input []byte) []Key {
+	keys := []Key{}
+	for len(input) > 0 {
+		switch input[0] {
+		case 0x1b:
+			key, length := parseEscape(input)
+			if key != nil {
+				keys = append(keys, *key)
+			}
+			input = input[length:]
+			continue
+		case '\r', '\n':
+			keys = append(keys, Key{Type: KeyEnter})
+		case 0x7f, 0x08:
+			keys = append(keys, Key{Type: KeyBackspace})
+		case '\t':
+			keys = append(keys, Key{Type: KeyTab})
+		case 0x03:
+			keys = append(keys, Key{Type: KeyCtrlC})
+		case 0x04:
+			keys = append(keys, Key{Type: KeyCtrlD})
+		case 0x15:
+			keys = append(keys, Key{Type: KeyCtrlU})
+		default:
+			r, size := utf8.DecodeRune(input)
+			if r >= ' ' && r != utf8.RuneError {
+				keys = append(keys, Key{Type: KeyRune, Rune: r})
+			}
+			input = input[size:]
+			continue
+		}
+		input = input[1:]
+	}
+	return keys
+}
+
+// parseEscape reads an escape sequence, a lone escape is the escape key.
+func parseEscape(input []byte) (*Key, int) {
+	if len(input) == 1 || (input[1] != '[' && input[1] != 'O') {
+		return &Key{Type: KeyEscape}, 1
+	}
+	// the sequence ends with a letter or a tilde
+	end := 2
+	for end < len(input) && (input[end] < 0x40 || input[end] > 0x7e) {
+		end++
+	}
+	if end == len(input) {
+		return nil, len(input)
+	}
+	if key, ok := escapeSequences[string(input[:end+1])]; ok {
+		return &Key{Type: key}, end + 1
+	}
+	return nil, end + 1
+}
@@ -0,0 +1,441 @@
+package tui
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	fileSystem "github.com/afrancoc2000/application-helper-ai/internal/file_system"
+)
+
+const (
+	defaultWidth  = 80
+	defaultHeight = 24
+	tabWidth      = 4
+	// the header, the status line and the footer
+	chromeHeight = 3
+)
+
+// Action is what the user chose to do with the files.
+type Action int
+
+const (
+	ApplyAction Action = iota
+	RefineAction
+	RegenerateAction
+	EditAction
+	QuitAction
+)
+
+// Options are the files to show and the state kept from the previous time
+// the interface was shown.
+type Options struct {
+	Changes []fileSystem.FileChange
+	// Accepted tells for every file whether it is applied, all of them are
+	// when it is nil.
+	Accepted []bool
+	// Selected is the index of the selected file.
+	Selected int
+	// Status is a message shown until a key is pressed, like an error.
+	Status string
+}
+
+// Result is what the user chose when the interface was closed.
+type Result struct {
+	Action   Action
+	Accepted []bool
+	// Selected is the file to edit or regenerate.
+	Selected int
+	// Prompt is the refinement of the query, or the instructions to
+	// regenerate the selected file.
+	Prompt string
+}
+
+type inputMode int
+
+const (
+	browsing inputMode = iota
+	refining
+	regenerating
+)
+
+// Model is the state of the interface, it is changed by the keys pressed and
+// drawn by View.
+type Model struct {
+	changes  []fileSystem.FileChange
+	accepted []bool
+	// order has the indexes of the files in the order of the tree
+	order []int
+	// selected is a position in order
+	selected int
+	showDiff bool
+	scroll   int
+	mode     inputMode
+	input    []rune
+	status   string
+	width    int
+	height   int
+	result   *Result
+}
+
+// NewModel returns the interface for the given files.
+func NewModel(options Options) *Model {
+	m := &Model{
+		changes:  options.Changes,
+		accepted: make([]bool, len(options.Changes)),
+		order:    make([]int, len(options.Changes)),
+		showDiff: true,
+		status:   options.Status,
+		width:    defaultWidth,
+		height:   defaultHeight,
+	}
+	for index := range m.changes {
+		m.accepted[index] = options.Accepted == nil || (index < len(options.Accepted) && options.Accepted[index])
+		m.order[index] = index
+	}
+	sort.SliceStable(m.order, func(i, j int) bool {
+		first, second := m.changes[m.order[i]].File, m.changes[m.order[j]].File
+		if directory(first.Path) != directory(second.Path) {
+			return directory(first.Path) < directory(second.Path)
+		}
+		return first.Name < second.Name
+	})
+	for position, index := range m.order {
+		if index == options.Selected {
+			m.selected = position
+		}
+	}
+	return m
+}
+
+// Resize sets the size of the terminal.
+func (m *Model) Resize(width int, height int) {
+	if width > 0 && height > 0 {
+		m.width, m.height = width, height
+	}
+}
+
+// Done returns the result once the user chose what to do.
+func (m *Model) Done() (Result, bool) {
+	if m.result == nil {
+		return Result{}, false
+	}
+	return *m.result, true
+}
+
+// Update changes the state with a key pressed by the user.
+func (m *Model) Update(key Key) {
+	m.status = ""
+	if m.mode != browsing {
+		m.updateInput(key)
+		return
+	}
+
+	switch {
+	case key.Type == KeyUp || isRune(key, 'k'):
+		m.selectFile(m.selected - 1)
+	case key.Type == KeyDown || isRune(key, 'j'):
+		m.selectFile(m.selected + 1)
+	case key.Type == KeyHome || isRune(key, 'g'):
+		m.selectFile(0)
+	case key.Type == KeyEnd || isRune(key, 'G'):
+		m.selectFile(len(m.order) - 1)
+	case key.Type == KeyPageDown || key.Type == KeyCtrlD:
+		m.scrollContent(m.bodyHeight() - 1)
+	case key.Type == KeyPageUp || key.Type == KeyCtrlU:
+		m.scrollContent(-(m.bodyHeight() - 1))
+	case isRune(key, ' '):
+		if len(m.order) > 0 {
+			index := m.order[m.selected]
+			m.accepted[index] = !m.accepted[index]
+		}
+	case isRune(key, 'A'):
+		all := m.acceptedCount() == len(m.accepted)
+		for index := range m.accepted {
+			m.accepted[index] = !all
+		}
+	case key.Type == KeyTab || isRune(key, 'd'):
+		m.showDiff = !m.showDiff
+		m.scroll = 0
+	case isRune(key, 'e'):
+		if len(m.order) > 0 {
+			m.finish(EditAction, "")
+		}
+	case isRune(key, 'r'):
+		if len(m.order) > 0 {
+			m.mode, m.input = regenerating, nil
+		}
+	case isRune(key, 'p') || isRune(key, '/'):
+		m.mode, m.input = refining, nil
+	case key.Type == KeyEnter || isRune(key, 'a'):
+		if m.acceptedCount() == 0 {
+			m.status = "No file is accepted, accept them with space or press q to quit"
+			return
+		}
+		m.finish(ApplyAction, "")
+	case isRune(key, 'q') || key.Type == KeyEscape || key.Type == KeyCtrlC:
+		m.finish(QuitAction, "")
+	}
+}
+
+func (m *Model) updateInput(key Key) {
+	switch key.Type {
+	case KeyRune:
+		m.input = append(m.input, key.Rune)
+	case KeyBackspace:
+		if len(m.input) > 0 {
+			m.input = m.input[:len(m.input)-1]
+		}
+	case KeyEscape, KeyCtrlC:
+		m.mode, m.input = browsing, nil
+	case KeyEnter:
+		text := strings.TrimSpace(string(m.input))
+		if m.mode == regenerating {
+			m.finish(RegenerateAction, text)
+			return
+		}
+		if text == "" {
+			m.status = "Write what to change in the files, or press escape to go back"
+			return
+		}
+		m.finish(RefineAction, text)
+	}
+}
+
+func (m *Model) finish(action Action, prompt string) {
+	selected := 0
+	if len(m.order) > 0 {
+		selected = m.order[m.selected]
+	}
+	m.result = &Result{
+		Action:   action,
+		Accepted: append([]bool{}, m.accepted...),
+		Selected: selected,
+		Prompt:   prompt,
+	}
+}
+
+func (m *Model) selectFile(position int) {
+	if position < 0 || position >= len(m.order) {
+		return
+	}
+	m.selected = position
+	m.scroll = 0
+}
+
+func (m *Model) scrollContent(lines int) {
+	content, _ := m.content()
+	m.scroll += lines
+	if max := len(content) - m.bodyHeight(); m.scroll > max {
+		m.scroll = max
+	}
+	if m.scroll < 0 {
+		m.scroll = 0
+	}
+}
+
+func (m *Model) acceptedCount() int {
+	count := 0
+	for _, accepted := range m.accepted {
+		if accepted {
+			count++
+		}
+	}
+	return count
+}
+
+func (m *Model) bodyHeight() int {
+	if m.height <= chromeHeight {
+		return 1
+	}
+	return m.height - chromeHeight
+}
+
+// content returns the lines shown for the selected file, the diff of a
+// modified file or the content of the others, and how to color them.
+func (m *Model) content() ([]string, func(string) string) {
+	if len(m.order) == 0 {
+		return nil, nil
+	}
+	change := m.changes[m.order[m.selected]]
+	if m.showingDiff() {
+		if diff, err := change.UnifiedDiff(); err == nil {
+			return strings.Split(strings.TrimSuffix(diff, "\n"), "\n"), colorDiff
+		}
+	}
+
+	fileSyntax := syntaxOf(change.File.Name)
+	return strings.Split(strings.TrimSuffix(change.File.Content, "\n"), "\n"), func(line string) string {
+		return highlight(line, fileSyntax)
+	}
+}
+
+func (m *Model) showingDiff() bool {
+	return m.showDiff && len(m.order) > 0 && m.changes[m.order[m.selected]].Status == fileSystem.ModifiedFile
+}
+
+// treeRow is a directory or a file of the tree, file is -1 for directories.
+type treeRow struct {
+	text string
+	file int
+}
+
+func (m *Model) tree() []treeRow {
+	rows := []treeRow{}
+	current := ""
+	for _, index := range m.order {
+		file := m.changes[index].File
+		indent := ""
+		if dir := directory(file.Path); dir != "" {
+			if dir != current {
+				rows = append(rows, treeRow{text: dir + "/", file: -1})
+				current = dir
+			}
+			indent = "  "
+		}
+		mark := " "
+		if m.accepted[index] {
+			mark = "x"
+		}
+		rows = append(rows, treeRow{
+			text: fmt.Sprintf("%s[%s] %s %s", indent, mark, statusLetter(m.changes[index].Status), file.Name),
+			file: index,
+		})
+	}
+	return rows
+}
+
+// View draws the interface, a line for every row of the terminal.
+func (m *Model) View() string {
+	bodyHeight := m.bodyHeight()
+	leftWidth := m.width / 3
+	if leftWidth > 40 {
+		leftWidth = 40
+	}
+	if leftWidth < 12 {
+		leftWidth = 12
+	}
+	rightWidth := m.width - leftWidth - 1
+	if rightWidth < 1 {
+		rightWidth = 1
+	}
+
+	lines := make([]string, 0, m.height)
+	title := fmt.Sprintf(" application-ai · %d of %d files accepted", m.acceptedCount(), len(m.changes))
+	lines = append(lines, styleReverse+fit(title, m.width)+colorReset)
+
+	rows := m.tree()
+	selectedRow := 0
+	for index, row := range rows {
+		if len(m.order) > 0 && row.file == m.order[m.selected] {
+			selectedRow = index
+		}
+	}
+	treeOffset := 0
+	if selectedRow >= bodyHeight {
+		treeOffset = selectedRow - bodyHeight + 1
+	}
+	content, color := m.content()
+
+	for row := 0; row < bodyHeight; row++ {
+		left := fit("", leftWidth)
+		if index := treeOffset + row; index < len(rows) {
+			left = fit(rows[index].text, leftWidth)
+			switch {
+			case index == selectedRow:
+				left = styleReverse + left + colorReset
+			case rows[index].file < 0:
+				left = styleBold + left + colorReset
+			}
+		}
+		right := fit("", rightWidth)
+		if index := m.scroll + row; index < len(content) {
+			right = color(fit(content[index], rightWidth))
+		}
+		lines = append(lines, left+colorGray+"│"+colorReset+right+colorReset)
+	}
+
+	lines = append(lines, m.statusLine(len(content)))
+	lines = append(lines, m.footer())
+	return strings.Join(lines, "\r\n")
+}
+
+func (m *Model) statusLine(contentLines int) string {
+	if m.status != "" {
+		return colorYellow + fit(m.status, m.width) + colorReset
+	}
+	if len(m.order) == 0 {
+		return fit("There are no files", m.width)
+	}
+
+	change := m.changes[m.order[m.selected]]
+	view := "content"
+	if m.showingDiff() {
+		view = "diff"
+	}
+	last := m.scroll + m.bodyHeight()
+	if last > contentLines {
+		last = contentLines
+	}
+	status := fmt.Sprintf("%s%s (%s) · %s · lines %d-%d of %d", change.File.Path, change.File.Name, change.Status, view, m.scroll+1, last, contentLines)
+	return colorCyan + fit(status, m.width) + colorReset
+}
+
+func (m *Model) footer() string {
+	switch m.mode {
+	case refining:
+		return m.inputLine("Add to the query: ")
+	case regenerating:
+		file := m.changes[m.order[m.selected]].File
+		return m.inputLine(fmt.Sprintf("Regenerate %s%s, what should change? ", file.Path, file.Name))
+	}
+	return colorGray + fit("↑↓ select  space accept  A all  d diff  pgup/pgdn scroll  e edit  r regenerate  p refine  enter apply  q quit", m.width) + colorReset
+}
+
+// inputLine shows the text being written, the end of it when it doesn't fit.
+func (m *Model) inputLine(label string) string {
+	input := string(m.input) + "█"
+	available := m.width - len([]rune(label))
+	if runes := []rune(input); available > 0 && len(runes) > available {
+		input = string(runes[len(runes)-available:])
+	}
+	return styleBold + fit(label+input, m.width) + colorReset
+}
+
+// fit expands the tabs of a text and cuts or pads it to the width.
+func fit(text string, width int) string {
+	runes := []rune(strings.ReplaceAll(text, "\t", strings.Repeat(" ", tabWidth)))
+	if len(runes) > width {
+		if width < 1 {
+			return ""
+		}
+		return string(runes[:width-1]) + "…"
+	}
+	return string(runes) + strings.Repeat(" ", width-len(runes))
+}
+
+// directory returns the directory of a generated file without the leading
+// "./", empty for the root.
+func directory(filePath string) string {
+	dir := path.Clean(strings.ReplaceAll(filePath, "\\", "/"))
+	if dir == "." || dir == "/" {
+		return ""
+	}
+	return strings.TrimPrefix(dir, "./")
+}
+
+func statusLetter(status fileSystem.ChangeStatus) string {
+	switch status {
+	case fileSystem.NewFile:
+		return "N"
+	case fileSystem.ModifiedFile:
+		return "M"
+	default:
+		return "U"
+	}
+}
+
+func isRune(key Key, r rune) bool {
+	return key.Type == KeyRune && key.Rune == r
+}
@@ -0,0 +1,90 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package tui
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	enterScreen = "\x1b[?1049h\x1b[?25l"
+	leaveScreen = "\x1b[?25h\x1b[?1049l"
+	// redraw moves to the top left corner, the screen is cleared after the view
+	redraw      = "\x1b[H"
+	clearScreen = "\x1b[J"
+)
+
+// Supported tells whether the interface can be shown, that is when both the
+// input and the output are terminals.
+func Supported(in *os.File, out *os.File) bool {
+	if os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	if _, err := unix.IoctlGetTermios(int(in.Fd()), getTermios); err != nil {
+		return false
+	}
+	_, err := unix.IoctlGetWinsize(int(out.Fd()), unix.TIOCGWINSZ)
+	return err == nil
+}
+
+// Run shows the interface in the alternate screen of the terminal until the
+// user chooses what to do, the terminal is restored before returning.
+func Run(options Options, in *os.File, out *os.File) (Result, error) {
+	restore, err := makeRaw(in)
+	if err != nil {
+		return Result{}, fmt.Errorf("couldn't set up the terminal: %w", err)
+	}
+	defer restore()
+	fmt.Fprint(out, enterScreen)
+	defer fmt.Fprint(out, leaveScreen)
+
+	model := NewModel(options)
+	buffer := make([]byte, 256)
+	for {
+		// the size is read on every draw so resizing the window just works
+		// after the next key
+		if size, err := unix.IoctlGetWinsize(int(out.Fd()), unix.TIOCGWINSZ); err == nil {
+			model.Resize(int(size.Col), int(size.Row))
+		}
+		fmt.Fprint(out, redraw+model.View()+clearScreen)
+
+		read, err := in.Read(buffer)
+		if err != nil {
+			return Result{}, err
+		}
+		for _, key := range ParseKeys(buffer[:read]) {
+			model.Update(key)
+			if result, done := model.Done(); done {
+				return result, nil
+			}
+		}
+	}
+}
+
+// makeRaw puts the terminal in raw mode, reading every key as it is pressed
+// without echoing it, and returns how to restore it.
+func makeRaw(in *os.File) (func(), error) {
+	fd := int(in.Fd())
+	previous, err := unix.IoctlGetTermios(fd, getTermios)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := *previous
+	raw.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	raw.Oflag &^= unix.OPOST
+	raw.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	raw.Cflag &^= unix.CSIZE | unix.PARENB
+	raw.Cflag |= unix.CS8
+	raw.Cc[unix.VMIN] = 1
+	raw.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, setTermios, &raw); err != nil {
+		return nil, err
+	}
+	return func() {
+		_ = unix.IoctlSetTermios(fd, setTermios, previous)
+	}, nil
+}
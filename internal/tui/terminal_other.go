@@ -0,0 +1,19 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package tui
+
+import (
+	"errors"
+	"os"
+)
+
+// Supported tells whether the interface can be shown, it isn't on this
+// operating system.
+func Supported(in *os.File, out *os.File) bool {
+	return false
+}
+
+// Run isn't supported on this operating system.
+func Run(options Options, in *os.File, out *os.File) (Result, error) {
+	return Result{}, errors.New("the terminal interface isn't supported on this operating system")
+}
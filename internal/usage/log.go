@@ -0,0 +1,83 @@
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/afrancoc2000/application-helper-ai/internal/config"
+)
+
+const logFile = "usage.jsonl"
+
+// Log keeps the usage records in a file, one JSON record per line, so a
+// record is never lost by rewriting the file.
+type Log struct {
+	path string
+}
+
+// NewLog returns a Log that keeps the records in the file at path.
+func NewLog(path string) *Log {
+	return &Log{path: path}
+}
+
+// DefaultLog returns the Log in the application config directory.
+func DefaultLog() (*Log, error) {
+	dir, err := config.ConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	return NewLog(filepath.Join(dir, logFile)), nil
+}
+
+// Append adds a record at the end of the log.
+func (l *Log) Append(record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(l.path), 0o700)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(line, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Read returns all the records of the log, none if nothing was logged yet.
+func (l *Log) Read() ([]Record, error) {
+	file, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Record{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	records := []Record{}
+	scanner := bufio.NewScanner(file)
+	for number := 1; scanner.Scan(); number++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		record := Record{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("invalid usage record on line %d of %s: %w", number, l.path, err)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
@@ -0,0 +1,191 @@
+package usage
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/afrancoc2000/application-helper-ai/internal/models"
+)
+
+const (
+	ByDay     Grouping = "day"
+	ByMonth   Grouping = "month"
+	ByModel   Grouping = "model"
+	BySession Grouping = "session"
+)
+
+const dateFormat = "2006-01-02"
+
+// Grouping is how the usage records are added up in a report.
+type Grouping string
+
+// Record is the usage of one turn of a generation, the prompt and every
+// repair query of it.
+type Record struct {
+	Time             time.Time `json:"time"`
+	Session          string    `json:"session"`
+	Deployment       string    `json:"deployment"`
+	Model            string    `json:"model"`
+	PromptTokens     int       `json:"promptTokens"`
+	CompletionTokens int       `json:"completionTokens"`
+	// Cost is in US dollars, nil when the model has no price in the catalog.
+	Cost *float64 `json:"cost,omitempty"`
+	// Estimated is set when the tokens were counted by the application
+	// because the API didn't report them.
+	Estimated bool `json:"estimated,omitempty"`
+}
+
+// NewRecord prices the tokens used by a turn with the price of the
+// deployment at the time of the request.
+func NewRecord(session string, deployment models.Deployment, promptTokens int, completionTokens int, estimated bool) Record {
+	record := Record{
+		Time:             time.Now().UTC(),
+		Session:          session,
+		Deployment:       deployment.Name,
+		Model:            deployment.Model.Name,
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		Estimated:        estimated,
+	}
+	if cost, ok := deployment.Cost(promptTokens, completionTokens); ok {
+		record.Cost = &cost
+	}
+	return record
+}
+
+// Total adds up usage records.
+type Total struct {
+	Key              string
+	Turns            int
+	PromptTokens     int
+	CompletionTokens int
+	Cost             float64
+	// Unpriced is set when some of the tokens had no price, the cost is
+	// lower than what was billed.
+	Unpriced  bool
+	Estimated bool
+}
+
+func (t *Total) Add(record Record) {
+	t.Turns++
+	t.PromptTokens += record.PromptTokens
+	t.CompletionTokens += record.CompletionTokens
+	if record.Cost != nil {
+		t.Cost += *record.Cost
+	} else if record.PromptTokens > 0 || record.CompletionTokens > 0 {
+		t.Unpriced = true
+	}
+	t.Estimated = t.Estimated || record.Estimated
+}
+
+// Combine adds another total to this one.
+func (t *Total) Combine(other Total) {
+	t.Turns += other.Turns
+	t.PromptTokens += other.PromptTokens
+	t.CompletionTokens += other.CompletionTokens
+	t.Cost += other.Cost
+	t.Unpriced = t.Unpriced || other.Unpriced
+	t.Estimated = t.Estimated || other.Estimated
+}
+
+// FormatCost shows the cost in US dollars, marking it when it is incomplete
+// or based on estimated tokens.
+func (t Total) FormatCost() string {
+	cost := fmt.Sprintf("$%.4f", t.Cost)
+	notes := []string{}
+	if t.Unpriced {
+		notes = append(notes, "some models have no price")
+	}
+	if t.Estimated {
+		notes = append(notes, "estimated")
+	}
+	if len(notes) > 0 {
+		cost = fmt.Sprintf("%s (%s)", cost, strings.Join(notes, ", "))
+	}
+	return cost
+}
+
+func (t Total) String() string {
+	return fmt.Sprintf("%d prompt + %d completion tokens, %s", t.PromptTokens, t.CompletionTokens, t.FormatCost())
+}
+
+// Groupings returns the ways the usage can be reported.
+func Groupings() []string {
+	return []string{string(ByDay), string(ByMonth), string(ByModel), string(BySession)}
+}
+
+// ParseGrouping validates the grouping of a report.
+func ParseGrouping(value string) (Grouping, error) {
+	for _, grouping := range Groupings() {
+		if value == grouping {
+			return Grouping(value), nil
+		}
+	}
+	return "", fmt.Errorf("invalid grouping %q, please choose one of these options: %s", value, strings.Join(Groupings(), ", "))
+}
+
+// ParseSince reads the start of a report, either a date like 2024-05-01 or a
+// number of days before now like 30d. An empty value reports everything.
+func ParseSince(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		count, err := strconv.Atoi(days)
+		if err != nil || count < 0 {
+			return time.Time{}, fmt.Errorf("invalid number of days %q", value)
+		}
+		year, month, day := now.Date()
+		return time.Date(year, month, day-count, 0, 0, 0, 0, now.Location()), nil
+	}
+
+	since, err := time.ParseInLocation(dateFormat, value, now.Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, use a date like 2024-05-01 or a number of days like 30d", value)
+	}
+	return since, nil
+}
+
+// Summarize adds up the records made since the given time by day, month,
+// model or session, sorted by key.
+func Summarize(records []Record, since time.Time, grouping Grouping) []Total {
+	totals := map[string]*Total{}
+	for _, record := range records {
+		if record.Time.Before(since) {
+			continue
+		}
+
+		key := groupKey(record, grouping)
+		total, ok := totals[key]
+		if !ok {
+			total = &Total{Key: key}
+			totals[key] = total
+		}
+		total.Add(record)
+	}
+
+	summary := []Total{}
+	for _, total := range totals {
+		summary = append(summary, *total)
+	}
+	sort.Slice(summary, func(i, j int) bool {
+		return summary[i].Key < summary[j].Key
+	})
+	return summary
+}
+
+func groupKey(record Record, grouping Grouping) string {
+	switch grouping {
+	case ByMonth:
+		return record.Time.Local().Format("2006-01")
+	case ByModel:
+		return record.Model
+	case BySession:
+		return record.Session
+	default:
+		return record.Time.Local().Format(dateFormat)
+	}
+}
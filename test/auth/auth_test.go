@@ -0,0 +1,237 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/afrancoc2000/application-helper-ai/internal/auth"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// jwt returns an unsigned token expiring at the given time.
+func jwt(expiresOn time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"aud":"https://cognitiveservices.azure.com","exp":%d}`, expiresOn.Unix())))
+	return "eyJhbGciOiJub25lIn0." + payload + ".signature"
+}
+
+func TestAuth(t *testing.T) {
+	Convey("ParseMethod", t, func() {
+		method, err := auth.ParseMethod("")
+		So(err, ShouldBeNil)
+		So(method, ShouldEqual, auth.KeyMethod)
+
+		method, err = auth.ParseMethod("azure-cli")
+		So(err, ShouldBeNil)
+		So(method, ShouldEqual, auth.AzureCLIMethod)
+
+		_, err = auth.ParseMethod("password")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Client credentials", t, func() {
+		requests := 0
+		expiresIn := 3600
+		var path string
+		var form url.Values
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			_ = r.ParseForm()
+			path, form = r.URL.Path, r.PostForm
+
+			if r.FormValue("client_secret") != "my-secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprint(w, `{"error":"invalid_client","error_description":"Invalid client secret provided."}`)
+				return
+			}
+			fmt.Fprintf(w, `{"token_type":"Bearer","expires_in":%d,"access_token":"token-%d"}`, expiresIn, requests)
+		}))
+		defer server.Close()
+
+		settings := auth.Settings{
+			Method:        auth.ClientCredentialsMethod,
+			TenantID:      "my-tenant",
+			ClientID:      "my-client",
+			ClientSecret:  "my-secret",
+			AuthorityHost: server.URL,
+		}
+
+		Convey("Keeps the token until it is about to expire", func() {
+			provider, err := auth.NewTokenProvider(settings, server.Client())
+			So(err, ShouldBeNil)
+
+			token, err := provider.Token(context.Background())
+			So(err, ShouldBeNil)
+			So(token.Value, ShouldEqual, "token-1")
+			So(token.ExpiresOn, ShouldHappenAfter, time.Now().Add(59*time.Minute))
+			So(path, ShouldEqual, "/my-tenant/oauth2/v2.0/token")
+			So(form.Get("grant_type"), ShouldEqual, "client_credentials")
+			So(form.Get("client_id"), ShouldEqual, "my-client")
+			So(form.Get("scope"), ShouldEqual, auth.Scope)
+
+			token, err = provider.Token(context.Background())
+			So(err, ShouldBeNil)
+			So(token.Value, ShouldEqual, "token-1")
+			So(requests, ShouldEqual, 1)
+		})
+
+		Convey("Renews a token about to expire", func() {
+			expiresIn = 60
+			provider, err := auth.NewTokenProvider(settings, server.Client())
+			So(err, ShouldBeNil)
+
+			_, err = provider.Token(context.Background())
+			So(err, ShouldBeNil)
+			token, err := provider.Token(context.Background())
+			So(err, ShouldBeNil)
+			So(token.Value, ShouldEqual, "token-2")
+		})
+
+		Convey("Reports the error of Azure AD", func() {
+			settings.ClientSecret = "other-secret"
+			provider, err := auth.NewTokenProvider(settings, server.Client())
+			So(err, ShouldBeNil)
+
+			_, err = provider.Token(context.Background())
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "Invalid client secret provided.")
+		})
+
+		Convey("Needs the service principal", func() {
+			settings.ClientSecret = ""
+			_, err := auth.NewTokenProvider(settings, server.Client())
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Managed identity", t, func() {
+		expiresOn := time.Now().Add(time.Hour).Unix()
+		var request *http.Request
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			request = r
+			fmt.Fprintf(w, `{"access_token":"identity-token","expires_on":"%d","resource":%q,"token_type":"Bearer"}`, expiresOn, auth.Resource)
+		}))
+		defer server.Close()
+
+		provider, err := auth.NewTokenProvider(auth.Settings{
+			Method:           auth.ManagedIdentityMethod,
+			ClientID:         "my-identity",
+			IdentityEndpoint: server.URL,
+		}, server.Client())
+		So(err, ShouldBeNil)
+
+		token, err := provider.Token(context.Background())
+		So(err, ShouldBeNil)
+		So(token.Value, ShouldEqual, "identity-token")
+		So(token.ExpiresOn.Unix(), ShouldEqual, expiresOn)
+		So(request.Method, ShouldEqual, http.MethodGet)
+		So(request.Header.Get("Metadata"), ShouldEqual, "true")
+		So(request.URL.Query().Get("resource"), ShouldEqual, auth.Resource)
+		So(request.URL.Query().Get("client_id"), ShouldEqual, "my-identity")
+	})
+
+	Convey("Azure CLI token cache", t, func() {
+		cache := filepath.Join(t.TempDir(), "msal_token_cache.json")
+		write := func(entries string) {
+			So(os.WriteFile(cache, []byte(`{"AccessToken":{`+entries+`},"RefreshToken":{}}`), 0o600), ShouldBeNil)
+		}
+		entry := func(key string, secret string, target string, realm string, expiresOn time.Time) string {
+			return fmt.Sprintf(`%q:{"credential_type":"AccessToken","secret":%q,"target":%q,"realm":%q,"expires_on":"%d"}`,
+				key, secret, target, realm, expiresOn.Unix())
+		}
+		settings := auth.Settings{Method: auth.AzureCLIMethod, TokenCache: cache}
+
+		Convey("Uses the valid Azure OpenAI token", func() {
+			write(entry("management", "management-token", "https://management.core.windows.net//.default", "my-tenant", time.Now().Add(time.Hour)) + "," +
+				entry("expired", "expired-token", auth.Scope, "my-tenant", time.Now().Add(-time.Hour)) + "," +
+				entry("valid", "valid-token", auth.Scope, "my-tenant", time.Now().Add(time.Hour)))
+
+			provider, err := auth.NewTokenProvider(settings, http.DefaultClient)
+			So(err, ShouldBeNil)
+			token, err := provider.Token(context.Background())
+			So(err, ShouldBeNil)
+			So(token.Value, ShouldEqual, "valid-token")
+		})
+
+		Convey("Only uses the tokens of the tenant", func() {
+			write(entry("valid", "valid-token", auth.Scope, "my-tenant", time.Now().Add(time.Hour)))
+			settings.TenantID = "other-tenant"
+
+			provider, err := auth.NewTokenProvider(settings, http.DefaultClient)
+			So(err, ShouldBeNil)
+			_, err = provider.Token(context.Background())
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "az account get-access-token")
+		})
+
+		Convey("Fails without a login", func() {
+			settings.TokenCache = filepath.Join(t.TempDir(), "missing.json")
+
+			provider, err := auth.NewTokenProvider(settings, http.DefaultClient)
+			So(err, ShouldBeNil)
+			_, err = provider.Token(context.Background())
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "az login")
+		})
+	})
+
+	Convey("Environment token", t, func() {
+		provider, err := auth.NewTokenProvider(auth.Settings{Method: auth.EnvironmentMethod}, http.DefaultClient)
+		So(err, ShouldBeNil)
+
+		Convey("Reads the token and its expiration", func() {
+			expiresOn := time.Now().Add(time.Hour).Truncate(time.Second)
+			t.Setenv(auth.TokenVariable, jwt(expiresOn))
+
+			token, err := provider.Token(context.Background())
+			So(err, ShouldBeNil)
+			So(token.Value, ShouldEqual, jwt(expiresOn))
+			So(token.ExpiresOn, ShouldEqual, expiresOn)
+		})
+
+		Convey("Rejects an expired token", func() {
+			t.Setenv(auth.TokenVariable, jwt(time.Now().Add(-time.Minute)))
+
+			_, err := provider.Token(context.Background())
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "expired")
+		})
+
+		Convey("Fails when the variable isn't set", func() {
+			t.Setenv(auth.TokenVariable, "")
+
+			_, err := provider.Token(context.Background())
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Transport", t, func() {
+		var header http.Header
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header = r.Header
+		}))
+		defer server.Close()
+
+		t.Setenv(auth.TokenVariable, "env-token")
+		provider, err := auth.NewTokenProvider(auth.Settings{Method: auth.EnvironmentMethod}, http.DefaultClient)
+		So(err, ShouldBeNil)
+		client := &http.Client{Transport: &auth.Transport{Base: http.DefaultTransport, Tokens: provider}}
+
+		req, err := http.NewRequest(http.MethodPost, server.URL, nil)
+		So(err, ShouldBeNil)
+		req.Header.Set("api-key", "")
+		resp, err := client.Do(req)
+		So(err, ShouldBeNil)
+		resp.Body.Close()
+
+		So(header.Get("Authorization"), ShouldEqual, "Bearer env-token")
+		So(header.Values("api-key"), ShouldBeEmpty)
+	})
+}
@@ -0,0 +1,108 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/afrancoc2000/application-helper-ai/cmd"
+	"github.com/afrancoc2000/application-helper-ai/internal/openai"
+	"github.com/afrancoc2000/application-helper-ai/internal/tokenizer"
+	. "github.com/smartystreets/goconvey/convey"
+	"github.com/spf13/pflag"
+)
+
+// run executes the command line with the given arguments, the flags of a
+// previous run are reset first because the commands are package variables.
+func run(args ...string) error {
+	cmd.RootCmd.PersistentFlags().VisitAll(func(flag *pflag.Flag) {
+		if list, ok := flag.Value.(pflag.SliceValue); ok {
+			_ = list.Replace([]string{})
+		} else {
+			_ = flag.Value.Set(flag.DefValue)
+		}
+		flag.Changed = false
+	})
+	cmd.RootCmd.SetArgs(args)
+	return cmd.RootCmd.Execute()
+}
+
+// offlineTokenizers keeps the tokenizer ranks of the test in a temporary
+// directory and never downloads them, the GPT-3 encoder counts instead.
+func offlineTokenizers(t *testing.T) {
+	t.Setenv(tokenizer.CacheDirVariable, t.TempDir())
+	t.Cleanup(tokenizer.SetDownloader(func(url string) ([]byte, error) {
+		return nil, errors.New("the tests don't download tokenizers")
+	}))
+}
+
+func TestCLI(t *testing.T) {
+	offlineTokenizers(t)
+
+	Convey("CLI", t, func() {
+
+		dir := t.TempDir()
+		t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+		t.Setenv("HOME", dir)
+		prompt := "Create a hello world page"
+
+		Convey("Replays the demo cassette offline", func() {
+			output := filepath.Join(dir, "demo")
+			err := run("--replay", "testdata/hello-world.json", "--skipConfirmation", "--outputDir", output, prompt)
+			So(err, ShouldBeNil)
+
+			content, err := os.ReadFile(filepath.Join(output, "index.html"))
+			So(err, ShouldBeNil)
+			So(string(content), ShouldContainSubstring, "Hello World")
+
+			// replays aren't billed
+			_, err = os.Stat(filepath.Join(dir, "config", "application-ai", "usage.jsonl"))
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
+		Convey("Replays what was recorded", func() {
+			answer := `[{"fileName":"index.html","filePath":"./","fileContent":"<h1>Recorded</h1>"}]`
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", answer)
+				fmt.Fprint(w, "data: [DONE]\n\n")
+			}))
+			cassette := filepath.Join(dir, "cassettes", "recorded.json")
+
+			recorded := filepath.Join(dir, "recorded")
+			err := run("--provider", "ollama", "--baseUrl", server.URL+"/v1", "--openaiDeploymentName", "llama2",
+				"--record", cassette, "--skipConfirmation", "--outputDir", recorded, prompt)
+			server.Close()
+			So(err, ShouldBeNil)
+
+			saved, err := openai.LoadCassette(cassette)
+			So(err, ShouldBeNil)
+			So(saved.Interactions, ShouldHaveLength, 1)
+			So(saved.Interactions[0].Prompt, ShouldEqual, prompt)
+			So(saved.Interactions[0].Answer, ShouldEqual, answer)
+
+			// the server is gone, the answer comes from the cassette
+			replayed := filepath.Join(dir, "replayed")
+			err = run("--replay", cassette, "--provider", "ollama", "--openaiDeploymentName", "llama2", "--skipConfirmation", "--outputDir", replayed, prompt)
+			So(err, ShouldBeNil)
+
+			content, err := os.ReadFile(filepath.Join(replayed, "index.html"))
+			So(err, ShouldBeNil)
+			So(string(content), ShouldEqual, "<h1>Recorded</h1>")
+		})
+
+		Convey("Fails when the prompt doesn't match the cassette", func() {
+			err := run("--replay", "testdata/hello-world.json", "--skipConfirmation", "--outputDir", filepath.Join(dir, "other"), "Create a todo app")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "doesn't match the cassette")
+		})
+
+		Convey("Can't record and replay at the same time", func() {
+			err := run("--replay", "testdata/hello-world.json", "--record", filepath.Join(dir, "new.json"), prompt)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,128 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/afrancoc2000/application-helper-ai/cmd"
+	"github.com/afrancoc2000/application-helper-ai/internal/config"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// settingRow returns the value and source of a setting shown by config view.
+func settingRow(view string, label string) []string {
+	for _, line := range strings.Split(view, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && fields[0] == label {
+			return fields[1:]
+		}
+	}
+	return nil
+}
+
+func TestConfigCommand(t *testing.T) {
+	offlineTokenizers(t)
+
+	Convey("Config command", t, func() {
+
+		dir := t.TempDir()
+		t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+		t.Setenv("HOME", dir)
+		// t.Setenv only restores the variables when the test ends
+		t.Setenv("TEMPERATURE", "")
+		t.Setenv("OPENAI_API_KEY", "my-secret-api-key")
+		configFile := filepath.Join(dir, "config", "application-ai", "config.yaml")
+
+		var out bytes.Buffer
+		cmd.RootCmd.SetOut(&out)
+		defer cmd.RootCmd.SetOut(nil)
+
+		So(run("config", "set", "maxRetries", "5"), ShouldBeNil)
+		So(run("config", "set", "--profile", "azure-prod", "provider", "azure"), ShouldBeNil)
+		So(run("config", "set", "--profile", "azure-prod", "azureOpenaiEndpoint", "https://prod.openai.azure.com/"), ShouldBeNil)
+		So(run("config", "set", "--profile", "azure-prod", "openaiDeploymentName", "gpt-4"), ShouldBeNil)
+		So(run("config", "set", "profile", "azure-prod"), ShouldBeNil)
+		So(out.String(), ShouldContainSubstring, "Set provider in the profile azure-prod of "+configFile)
+
+		Convey("Saves the settings in the config directory", func() {
+			file, err := config.LoadFile(configFile)
+			So(err, ShouldBeNil)
+			So(file.Profile, ShouldEqual, "azure-prod")
+			So(file.Settings, ShouldResemble, map[string]interface{}{config.MaxRetriesLabel: 5})
+			So(file.Profiles["azure-prod"][config.OpenaiDeploymentNameLabel], ShouldEqual, "gpt-4")
+		})
+
+		Convey("Shows where every setting comes from", func() {
+			t.Setenv("TEMPERATURE", "0.7")
+
+			out.Reset()
+			So(run("config", "view", "--outputDir", "site"), ShouldBeNil)
+			view := out.String()
+			So(view, ShouldContainSubstring, "Config file: "+configFile)
+			So(view, ShouldContainSubstring, "Profile:     azure-prod")
+			So(settingRow(view, "provider"), ShouldResemble, []string{"azure", "profile", "azure-prod"})
+			So(settingRow(view, "maxRetries"), ShouldResemble, []string{"5", "config", "file"})
+			So(settingRow(view, "temperature"), ShouldResemble, []string{"0.7", "env", "TEMPERATURE"})
+			So(settingRow(view, "outputDir"), ShouldResemble, []string{"site", "flag", "--outputDir"})
+			So(settingRow(view, "repairAttempts"), ShouldResemble, []string{"2", "default"})
+			So(settingRow(view, "openaiApiKey"), ShouldResemble, []string{"****-key", "env", "OPENAI_API_KEY"})
+			So(view, ShouldNotContainSubstring, "my-secret-api-key")
+		})
+
+		Convey("Removes a setting", func() {
+			out.Reset()
+			So(run("config", "unset", "maxRetries"), ShouldBeNil)
+			So(run("config", "view"), ShouldBeNil)
+			So(settingRow(out.String(), "maxRetries"), ShouldResemble, []string{"3", "default"})
+
+			err := run("config", "unset", "maxRetries")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Rejects an unknown setting", func() {
+			err := run("config", "set", "providr", "azure")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "unknown setting providr")
+		})
+
+		Convey("Refuses to save secrets", func() {
+			err := run("config", "set", "--profile", "azure-prod", "openaiApiKey", "my-secret-api-key")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "application-ai login")
+
+			err = run("config", "set", "azureClientSecret", "my-secret")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "AZURE_CLIENT_SECRET")
+
+			content, err := os.ReadFile(configFile)
+			So(err, ShouldBeNil)
+			So(string(content), ShouldNotContainSubstring, "my-secret")
+		})
+
+		Convey("Validates the profiles", func() {
+			So(run("config", "set", "--profile", "openai-personal", "openaiDeploymentName", "gpt-5"), ShouldBeNil)
+
+			out.Reset()
+			err := run("config", "validate")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "1 invalid profiles out of 2")
+			So(out.String(), ShouldContainSubstring, "profile azure-prod: ok")
+			So(out.String(), ShouldContainSubstring, "profile openai-personal: The specified deployment does not exist")
+
+			out.Reset()
+			So(run("config", "validate", "--profile", "azure-prod"), ShouldBeNil)
+			So(out.String(), ShouldNotContainSubstring, "openai-personal")
+		})
+
+		Convey("Points to the line of an invalid setting", func() {
+			So(os.WriteFile(configFile, []byte("maxRetries: 5\nprovidr: azure\n"), 0o600), ShouldBeNil)
+
+			err := run("config", "validate")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldStartWith, configFile+":2: providr: unknown setting")
+		})
+	})
+}
@@ -0,0 +1,439 @@
+package cli
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/afrancoc2000/application-helper-ai/cmd"
+	"github.com/afrancoc2000/application-helper-ai/internal/keyring"
+	"github.com/afrancoc2000/application-helper-ai/internal/stubserver"
+	"github.com/afrancoc2000/application-helper-ai/internal/usage"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const (
+	apiKey = "test-key"
+	files  = `[{"fileName":"index.html","filePath":"./","fileContent":"<h1>Hello</h1>"}]`
+)
+
+func TestIntegration(t *testing.T) {
+	offlineTokenizers(t)
+
+	Convey("Integration", t, func() {
+
+		dir := t.TempDir()
+		t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+		t.Setenv("HOME", dir)
+		// t.Setenv only restores the variables when the test ends, every
+		// scenario starts without the ones set by the others
+		for _, variable := range []string{"APPLICATION_AI_PROFILE", "APPLICATION_AI_KEYRING", keyring.PassphraseVariable} {
+			t.Setenv(variable, "")
+		}
+		prompt := "Create a hello world page"
+		output := filepath.Join(dir, "app")
+
+		server := stubserver.New()
+		defer server.Close()
+		server.APIKey = apiKey
+
+		openAI := func(deployment string, args ...string) error {
+			return run(append([]string{"--provider", "openai", "--baseUrl", server.OpenAIBaseURL(),
+				"--openaiApiKey", apiKey, "--openaiDeploymentName", deployment, "--retryDelay", "1ms",
+				"--skipConfirmation", "--outputDir", output}, args...)...)
+		}
+		azure := func(deployment string, args ...string) error {
+			return run(append([]string{"--provider", "azure", "--azureOpenaiEndpoint", server.AzureEndpoint(),
+				"--openaiApiKey", apiKey, "--openaiDeploymentName", deployment, "--retryDelay", "1ms",
+				"--skipConfirmation", "--outputDir", output}, args...)...)
+		}
+		generated := func() string {
+			content, err := os.ReadFile(filepath.Join(output, "index.html"))
+			So(err, ShouldBeNil)
+			return string(content)
+		}
+
+		Convey("OpenAI", func() {
+
+			Convey("Streams the files as function arguments", func() {
+				response := stubserver.FunctionAnswer(`{"files":` + files + `}`)
+				response.Chunks = []string{`{"files":`, files[:40], files[40:], `}`}
+				response.ChunkDelay = time.Millisecond
+				response.Usage = &stubserver.Usage{PromptTokens: 120, CompletionTokens: 30, TotalTokens: 150}
+				server.Enqueue(response)
+
+				err := openAI("gpt-4", prompt)
+				So(err, ShouldBeNil)
+				So(generated(), ShouldEqual, "<h1>Hello</h1>")
+
+				requests := server.Requests()
+				So(requests, ShouldHaveLength, 1)
+				So(requests[0].Path, ShouldEqual, "/v1/chat/completions")
+				So(requests[0].Model, ShouldEqual, "gpt-4")
+				So(requests[0].Stream, ShouldBeTrue)
+				So(requests[0].Functions, ShouldHaveLength, 1)
+				So(requests[0].FunctionCall["name"], ShouldEqual, "create_files")
+				So(requests[0].LastMessage(), ShouldEqual, prompt)
+
+				// the usage reported by the API is logged
+				log, err := usage.DefaultLog()
+				So(err, ShouldBeNil)
+				records, err := log.Read()
+				So(err, ShouldBeNil)
+				So(records, ShouldHaveLength, 1)
+				So(records[0].PromptTokens, ShouldEqual, 120)
+				So(records[0].CompletionTokens, ShouldEqual, 30)
+				So(records[0].Estimated, ShouldBeFalse)
+			})
+
+			Convey("Asks for a corrected answer without streaming", func() {
+				server.Enqueue(stubserver.Answer("Here are your files"), stubserver.Answer(files))
+
+				err := openAI("gpt-4", "--structuredOutput=false", prompt)
+				So(err, ShouldBeNil)
+				So(generated(), ShouldEqual, "<h1>Hello</h1>")
+
+				requests := server.Requests()
+				So(requests, ShouldHaveLength, 2)
+				So(requests[0].Stream, ShouldBeTrue)
+				So(requests[0].Functions, ShouldBeEmpty)
+				So(requests[1].Stream, ShouldBeFalse)
+				So(requests[1].LastMessage(), ShouldContainSubstring, "couldn't be parsed")
+			})
+
+			Convey("Shows the rejected answer to a completion model", func() {
+				server.Enqueue(stubserver.Answer("Here are your files"), stubserver.Answer(files))
+
+				err := openAI("text-davinci-003", prompt)
+				So(err, ShouldBeNil)
+				So(generated(), ShouldEqual, "<h1>Hello</h1>")
+
+				requests := server.Requests()
+				So(requests, ShouldHaveLength, 2)
+				prompts := requests[1].Prompt
+				So(prompts[len(prompts)-3], ShouldEqual, prompt)
+				So(prompts[len(prompts)-2], ShouldEqual, "Here are your files")
+				So(prompts[len(prompts)-1], ShouldContainSubstring, "couldn't be parsed")
+			})
+
+			Convey("Calls the engine of a completion model", func() {
+				server.Enqueue(stubserver.Answer(files))
+
+				err := openAI("text-davinci-003", prompt)
+				So(err, ShouldBeNil)
+				So(generated(), ShouldEqual, "<h1>Hello</h1>")
+
+				requests := server.Requests()
+				So(requests, ShouldHaveLength, 1)
+				So(requests[0].Path, ShouldEqual, "/v1/engines/text-davinci-003/completions")
+				So(strings.Join(requests[0].Prompt, "\n"), ShouldContainSubstring, prompt)
+			})
+		})
+
+		Convey("Azure", func() {
+
+			Convey("Streams the files of a chat deployment", func() {
+				server.Enqueue(stubserver.FunctionAnswer(`{"files":` + files + `}`))
+
+				err := azure("gpt-4", prompt)
+				So(err, ShouldBeNil)
+				So(generated(), ShouldEqual, "<h1>Hello</h1>")
+
+				requests := server.Requests()
+				So(requests, ShouldHaveLength, 1)
+				So(requests[0].Path, ShouldEqual, "/openai/deployments/gpt-4/chat/completions")
+				So(requests[0].Azure, ShouldBeTrue)
+				So(requests[0].Header.Get("api-key"), ShouldEqual, apiKey)
+				So(requests[0].Query.Get("api-version"), ShouldNotBeEmpty)
+			})
+
+			Convey("Streams the text of a chat deployment without functions", func() {
+				response := stubserver.Answer(files)
+				response.Chunks = []string{files[:30], files[30:]}
+				server.Enqueue(response)
+
+				err := azure("gpt-4-0314", prompt)
+				So(err, ShouldBeNil)
+				So(generated(), ShouldEqual, "<h1>Hello</h1>")
+				So(server.Requests()[0].Functions, ShouldBeEmpty)
+			})
+
+			Convey("Authenticates with an Azure AD token", func() {
+				server.APIKey = "ad-token"
+				t.Setenv("AZURE_OPENAI_AD_TOKEN", "ad-token")
+				server.Enqueue(stubserver.FunctionAnswer(`{"files":` + files + `}`))
+
+				err := azure("gpt-4", "--azureAuth", "env", prompt)
+				So(err, ShouldBeNil)
+				So(generated(), ShouldEqual, "<h1>Hello</h1>")
+
+				header := server.Requests()[0].Header
+				So(header.Get("Authorization"), ShouldEqual, "Bearer ad-token")
+				So(header.Values("api-key"), ShouldBeEmpty)
+			})
+
+			Convey("Authenticates with a service principal", func() {
+				tokens := 0
+				authority := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					tokens++
+					fmt.Fprint(w, `{"token_type":"Bearer","expires_in":3600,"access_token":"principal-token"}`)
+				}))
+				defer authority.Close()
+				server.APIKey = "principal-token"
+				server.Enqueue(stubserver.Answer("Here are your files"), stubserver.Answer(files))
+
+				err := azure("gpt-4-0314", "--azureAuth", "client-credentials", "--azureAuthorityHost", authority.URL,
+					"--azureTenantId", "my-tenant", "--azureClientId", "my-client", "--azureClientSecret", "my-secret", prompt)
+				So(err, ShouldBeNil)
+				So(generated(), ShouldEqual, "<h1>Hello</h1>")
+
+				// the token is reused by the repair query
+				So(server.Requests(), ShouldHaveLength, 2)
+				So(tokens, ShouldEqual, 1)
+			})
+
+			Convey("Calls a completion deployment", func() {
+				server.Enqueue(stubserver.Answer(files))
+
+				err := azure("text-davinci-003", prompt)
+				So(err, ShouldBeNil)
+				So(generated(), ShouldEqual, "<h1>Hello</h1>")
+				So(server.Requests()[0].Path, ShouldEqual, "/openai/deployments/text-davinci-003/completions")
+			})
+		})
+
+		Convey("Network", func() {
+
+			Convey("Sends the extra headers", func() {
+				server.Enqueue(stubserver.FunctionAnswer(`{"files":` + files + `}`))
+
+				err := azure("gpt-4", "--header", "X-Gateway-Key: 1234", "--header", "X-Team: apps", prompt)
+				So(err, ShouldBeNil)
+
+				header := server.Requests()[0].Header
+				So(header.Get("X-Gateway-Key"), ShouldEqual, "1234")
+				So(header.Get("X-Team"), ShouldEqual, "apps")
+				So(header.Get("api-key"), ShouldEqual, apiKey)
+			})
+
+			Convey("Calls the API through the proxy", func() {
+				server.Enqueue(stubserver.Answer(files))
+
+				// the gateway doesn't exist, only the proxy can reach it
+				err := openAI("text-davinci-003", "--baseUrl", "http://gateway.invalid/v1", "--proxy", server.URL, prompt)
+				So(err, ShouldBeNil)
+				So(generated(), ShouldEqual, "<h1>Hello</h1>")
+				So(server.Requests()[0].Host, ShouldEqual, "gateway.invalid")
+			})
+
+			Convey("Trusts the CA bundle", func() {
+				tlsServer := stubserver.NewTLS()
+				defer tlsServer.Close()
+				tlsServer.Enqueue(stubserver.Answer(files))
+				bundle := filepath.Join(dir, "ca.pem")
+				So(os.WriteFile(bundle, tlsServer.CertificatePEM(), 0o600), ShouldBeNil)
+
+				err := openAI("text-davinci-003", "--baseUrl", tlsServer.OpenAIBaseURL(), "--maxRetries", "0", prompt)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "certificate")
+
+				err = openAI("text-davinci-003", "--baseUrl", tlsServer.OpenAIBaseURL(), "--caBundle", bundle, prompt)
+				So(err, ShouldBeNil)
+				So(generated(), ShouldEqual, "<h1>Hello</h1>")
+			})
+
+			Convey("Gives up on a request slower than the timeout", func() {
+				response := stubserver.Answer(files)
+				response.Delay = time.Second
+				server.Enqueue(response)
+
+				err := azure("text-davinci-003", "--timeout", "50ms", "--maxRetries", "0", prompt)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "Timeout")
+			})
+		})
+
+		Convey("Config file", func() {
+			configFile := filepath.Join(dir, "config.yaml")
+			content := fmt.Sprintf(`skipConfirmation: true
+retryDelay: 1ms
+outputDir: %s
+profile: stub-openai
+profiles:
+  stub-openai:
+    provider: openai
+    baseUrl: %s
+    openaiApiKey: %s
+    openaiDeploymentName: text-davinci-003
+  stub-azure:
+    provider: azure
+    azureOpenaiEndpoint: %s
+    openaiApiKey: %s
+    openaiDeploymentName: gpt-4-0314
+`, output, server.OpenAIBaseURL(), apiKey, server.AzureEndpoint(), apiKey)
+			So(os.WriteFile(configFile, []byte(content), 0o600), ShouldBeNil)
+
+			Convey("Uses the default profile", func() {
+				server.Enqueue(stubserver.Answer(files))
+
+				err := run("--config", configFile, prompt)
+				So(err, ShouldBeNil)
+				So(generated(), ShouldEqual, "<h1>Hello</h1>")
+				So(server.Requests()[0].Path, ShouldEqual, "/v1/engines/text-davinci-003/completions")
+			})
+
+			Convey("Uses the selected profile", func() {
+				server.Enqueue(stubserver.Answer(files))
+
+				t.Setenv("APPLICATION_AI_PROFILE", "stub-azure")
+				err := run("--config", configFile, prompt)
+				So(err, ShouldBeNil)
+				So(server.Requests()[0].Path, ShouldEqual, "/openai/deployments/gpt-4-0314/chat/completions")
+			})
+
+			Convey("Flags override the profile", func() {
+				server.Enqueue(stubserver.Answer(files))
+
+				err := run("--config", configFile, "--profile", "stub-azure", "--openaiDeploymentName", "text-davinci-003", prompt)
+				So(err, ShouldBeNil)
+				So(server.Requests()[0].Path, ShouldEqual, "/openai/deployments/text-davinci-003/completions")
+			})
+
+			Convey("Is found in the config directory", func() {
+				server.Enqueue(stubserver.Answer(files))
+				So(os.MkdirAll(filepath.Join(dir, "config", "application-ai"), 0o700), ShouldBeNil)
+				So(os.Rename(configFile, filepath.Join(dir, "config", "application-ai", "config.yaml")), ShouldBeNil)
+
+				err := run(prompt)
+				So(err, ShouldBeNil)
+				So(generated(), ShouldEqual, "<h1>Hello</h1>")
+			})
+
+			Convey("Fails with an unknown profile", func() {
+				err := run("--config", configFile, "--profile", "azure-prod", prompt)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "stub-azure, stub-openai")
+				So(server.Requests(), ShouldBeEmpty)
+			})
+		})
+
+		Convey("Keyring", func() {
+			for variable, value := range map[string]string{"APPLICATION_AI_KEYRING": "file", keyring.PassphraseVariable: "my passphrase"} {
+				t.Setenv(variable, value)
+			}
+			login := func(key string, args ...string) error {
+				cmd.RootCmd.SetIn(strings.NewReader(key + "\n"))
+				defer cmd.RootCmd.SetIn(nil)
+				return run(append([]string{"login"}, args...)...)
+			}
+			withoutKey := func(args ...string) error {
+				return run(append([]string{"--provider", "azure", "--azureOpenaiEndpoint", server.AzureEndpoint(),
+					"--openaiDeploymentName", "gpt-4-0314", "--retryDelay", "1ms", "--skipConfirmation", "--outputDir", output}, args...)...)
+			}
+
+			Convey("Uses the saved API key", func() {
+				So(login(apiKey), ShouldBeNil)
+				server.Enqueue(stubserver.Answer(files))
+
+				err := withoutKey(prompt)
+				So(err, ShouldBeNil)
+				So(server.Requests()[0].APIKey, ShouldEqual, apiKey)
+
+				// the key file is encrypted
+				content, err := os.ReadFile(filepath.Join(dir, "config", "application-ai", "keyring.json"))
+				So(err, ShouldBeNil)
+				So(string(content), ShouldNotContainSubstring, apiKey)
+			})
+
+			Convey("Saves a key per profile", func() {
+				configFile := filepath.Join(dir, "config.yaml")
+				So(os.WriteFile(configFile, []byte("profiles:\n  prod: {}\n  dev: {}\n"), 0o600), ShouldBeNil)
+				So(login("prod-key", "--config", configFile, "--profile", "prod"), ShouldBeNil)
+				So(login(apiKey, "--config", configFile, "--profile", "dev"), ShouldBeNil)
+				server.Enqueue(stubserver.Answer(files))
+
+				err := withoutKey("--config", configFile, "--profile", "dev", prompt)
+				So(err, ShouldBeNil)
+				So(server.Requests()[0].APIKey, ShouldEqual, apiKey)
+			})
+
+			Convey("Flags and environment variables override the saved key", func() {
+				So(login("saved-key"), ShouldBeNil)
+				server.Enqueue(stubserver.Answer(files))
+
+				err := withoutKey("--openaiApiKey", apiKey, prompt)
+				So(err, ShouldBeNil)
+				So(server.Requests()[0].APIKey, ShouldEqual, apiKey)
+			})
+
+			Convey("Removes the key with logout", func() {
+				So(login(apiKey), ShouldBeNil)
+				So(run("logout"), ShouldBeNil)
+
+				err := run("logout")
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "there's no API key saved for the profile default")
+			})
+
+			Convey("Fails with a wrong passphrase", func() {
+				So(login(apiKey), ShouldBeNil)
+				t.Setenv(keyring.PassphraseVariable, "other passphrase")
+
+				err := withoutKey(prompt)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "the passphrase is wrong")
+				So(server.Requests(), ShouldBeEmpty)
+			})
+		})
+
+		Convey("Errors", func() {
+
+			Convey("Retries a rate limit and a server error", func() {
+				server.Enqueue(
+					stubserver.RateLimited(time.Millisecond),
+					stubserver.Error(http.StatusServiceUnavailable, "server_error", "The server is overloaded"),
+					stubserver.FunctionAnswer(`{"files":`+files+`}`))
+
+				err := openAI("gpt-4", prompt)
+				So(err, ShouldBeNil)
+				So(generated(), ShouldEqual, "<h1>Hello</h1>")
+				So(server.Requests(), ShouldHaveLength, 3)
+			})
+
+			Convey("Gives up after the max retries", func() {
+				server.SetDefault(stubserver.Error(http.StatusBadGateway, "server_error", "Bad gateway"))
+
+				err := azure("gpt-4", "--maxRetries", "2", prompt)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "Bad gateway")
+				So(server.Requests(), ShouldHaveLength, 3)
+			})
+
+			Convey("Doesn't retry an invalid API key", func() {
+				err := openAI("gpt-4", "--openaiApiKey", "other-key", prompt)
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "Incorrect API key provided")
+				So(server.Requests(), ShouldHaveLength, 1)
+			})
+
+			Convey("Doesn't retry a stream cut after a chunk", func() {
+				response := stubserver.Answer(files)
+				response.Chunks = []string{files[:30], files[30:]}
+				response.Disconnect = true
+				server.Enqueue(response)
+
+				err := azure("gpt-4-0314", prompt)
+				So(err, ShouldNotBeNil)
+				So(server.Requests(), ShouldHaveLength, 1)
+
+				_, err = os.Stat(filepath.Join(output, "index.html"))
+				So(os.IsNotExist(err), ShouldBeTrue)
+			})
+		})
+	})
+}
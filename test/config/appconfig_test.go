@@ -1,9 +1,14 @@
 package models
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/afrancoc2000/application-helper-ai/internal/auth"
 	"github.com/afrancoc2000/application-helper-ai/internal/config"
+	fileSystem "github.com/afrancoc2000/application-helper-ai/internal/file_system"
 	"github.com/afrancoc2000/application-helper-ai/internal/models"
 	. "github.com/smartystreets/goconvey/convey"
 	"github.com/spf13/viper"
@@ -29,13 +34,223 @@ func TestAppConfig(t *testing.T) {
 			So(err, ShouldBeNil)
 			So(appConfig.OpenaiApiKey, ShouldEqual, "123456")
 			So(appConfig.OpenaiDeploymentName, ShouldEqual, "gpt-4-0314")
-			So(appConfig.OpenaiDeployment, ShouldEqual, models.Gpt4_0314)
+			So(appConfig.OpenaiDeployment.Name, ShouldEqual, "gpt-4-0314")
+			So(appConfig.OpenaiDeployment.MaxTokens(), ShouldEqual, 8192)
 			So(appConfig.AzureOpenaiEndpoint, ShouldEqual, "https://devsquad-openai-lab.openai.azure.com/")
 			So(appConfig.MaxTokens, ShouldEqual, 1000)
 			So(appConfig.SkipConfirmation, ShouldEqual, true)
 			So(appConfig.Temperature, ShouldEqual, 0.3)
 			So(appConfig.ChatContext, ShouldEqual, "You create html applications")
 			So(appConfig.Choices, ShouldEqual, 1)
+			So(appConfig.ProviderName(), ShouldEqual, config.AzureProvider)
+			So(appConfig.ConflictPolicy, ShouldEqual, fileSystem.FailOnConflict)
+		})
+
+		Convey("Initialize conflict policy", func() {
+			viperConfig.Set(config.SkipConfirmationLabel, "false")
+			appConfig := config.AppConfig{}
+			err := appConfig.Initialize(*viperConfig)
+
+			So(err, ShouldBeNil)
+			So(appConfig.ConflictPolicy, ShouldEqual, fileSystem.PromptOnConflict)
+
+			viperConfig.Set(config.ConflictPolicyLabel, "backup")
+			err = appConfig.Initialize(*viperConfig)
+
+			So(err, ShouldBeNil)
+			So(appConfig.ConflictPolicy, ShouldEqual, fileSystem.BackupOnConflict)
+
+			viperConfig.Set(config.ConflictPolicyLabel, "merge")
+			err = appConfig.Initialize(*viperConfig)
+
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Initialize repair attempts", func() {
+			viperConfig.Set(config.RepairAttemptsLabel, 3)
+			appConfig := config.AppConfig{}
+			err := appConfig.Initialize(*viperConfig)
+
+			So(err, ShouldBeNil)
+			So(appConfig.RepairAttempts, ShouldEqual, 3)
+
+			viperConfig.Set(config.RepairAttemptsLabel, -1)
+			err = appConfig.Initialize(*viperConfig)
+
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Initialize retries", func() {
+			viperConfig.Set(config.MaxRetriesLabel, 5)
+			viperConfig.Set(config.RetryDelayLabel, "500ms")
+			viperConfig.Set(config.RetryMaxDelayLabel, "30s")
+			appConfig := config.AppConfig{}
+			err := appConfig.Initialize(*viperConfig)
+
+			So(err, ShouldBeNil)
+			So(appConfig.MaxRetries, ShouldEqual, 5)
+			So(appConfig.RetryDelay, ShouldEqual, 500*time.Millisecond)
+			So(appConfig.RetryMaxDelay, ShouldEqual, 30*time.Second)
+
+			viperConfig.Set(config.RetryMaxDelayLabel, "100ms")
+			err = appConfig.Initialize(*viperConfig)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "retryMaxDelay can't be smaller than retryDelay")
+
+			viperConfig.Set(config.RetryDelayLabel, "-1s")
+			err = appConfig.Initialize(*viperConfig)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "retryDelay can't be negative")
+
+			viperConfig.Set(config.RetryDelayLabel, "500ms")
+			viperConfig.Set(config.MaxRetriesLabel, -1)
+			viperConfig.Set(config.RetryMaxDelayLabel, "30s")
+			err = appConfig.Initialize(*viperConfig)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Initialize network settings", func() {
+			viperConfig.Set(config.ProxyLabel, "http://proxy.example.com:8080")
+			viperConfig.Set(config.CABundleLabel, "/etc/ssl/gateway.pem")
+			viperConfig.Set(config.HeadersLabel, []string{"X-Gateway-Key: 1234", "X-Team:  apps "})
+			viperConfig.Set(config.TimeoutLabel, "90s")
+			appConfig := config.AppConfig{}
+			err := appConfig.Initialize(*viperConfig)
+
+			So(err, ShouldBeNil)
+			So(appConfig.Proxy, ShouldEqual, "http://proxy.example.com:8080")
+			So(appConfig.CABundle, ShouldEqual, "/etc/ssl/gateway.pem")
+			So(appConfig.Headers, ShouldResemble, map[string]string{"X-Gateway-Key": "1234", "X-Team": "apps"})
+			So(appConfig.Timeout, ShouldEqual, 90*time.Second)
+
+			// environment variables separate the headers with commas
+			viperConfig.Set(config.HeadersLabel, "X-Gateway-Key: 1234,X-Team: apps and tools")
+			err = appConfig.Initialize(*viperConfig)
+			So(err, ShouldBeNil)
+			So(appConfig.Headers, ShouldResemble, map[string]string{"X-Gateway-Key": "1234", "X-Team": "apps and tools"})
+
+			// commas inside the values don't separate headers
+			viperConfig.Set(config.HeadersLabel, "Accept: text/html, application/json,X-Team: apps, tools")
+			err = appConfig.Initialize(*viperConfig)
+			So(err, ShouldBeNil)
+			So(appConfig.Headers, ShouldResemble, map[string]string{"Accept": "text/html, application/json", "X-Team": "apps, tools"})
+
+			viperConfig.Set(config.HeadersLabel, "X-Gateway-Key: 1234\nX-Team: apps, tools\n")
+			err = appConfig.Initialize(*viperConfig)
+			So(err, ShouldBeNil)
+			So(appConfig.Headers, ShouldResemble, map[string]string{"X-Gateway-Key": "1234", "X-Team": "apps, tools"})
+
+			viperConfig.Set(config.HeadersLabel, []string{"X-Gateway-Key"})
+			err = appConfig.Initialize(*viperConfig)
+			So(err, ShouldNotBeNil)
+
+			viperConfig.Set(config.HeadersLabel, []string{})
+			viperConfig.Set(config.ProxyLabel, "proxy.example.com:8080")
+			err = appConfig.Initialize(*viperConfig)
+			So(err, ShouldNotBeNil)
+
+			viperConfig.Set(config.ProxyLabel, "ftp://proxy.example.com")
+			err = appConfig.Initialize(*viperConfig)
+			So(err, ShouldNotBeNil)
+
+			viperConfig.Set(config.ProxyLabel, "")
+			viperConfig.Set(config.TimeoutLabel, "-1s")
+			err = appConfig.Initialize(*viperConfig)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Initialize Azure AD authentication", func() {
+			appConfig := config.AppConfig{}
+			err := appConfig.Initialize(*viperConfig)
+			So(err, ShouldBeNil)
+			So(appConfig.AzureAuth.Method, ShouldEqual, auth.KeyMethod)
+
+			viperConfig.Set(config.AzureAuthLabel, "client-credentials")
+			viperConfig.Set(config.AzureTenantIDLabel, "my-tenant")
+			viperConfig.Set(config.AzureClientIDLabel, "my-client")
+			err = appConfig.Initialize(*viperConfig)
+			So(err, ShouldNotBeNil)
+
+			viperConfig.Set(config.AzureClientSecretLabel, "my-secret")
+			err = appConfig.Initialize(*viperConfig)
+			So(err, ShouldBeNil)
+			So(appConfig.AzureAuth, ShouldResemble, auth.Settings{
+				Method:       auth.ClientCredentialsMethod,
+				TenantID:     "my-tenant",
+				ClientID:     "my-client",
+				ClientSecret: "my-secret",
+			})
+
+			viperConfig.Set(config.AzureAuthLabel, "password")
+			err = appConfig.Initialize(*viperConfig)
+			So(err, ShouldNotBeNil)
+
+			// only Azure accepts Azure AD tokens
+			viperConfig.Set(config.AzureAuthLabel, "env")
+			viperConfig.Set(config.AzureOpenaiEndpointLabel, "")
+			err = appConfig.Initialize(*viperConfig)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Initialize OpenAI provider by default", func() {
+			viperConfig.Set(config.AzureOpenaiEndpointLabel, "")
+			appConfig := config.AppConfig{}
+			err := appConfig.Initialize(*viperConfig)
+
+			So(err, ShouldBeNil)
+			So(appConfig.ProviderName(), ShouldEqual, config.OpenAIProvider)
+		})
+
+		Convey("Initialize unknown deployment", func() {
+			viperConfig.Set(config.OpenaiDeploymentNameLabel, "llama2")
+			appConfig := config.AppConfig{}
+			err := appConfig.Initialize(*viperConfig)
+
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Initialize Azure deployment from the model catalog", func() {
+			path := filepath.Join(t.TempDir(), "models.yaml")
+			err := os.WriteFile(path, []byte("deployments:\n  my-gpt4: gpt-4-32k\n"), 0o600)
+			So(err, ShouldBeNil)
+
+			viperConfig.Set(config.OpenaiDeploymentNameLabel, "my-gpt4")
+			viperConfig.Set(config.ModelCatalogLabel, path)
+			appConfig := config.AppConfig{}
+			err = appConfig.Initialize(*viperConfig)
+
+			So(err, ShouldBeNil)
+			So(appConfig.OpenaiDeployment.String(), ShouldEqual, "my-gpt4")
+			So(appConfig.OpenaiDeployment.MaxTokens(), ShouldEqual, 32768)
+		})
+
+		Convey("Initialize local provider with any model", func() {
+			viperConfig.Set(config.OpenaiDeploymentNameLabel, "llama2")
+			viperConfig.Set(config.ProviderLabel, config.OllamaProvider)
+			viperConfig.Set(config.BaseURLLabel, "http://localhost:8080/v1")
+			appConfig := config.AppConfig{}
+			err := appConfig.Initialize(*viperConfig)
+
+			So(err, ShouldBeNil)
+			So(appConfig.ProviderName(), ShouldEqual, config.OllamaProvider)
+			So(appConfig.OpenaiDeployment, ShouldResemble, models.LocalDeployment("llama2"))
+			So(appConfig.BaseURL, ShouldEqual, "http://localhost:8080/v1")
+		})
+
+		Convey("Initialize registered provider with its capabilities", func() {
+			config.RegisterProvider("llamafile", config.ProviderCapabilities{AnyModel: true})
+			viperConfig.Set(config.OpenaiDeploymentNameLabel, "mistral")
+			viperConfig.Set(config.ProviderLabel, "llamafile")
+			appConfig := config.AppConfig{}
+			err := appConfig.Initialize(*viperConfig)
+
+			So(err, ShouldBeNil)
+			So(appConfig.OpenaiDeployment, ShouldResemble, models.LocalDeployment("mistral"))
+
+			config.RegisterProvider("llamafile", config.ProviderCapabilities{NeedsAPIKey: true})
+			err = appConfig.Initialize(*viperConfig)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "deployment does not exist")
 		})
 	})
 
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/afrancoc2000/application-helper-ai/internal/config"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEditConfigFile(t *testing.T) {
+	Convey("Edit config file", t, func() {
+
+		dir := t.TempDir()
+		read := func(path string) string {
+			content, err := os.ReadFile(path)
+			So(err, ShouldBeNil)
+			return string(content)
+		}
+
+		for _, name := range []string{"config.yaml", "config.toml"} {
+			path := filepath.Join(dir, "new", name)
+
+			Convey("Creates and changes "+name, func() {
+				So(config.SetSetting(path, "", "maxRetries", []string{"5"}), ShouldBeNil)
+				So(config.SetSetting(path, "azure-prod", "provider", []string{"azure"}), ShouldBeNil)
+				So(config.SetSetting(path, "azure-prod", "header", []string{"X-Team: apps", "X-Env: prod"}), ShouldBeNil)
+				So(config.SetSetting(path, "azure-prod", "Temperature", []string{"0.5"}), ShouldBeNil)
+				So(config.SetSetting(path, "", "profile", []string{"azure-prod"}), ShouldBeNil)
+
+				file, err := config.LoadFile(path)
+				So(err, ShouldBeNil)
+				So(file.Profile, ShouldEqual, "azure-prod")
+				So(file.Settings, ShouldResemble, map[string]interface{}{config.MaxRetriesLabel: 5})
+				So(file.Profiles["azure-prod"], ShouldResemble, map[string]interface{}{
+					config.ProviderLabel:    "azure",
+					config.HeadersLabel:     []string{"X-Team: apps", "X-Env: prod"},
+					config.TemperatureLabel: 0.5,
+				})
+
+				So(config.UnsetSetting(path, "azure-prod", "temperature"), ShouldBeNil)
+				So(config.SetSetting(path, "", "maxRetries", []string{"1"}), ShouldBeNil)
+
+				file, err = config.LoadFile(path)
+				So(err, ShouldBeNil)
+				So(file.Settings[config.MaxRetriesLabel], ShouldEqual, 1)
+				So(file.Profiles["azure-prod"], ShouldNotContainKey, config.TemperatureLabel)
+			})
+		}
+
+		Convey("Keeps the comments of a YAML file", func() {
+			path := filepath.Join(dir, "config.yaml")
+			So(os.WriteFile(path, []byte("# my settings\nprofiles:\n  azure-prod:\n    # the deployment of prod\n    openaiDeploymentName: gpt-4\n"), 0o600), ShouldBeNil)
+
+			So(config.SetSetting(path, "azure-prod", "OpenaiDeploymentName", []string{"gpt-4-32k"}), ShouldBeNil)
+			So(read(path), ShouldEqual, "# my settings\nprofiles:\n  azure-prod:\n    # the deployment of prod\n    openaiDeploymentName: gpt-4-32k\n")
+		})
+
+		Convey("Rejects invalid settings without changing the file", func() {
+			path := filepath.Join(dir, "config.yaml")
+			So(os.WriteFile(path, []byte("maxRetries: 5\n"), 0o600), ShouldBeNil)
+
+			err := config.SetSetting(path, "", "maxRetries", []string{"three"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "maxRetries: expected an integer but got three")
+
+			err = config.SetSetting(path, "", "providr", []string{"azure"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldStartWith, "unknown setting providr")
+
+			err = config.SetSetting(path, "", "provider", []string{"azure", "openai"})
+			So(err, ShouldNotBeNil)
+
+			err = config.SetSetting(path, "", "profile", []string{"azure-prod"})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, `the profile "azure-prod" doesn't exist`)
+
+			So(read(path), ShouldEqual, "maxRetries: 5\n")
+		})
+
+		Convey("Fails to unset a setting that isn't set", func() {
+			path := filepath.Join(dir, "config.yaml")
+			So(os.WriteFile(path, []byte("maxRetries: 5\n"), 0o600), ShouldBeNil)
+
+			err := config.UnsetSetting(path, "", "provider")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "provider is not set")
+
+			err = config.UnsetSetting(path, "azure-prod", "maxRetries")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, `the profile "azure-prod"`)
+		})
+	})
+}
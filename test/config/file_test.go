@@ -0,0 +1,156 @@
+package models
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/afrancoc2000/application-helper-ai/internal/config"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const yamlConfig = `# shared by every profile
+skipConfirmation: true
+maxRetries: 5
+profile: azure-prod
+profiles:
+  azure-prod:
+    provider: azure
+    azureOpenaiEndpoint: https://prod.openai.azure.com/
+    openaiDeploymentName: gpt-4
+    header:
+      - "X-Team: apps"
+  openai-personal:
+    provider: openai
+    OpenaiApiKey: sk-personal
+    temperature: 1
+    maxRetries: 0
+    timeout: 2m
+`
+
+const tomlConfig = `skipConfirmation = true
+maxRetries = 5
+profile = "azure-prod"
+
+[profiles.azure-prod]
+provider = "azure"
+azureOpenaiEndpoint = "https://prod.openai.azure.com/"
+openaiDeploymentName = "gpt-4"
+header = ["X-Team: apps"]
+
+[profiles.openai-personal]
+provider = "openai"
+openaiApiKey = "sk-personal"
+temperature = 1
+maxRetries = 0
+timeout = "2m"
+`
+
+func TestConfigFile(t *testing.T) {
+	Convey("Config file", t, func() {
+
+		dir := t.TempDir()
+		write := func(name string, content string) string {
+			path := filepath.Join(dir, name)
+			So(os.WriteFile(path, []byte(content), 0o600), ShouldBeNil)
+			return path
+		}
+
+		for _, example := range []struct{ name, content string }{{"config.yaml", yamlConfig}, {"config.toml", tomlConfig}} {
+			name := example.name
+			path := write(name, example.content)
+
+			Convey("Resolves the profiles of "+name, func() {
+				file, err := config.LoadFile(path)
+				So(err, ShouldBeNil)
+				So(file.ProfileNames(), ShouldResemble, []string{"azure-prod", "openai-personal"})
+
+				// the default profile
+				settings, err := file.Resolve("")
+				So(err, ShouldBeNil)
+				So(settings, ShouldResemble, map[string]interface{}{
+					config.SkipConfirmationLabel:     true,
+					config.MaxRetriesLabel:           5,
+					config.ProviderLabel:             "azure",
+					config.AzureOpenaiEndpointLabel:  "https://prod.openai.azure.com/",
+					config.OpenaiDeploymentNameLabel: "gpt-4",
+					config.HeadersLabel:              []string{"X-Team: apps"},
+				})
+
+				settings, err = file.Resolve("openai-personal")
+				So(err, ShouldBeNil)
+				So(settings, ShouldResemble, map[string]interface{}{
+					config.SkipConfirmationLabel: true,
+					config.MaxRetriesLabel:       0,
+					config.ProviderLabel:         "openai",
+					config.OpenaiApiKeyLabel:     "sk-personal",
+					config.TemperatureLabel:      1.0,
+					config.TimeoutLabel:          "2m",
+				})
+
+				_, err = file.Resolve("azure-dev")
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "azure-prod, openai-personal")
+			})
+		}
+
+		Convey("Points to an unknown setting", func() {
+			path := write("config.yaml", "profiles:\n  azure-prod:\n    provider: azure\n    providr: openai\n")
+
+			_, err := config.LoadFile(path)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldStartWith, path+":4: profiles.azure-prod.providr: unknown setting")
+		})
+
+		Convey("Points to a value of the wrong type", func() {
+			path := write("config.yaml", "skipConfirmation: true\nmaxRetries: three\n")
+
+			_, err := config.LoadFile(path)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, path+":2: maxRetries: expected an integer but got three")
+
+			path = write("config.toml", "[profiles.slow]\ntimeout = 30\n")
+			_, err = config.LoadFile(path)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, path+": profiles.slow.timeout: expected a duration like 30s or 2m but got 30")
+		})
+
+		Convey("Fails when the default profile doesn't exist", func() {
+			path := write("config.yaml", "profile: azure-prod\n")
+
+			_, err := config.LoadFile(path)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, `the profile "azure-prod" doesn't exist`)
+		})
+
+		Convey("Reads an empty file", func() {
+			file, err := config.LoadFile(write("config.yaml", ""))
+			So(err, ShouldBeNil)
+			settings, err := file.Resolve("")
+			So(err, ShouldBeNil)
+			So(settings, ShouldBeEmpty)
+		})
+
+		Convey("Reads profiles without settings", func() {
+			for name, content := range map[string]string{"config.yaml": "profiles:\n  prod: {}\n", "config.toml": "[profiles.prod]\n"} {
+				file, err := config.LoadFile(write(name, content))
+				So(err, ShouldBeNil)
+				So(file.ProfileNames(), ShouldResemble, []string{"prod"})
+			}
+		})
+
+		Convey("Only reads YAML and TOML", func() {
+			_, err := config.LoadFile(write("config.json", "{}"))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Finds the file in the config directory", func() {
+			t.Setenv("XDG_CONFIG_HOME", dir)
+			So(config.DefaultFile(), ShouldBeEmpty)
+
+			So(os.MkdirAll(filepath.Join(dir, "application-ai"), 0o700), ShouldBeNil)
+			path := write(filepath.Join("application-ai", "config.toml"), tomlConfig)
+			So(config.DefaultFile(), ShouldEqual, path)
+		})
+	})
+}
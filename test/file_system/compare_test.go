@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	fileSystem "github.com/afrancoc2000/application-helper-ai/internal/file_system"
+	"github.com/afrancoc2000/application-helper-ai/internal/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCompareFiles(t *testing.T) {
+	Convey("CompareFiles", t, func() {
+
+		root := t.TempDir()
+		factory := fileSystem.NewFileFactory(root, fileSystem.FailOnConflict, nil)
+
+		err := os.WriteFile(filepath.Join(root, "main.tf"), []byte("a\nb\nc\n"), 0o644)
+		So(err, ShouldBeNil)
+		err = os.WriteFile(filepath.Join(root, "README.md"), []byte("# app\n"), 0o644)
+		So(err, ShouldBeNil)
+
+		changes, err := factory.CompareFiles([]models.AppFile{
+			{Name: "main.tf", Path: "./", Content: "a\nB\nc\n"},
+			{Name: "README.md", Path: "./", Content: "# app\n"},
+			{Name: "index.js", Path: "./src/", Content: "x\n"},
+		})
+		So(err, ShouldBeNil)
+		So(len(changes), ShouldEqual, 3)
+
+		Convey("Status", func() {
+			So(changes[0].Status, ShouldEqual, fileSystem.ModifiedFile)
+			So(changes[0].Previous, ShouldEqual, "a\nb\nc\n")
+			So(changes[1].Status, ShouldEqual, fileSystem.UnchangedFile)
+			So(changes[2].Status, ShouldEqual, fileSystem.NewFile)
+			So(changes[2].Status.String(), ShouldEqual, "new")
+			So(changes[2].Target, ShouldEqual, filepath.Join(root, "src", "index.js"))
+		})
+
+		Convey("UnifiedDiff modified file", func() {
+			diff, err := changes[0].UnifiedDiff()
+			So(err, ShouldBeNil)
+			So(diff, ShouldEqual, "--- a/main.tf\n+++ b/main.tf\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n")
+		})
+
+		Convey("UnifiedDiff new file", func() {
+			diff, err := changes[2].UnifiedDiff()
+			So(err, ShouldBeNil)
+			So(diff, ShouldEqual, "--- /dev/null\n+++ b/src/index.js\n@@ -0,0 +1 @@\n+x\n")
+		})
+
+		Convey("does not write files", func() {
+			_, err := os.Stat(filepath.Join(root, "src"))
+			So(os.IsNotExist(err), ShouldEqual, true)
+		})
+	})
+
+}
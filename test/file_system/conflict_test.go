@@ -0,0 +1,110 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	fileSystem "github.com/afrancoc2000/application-helper-ai/internal/file_system"
+	"github.com/afrancoc2000/application-helper-ai/internal/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConflictPolicy(t *testing.T) {
+	Convey("ConflictPolicy", t, func() {
+
+		root := t.TempDir()
+		err := os.WriteFile(filepath.Join(root, "main.tf"), []byte("hand written"), 0o644)
+		So(err, ShouldBeNil)
+		err = os.WriteFile(filepath.Join(root, "README.md"), []byte("# app"), 0o644)
+		So(err, ShouldBeNil)
+
+		files := []models.AppFile{
+			{Name: "main.tf", Path: "./", Content: "generated"},
+			{Name: "README.md", Path: "./", Content: "# app"},
+			{Name: "variables.tf", Path: "./", Content: "variable"},
+		}
+
+		read := func(name string) string {
+			content, err := os.ReadFile(filepath.Join(root, name))
+			So(err, ShouldBeNil)
+			return string(content)
+		}
+
+		Convey("ParseConflictPolicy", func() {
+			policy, err := fileSystem.ParseConflictPolicy("backup")
+			So(err, ShouldBeNil)
+			So(policy, ShouldEqual, fileSystem.BackupOnConflict)
+
+			_, err = fileSystem.ParseConflictPolicy("merge")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "prompt-per-file")
+		})
+
+		Convey("fail", func() {
+			factory := fileSystem.NewFileFactory(root, fileSystem.FailOnConflict, nil)
+			_, err := factory.CreateFiles(files)
+
+			var conflictErr *fileSystem.ConflictError
+			So(errors.As(err, &conflictErr), ShouldEqual, true)
+			So(len(conflictErr.Files), ShouldEqual, 1)
+			So(conflictErr.Files[0].File.Name, ShouldEqual, "main.tf")
+			So(read("main.tf"), ShouldEqual, "hand written")
+			_, err = os.Stat(filepath.Join(root, "variables.tf"))
+			So(os.IsNotExist(err), ShouldEqual, true)
+		})
+
+		Convey("skip", func() {
+			factory := fileSystem.NewFileFactory(root, fileSystem.SkipOnConflict, nil)
+			results, err := factory.CreateFiles(files)
+
+			So(err, ShouldBeNil)
+			So(results[0].Action, ShouldEqual, fileSystem.SkippedFile)
+			So(results[1].Action, ShouldEqual, fileSystem.KeptFile)
+			So(results[2].Action, ShouldEqual, fileSystem.CreatedFile)
+			So(read("main.tf"), ShouldEqual, "hand written")
+			So(read("variables.tf"), ShouldEqual, "variable")
+		})
+
+		Convey("overwrite", func() {
+			factory := fileSystem.NewFileFactory(root, fileSystem.OverwriteOnConflict, nil)
+			results, err := factory.CreateFiles(files)
+
+			So(err, ShouldBeNil)
+			So(results[0].Action, ShouldEqual, fileSystem.OverwrittenFile)
+			So(read("main.tf"), ShouldEqual, "generated")
+		})
+
+		Convey("backup", func() {
+			err := os.WriteFile(filepath.Join(root, "main.tf.bak"), []byte("older"), 0o644)
+			So(err, ShouldBeNil)
+
+			factory := fileSystem.NewFileFactory(root, fileSystem.BackupOnConflict, nil)
+			results, err := factory.CreateFiles(files)
+
+			So(err, ShouldBeNil)
+			So(results[0].Action, ShouldEqual, fileSystem.BackedUpFile)
+			So(results[0].Backup, ShouldEqual, filepath.Join(root, "main.tf.bak.1"))
+			So(read("main.tf"), ShouldEqual, "generated")
+			So(read("main.tf.bak.1"), ShouldEqual, "hand written")
+			So(read("main.tf.bak"), ShouldEqual, "older")
+		})
+
+		Convey("prompt-per-file", func() {
+			asked := []string{}
+			prompt := func(change fileSystem.FileChange) (fileSystem.ConflictPolicy, error) {
+				asked = append(asked, change.File.Name)
+				return fileSystem.OverwriteOnConflict, nil
+			}
+			factory := fileSystem.NewFileFactory(root, fileSystem.PromptOnConflict, prompt)
+			results, err := factory.CreateFiles(files)
+
+			So(err, ShouldBeNil)
+			So(asked, ShouldResemble, []string{"main.tf"})
+			So(results[0].Action, ShouldEqual, fileSystem.OverwrittenFile)
+			So(read("main.tf"), ShouldEqual, "generated")
+		})
+	})
+
+}
@@ -0,0 +1,112 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	fileSystem "github.com/afrancoc2000/application-helper-ai/internal/file_system"
+	"github.com/afrancoc2000/application-helper-ai/internal/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFileFactory(t *testing.T) {
+	Convey("FileFactory", t, func() {
+
+		root := t.TempDir()
+		factory := fileSystem.NewFileFactory(root, fileSystem.FailOnConflict, nil)
+
+		Convey("CreateFiles inside the output directory", func() {
+			_, err := factory.CreateFiles([]models.AppFile{
+				{Name: "main.tf", Path: "./", Content: "provider"},
+				{Name: "index.js", Path: "./src", Content: "console.log()"},
+				{Name: "app.css", Path: `.\styles\`, Content: "body {}"},
+			})
+			So(err, ShouldBeNil)
+
+			content, err := os.ReadFile(filepath.Join(root, "main.tf"))
+			So(err, ShouldBeNil)
+			So(string(content), ShouldEqual, "provider")
+
+			content, err = os.ReadFile(filepath.Join(root, "src", "index.js"))
+			So(err, ShouldBeNil)
+			So(string(content), ShouldEqual, "console.log()")
+
+			content, err = os.ReadFile(filepath.Join(root, "styles", "app.css"))
+			So(err, ShouldBeNil)
+			So(string(content), ShouldEqual, "body {}")
+		})
+
+		Convey("CreateFiles creates a missing output directory", func() {
+			output := filepath.Join(root, "new", "app")
+			factory := fileSystem.NewFileFactory(output, fileSystem.FailOnConflict, nil)
+			_, err := factory.CreateFiles([]models.AppFile{{Name: "index.html", Path: "./", Content: "<html></html>"}})
+			So(err, ShouldBeNil)
+
+			content, err := os.ReadFile(filepath.Join(output, "index.html"))
+			So(err, ShouldBeNil)
+			So(string(content), ShouldEqual, "<html></html>")
+		})
+
+		Convey("CreateFiles rejects unsafe files before writing", func() {
+			outside := t.TempDir()
+			err := os.Symlink(outside, filepath.Join(root, "link"))
+			So(err, ShouldBeNil)
+
+			_, err = factory.CreateFiles([]models.AppFile{
+				{Name: "main.tf", Path: "./", Content: "provider"},
+				{Name: "authorized_keys", Path: "../../.ssh/", Content: "key"},
+				{Name: "passwd", Path: "/etc/", Content: "root"},
+				{Name: "escape.txt", Path: "./link/", Content: "escape"},
+				{Name: "", Path: "./", Content: "nothing"},
+			})
+
+			var unsafeErr *fileSystem.UnsafePathError
+			So(errors.As(err, &unsafeErr), ShouldEqual, true)
+			So(len(unsafeErr.Files), ShouldEqual, 4)
+			So(unsafeErr.Files[0].Reason, ShouldEqual, "the path escapes the output directory")
+			So(unsafeErr.Files[1].Reason, ShouldEqual, "absolute paths are not allowed")
+			So(unsafeErr.Files[2].Reason, ShouldEqual, "a symbolic link points outside of the output directory")
+			So(unsafeErr.Files[3].Reason, ShouldEqual, "the file name is empty")
+			So(err.Error(), ShouldContainSubstring, "../../.ssh/authorized_keys")
+
+			_, err = os.Stat(filepath.Join(root, "main.tf"))
+			So(os.IsNotExist(err), ShouldEqual, true)
+			_, err = os.Stat(filepath.Join(outside, "escape.txt"))
+			So(os.IsNotExist(err), ShouldEqual, true)
+		})
+
+		Convey("CreateFiles rejects files written to the same place", func() {
+			err := os.Symlink(root, filepath.Join(root, "self"))
+			So(err, ShouldBeNil)
+
+			_, err = factory.CreateFiles([]models.AppFile{
+				{Name: "index.js", Path: "./src/", Content: "first"},
+				{Name: "index.js", Path: `.\src\lib\..\`, Content: "second"},
+				{Name: "self", Path: "./", Content: "root"},
+			})
+
+			var unsafeErr *fileSystem.UnsafePathError
+			So(errors.As(err, &unsafeErr), ShouldEqual, true)
+			So(len(unsafeErr.Files), ShouldEqual, 2)
+			So(unsafeErr.Files[0].File.Content, ShouldEqual, "second")
+			So(unsafeErr.Files[0].Reason, ShouldEqual, "./src/index.js is written to the same file")
+			So(unsafeErr.Files[1].Reason, ShouldEqual, "a symbolic link points to the output directory itself")
+
+			_, err = os.Stat(filepath.Join(root, "src", "index.js"))
+			So(os.IsNotExist(err), ShouldEqual, true)
+		})
+
+		Convey("CreateFiles allows dots that stay inside", func() {
+			_, err := factory.CreateFiles([]models.AppFile{
+				{Name: "../index.js", Path: "./src/lib/", Content: "x"},
+			})
+			So(err, ShouldBeNil)
+
+			_, err = os.Stat(filepath.Join(root, "src", "index.js"))
+			So(err, ShouldBeNil)
+		})
+	})
+
+}
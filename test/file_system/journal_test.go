@@ -0,0 +1,134 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	fileSystem "github.com/afrancoc2000/application-helper-ai/internal/file_system"
+	"github.com/afrancoc2000/application-helper-ai/internal/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestJournal(t *testing.T) {
+	Convey("Journal", t, func() {
+
+		root := t.TempDir()
+		err := os.WriteFile(filepath.Join(root, "main.tf"), []byte("hand written"), 0o644)
+		So(err, ShouldBeNil)
+		err = os.WriteFile(filepath.Join(root, "variables.tf"), []byte("variables"), 0o644)
+		So(err, ShouldBeNil)
+
+		files := []models.AppFile{
+			{Name: "main.tf", Path: "./", Content: "generated"},
+			{Name: "index.js", Path: "./src/lib/", Content: "x"},
+		}
+
+		exists := func(path string) bool {
+			_, err := os.Lstat(filepath.Join(root, path))
+			return err == nil
+		}
+		read := func(path string) string {
+			content, err := os.ReadFile(filepath.Join(root, path))
+			So(err, ShouldBeNil)
+			return string(content)
+		}
+
+		Convey("Undo without applies", func() {
+			_, err := fileSystem.Undo(root)
+			So(errors.Is(err, fileSystem.ErrNothingToUndo), ShouldEqual, true)
+		})
+
+		Convey("Undo overwritten and created files", func() {
+			factory := fileSystem.NewFileFactory(root, fileSystem.OverwriteOnConflict, nil)
+			_, err := factory.CreateFiles(files)
+			So(err, ShouldBeNil)
+			So(read("main.tf"), ShouldEqual, "generated")
+
+			entry, err := fileSystem.Undo(root)
+			So(err, ShouldBeNil)
+			So(len(entry.Files), ShouldEqual, 2)
+			So(entry.Directories, ShouldResemble, []string{"src", filepath.Join("src", "lib")})
+
+			So(read("main.tf"), ShouldEqual, "hand written")
+			So(read("variables.tf"), ShouldEqual, "variables")
+			So(exists("src"), ShouldEqual, false)
+
+			_, err = fileSystem.Undo(root)
+			So(errors.Is(err, fileSystem.ErrNothingToUndo), ShouldEqual, true)
+		})
+
+		Convey("Undo keeps the mode of overwritten files", func() {
+			err := os.WriteFile(filepath.Join(root, "run.sh"), []byte("echo old"), 0o750)
+			So(err, ShouldBeNil)
+			err = os.Chmod(filepath.Join(root, "run.sh"), 0o750)
+			So(err, ShouldBeNil)
+
+			factory := fileSystem.NewFileFactory(root, fileSystem.OverwriteOnConflict, nil)
+			_, err = factory.CreateFiles([]models.AppFile{{Name: "run.sh", Path: "./", Content: "echo new"}})
+			So(err, ShouldBeNil)
+			// the mode of the applied file doesn't matter, the one recorded is restored
+			err = os.Chmod(filepath.Join(root, "run.sh"), 0o666)
+			So(err, ShouldBeNil)
+
+			_, err = fileSystem.Undo(root)
+			So(err, ShouldBeNil)
+			So(read("run.sh"), ShouldEqual, "echo old")
+			info, err := os.Stat(filepath.Join(root, "run.sh"))
+			So(err, ShouldBeNil)
+			So(info.Mode().Perm(), ShouldEqual, os.FileMode(0o750))
+		})
+
+		Convey("Undo backed up files", func() {
+			factory := fileSystem.NewFileFactory(root, fileSystem.BackupOnConflict, nil)
+			_, err := factory.CreateFiles(files)
+			So(err, ShouldBeNil)
+			So(exists("main.tf.bak"), ShouldEqual, true)
+
+			_, err = fileSystem.Undo(root)
+			So(err, ShouldBeNil)
+			So(read("main.tf"), ShouldEqual, "hand written")
+			So(exists("main.tf.bak"), ShouldEqual, false)
+		})
+
+		Convey("Undo applies in reverse order", func() {
+			factory := fileSystem.NewFileFactory(root, fileSystem.OverwriteOnConflict, nil)
+			_, err := factory.CreateFiles(files)
+			So(err, ShouldBeNil)
+			_, err = factory.CreateFiles([]models.AppFile{{Name: "main.tf", Path: "./", Content: "second"}})
+			So(err, ShouldBeNil)
+
+			_, err = fileSystem.Undo(root)
+			So(err, ShouldBeNil)
+			So(read("main.tf"), ShouldEqual, "generated")
+
+			_, err = fileSystem.Undo(root)
+			So(err, ShouldBeNil)
+			So(read("main.tf"), ShouldEqual, "hand written")
+		})
+
+		Convey("Undo refuses when files were modified", func() {
+			factory := fileSystem.NewFileFactory(root, fileSystem.OverwriteOnConflict, nil)
+			_, err := factory.CreateFiles(files)
+			So(err, ShouldBeNil)
+			err = os.WriteFile(filepath.Join(root, "src", "lib", "index.js"), []byte("edited"), 0o644)
+			So(err, ShouldBeNil)
+
+			_, err = fileSystem.Undo(root)
+			var modifiedErr *fileSystem.ModifiedFilesError
+			So(errors.As(err, &modifiedErr), ShouldEqual, true)
+			So(modifiedErr.Files, ShouldResemble, []string{filepath.Join("src", "lib", "index.js")})
+			So(read("main.tf"), ShouldEqual, "generated")
+		})
+
+		Convey("CreateFiles rejects the state directory", func() {
+			factory := fileSystem.NewFileFactory(root, fileSystem.OverwriteOnConflict, nil)
+			_, err := factory.CreateFiles([]models.AppFile{{Name: "x.json", Path: "./.application-ai/journal/", Content: "{}"}})
+
+			var unsafeErr *fileSystem.UnsafePathError
+			So(errors.As(err, &unsafeErr), ShouldEqual, true)
+		})
+	})
+
+}
@@ -0,0 +1,80 @@
+package keyring
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/afrancoc2000/application-helper-ai/internal/keyring"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestKeyring(t *testing.T) {
+	Convey("ParseBackend", t, func() {
+		backend, err := keyring.ParseBackend("")
+		So(err, ShouldBeNil)
+		So(backend, ShouldEqual, keyring.AutoBackend)
+
+		backend, err = keyring.ParseBackend("file")
+		So(err, ShouldBeNil)
+		So(backend, ShouldEqual, keyring.FileBackend)
+
+		_, err = keyring.ParseBackend("vault")
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("File store", t, func() {
+		path := filepath.Join(t.TempDir(), "keyring.json")
+		asked := 0
+		passphrase := func(secret string) func() (string, error) {
+			return func() (string, error) {
+				asked++
+				return secret, nil
+			}
+		}
+		store := keyring.NewFileStore(path, passphrase("my passphrase"))
+
+		Convey("Doesn't ask the passphrase without a file", func() {
+			_, err := store.Get("prod")
+			So(errors.Is(err, keyring.ErrNotFound), ShouldBeTrue)
+			So(asked, ShouldEqual, 0)
+		})
+
+		Convey("Keeps a key per profile", func() {
+			So(store.Set("prod", "sk-prod"), ShouldBeNil)
+			So(store.Set("", "sk-default"), ShouldBeNil)
+			So(asked, ShouldEqual, 1)
+
+			reopened := keyring.NewFileStore(path, passphrase("my passphrase"))
+			key, err := reopened.Get("prod")
+			So(err, ShouldBeNil)
+			So(key, ShouldEqual, "sk-prod")
+			key, err = reopened.Get(keyring.DefaultProfile)
+			So(err, ShouldBeNil)
+			So(key, ShouldEqual, "sk-default")
+
+			So(reopened.Delete("prod"), ShouldBeNil)
+			_, err = reopened.Get("prod")
+			So(errors.Is(err, keyring.ErrNotFound), ShouldBeTrue)
+			So(errors.Is(reopened.Delete("prod"), keyring.ErrNotFound), ShouldBeTrue)
+
+			info, err := os.Stat(path)
+			So(err, ShouldBeNil)
+			So(info.Mode().Perm(), ShouldEqual, os.FileMode(0o600))
+		})
+
+		Convey("Encrypts the keys", func() {
+			So(store.Set("prod", "sk-prod"), ShouldBeNil)
+
+			content, err := os.ReadFile(path)
+			So(err, ShouldBeNil)
+			So(string(content), ShouldNotContainSubstring, "sk-prod")
+			So(string(content), ShouldNotContainSubstring, "prod")
+
+			_, err = keyring.NewFileStore(path, passphrase("other passphrase")).Get("prod")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "the passphrase is wrong")
+		})
+	})
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/afrancoc2000/application-helper-ai/internal/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseAppFiles(t *testing.T) {
+	Convey("ParseAppFiles", t, func() {
+
+		Convey("Valid answer", func() {
+			files, repairs, err := models.ParseAppFiles(`[{"fileName":"index.html","filePath":"./","fileContent":"<html></html>"}]`)
+			So(err, ShouldBeNil)
+			So(len(files), ShouldEqual, 1)
+			So(repairs, ShouldBeEmpty)
+		})
+
+		Convey("Markdown fences and prose", func() {
+			answer := "Sure! Here are the files:\n```json\n" +
+				`[{"fileName":"README.md","filePath":"./","fileContent":"Run it with` + "\n```shell\\nnpm start\\n```" + `"}]` +
+				"\n```\nLet me know if you need anything else."
+			files, repairs, err := models.ParseAppFiles(answer)
+			So(err, ShouldBeNil)
+			So(len(files), ShouldEqual, 1)
+			So(files[0].Content, ShouldEqual, "Run it with\n```shell\nnpm start\n```")
+			So(repairs, ShouldResemble, []models.Repair{models.StrippedFences, models.StrippedProse, models.EscapedCharacters})
+		})
+
+		Convey("Only fences", func() {
+			answer := "```json\n[{\"fileName\":\"main.go\",\"filePath\":\"./\",\"fileContent\":\"package main\"}]\n```"
+			files, repairs, err := models.ParseAppFiles(answer)
+			So(err, ShouldBeNil)
+			So(files[0].Name, ShouldEqual, "main.go")
+			So(repairs, ShouldResemble, []models.Repair{models.StrippedFences})
+		})
+
+		Convey("Brackets in the prose", func() {
+			answer := "The files [as requested]:\n[{\"fileName\":\"main.go\",\"filePath\":\"./\",\"fileContent\":\"x := []int{}\"}]"
+			files, repairs, err := models.ParseAppFiles(answer)
+			So(err, ShouldBeNil)
+			So(files[0].Content, ShouldEqual, "x := []int{}")
+			So(repairs, ShouldResemble, []models.Repair{models.StrippedProse})
+		})
+
+		Convey("Trailing commas", func() {
+			answer := `[{"fileName":"a.txt","filePath":"./","fileContent":"a, ]",}, {"fileName":"b.txt","filePath":"./","fileContent":"b"},]`
+			files, repairs, err := models.ParseAppFiles(answer)
+			So(err, ShouldBeNil)
+			So(len(files), ShouldEqual, 2)
+			So(files[0].Content, ShouldEqual, "a, ]")
+			So(repairs, ShouldResemble, []models.Repair{models.RemovedCommas})
+		})
+
+		Convey("Unescaped new lines and backslashes", func() {
+			answer := "[{\"fileName\":\"main.py\",\"filePath\":\"./\",\"fileContent\":\"import re\n\tpattern = re.compile('\\d+')\"}]"
+			files, repairs, err := models.ParseAppFiles(answer)
+			So(err, ShouldBeNil)
+			So(files[0].Content, ShouldEqual, "import re\n\tpattern = re.compile('\\d+')")
+			So(repairs, ShouldResemble, []models.Repair{models.EscapedCharacters, models.EscapedBackslash})
+		})
+
+		Convey("Truncated answer", func() {
+			answer := `[{"fileName":"a.txt","filePath":"./","fileContent":"a"}, {"fileName":"b.txt","filePath":"./","fileCon`
+			files, repairs, err := models.ParseAppFiles(answer)
+			So(err, ShouldBeNil)
+			So(len(files), ShouldEqual, 1)
+			So(files[0].Name, ShouldEqual, "a.txt")
+			So(repairs, ShouldResemble, []models.Repair{models.DroppedTruncated})
+		})
+
+		Convey("Truncated before the first file", func() {
+			_, _, err := models.ParseAppFiles(`[{"fileName":"a.txt","filePath":"./","fileContent":"a`)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "cut off")
+		})
+
+		Convey("No array", func() {
+			_, _, err := models.ParseAppFiles("I can't help with that.")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "Couldn't parse OpenAI response")
+		})
+	})
+
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/afrancoc2000/application-helper-ai/internal/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAppFileStreamDecoder(t *testing.T) {
+	Convey("AppFileStreamDecoder", t, func() {
+
+		events := []models.AppFileEvent{}
+		decoder := models.NewAppFileStreamDecoder(func(event models.AppFileEvent) {
+			events = append(events, event)
+		})
+
+		content := func(index int) string {
+			text := ""
+			for _, event := range events {
+				if event.Kind == models.FieldFragment && event.Index == index {
+					text += event.Text
+				}
+			}
+			return text
+		}
+
+		Convey("decodes files split across chunks", func() {
+			chunks := []string{
+				`[{"fileName":"ind`, `ex.html","filePath":"./"`, `,"fileContent":"<p>\"hi\"</p>\`,
+				`n"},{"fileName":"a.js","filePath":"./src/","fileContent":"caf\u00`, `e9 😀"}]`,
+			}
+			for _, chunk := range chunks {
+				decoder.Write(chunk)
+			}
+
+			So(events[0].Kind, ShouldEqual, models.FileStarted)
+			So(events[1], ShouldResemble, models.AppFileEvent{Kind: models.FieldCompleted, Index: 0, Field: models.FileNameField, Text: "index.html"})
+			So(events[2], ShouldResemble, models.AppFileEvent{Kind: models.FieldCompleted, Index: 0, Field: models.FilePathField, Text: "./"})
+			So(content(0), ShouldEqual, "<p>\"hi\"</p>\n")
+			So(content(1), ShouldEqual, "café 😀")
+			So(events[len(events)-1], ShouldResemble, models.AppFileEvent{Kind: models.FileCompleted, Index: 1})
+		})
+
+		Convey("ignores text before the array", func() {
+			decoder.Write(`Sure: [{"fileName":"main.tf","filePath":"./","fileContent":"x"}]`)
+
+			So(content(0), ShouldEqual, "x")
+			So(events[0].Kind, ShouldEqual, models.FileStarted)
+		})
+	})
+
+}
@@ -19,6 +19,18 @@ func TestAppFile(t *testing.T) {
 			So(files[0].Path, ShouldEqual, "./")
 			So(files[0].Content, ShouldEqual, "\n# Configure the Azure provider\nprovider \"azurerm\" {\n\tfeatures {}\n}\n\n# Create a resource group\nresource \"azurerm_resource_group\" \"aks\" {  \n\tname     = var.resource_group_name\n\tlocation = var.resource_group_location\n}\n")
 		})
+
+		Convey("AppFileSchema", func() {
+			schema := models.AppFileSchema()
+			So(schema["type"], ShouldEqual, "object")
+			So(schema["required"], ShouldResemble, []string{"fileName", "filePath", "fileContent"})
+
+			properties := schema["properties"].(map[string]interface{})
+			So(len(properties), ShouldEqual, 3)
+			fileName := properties["fileName"].(map[string]interface{})
+			So(fileName["type"], ShouldEqual, "string")
+			So(fileName["description"], ShouldNotBeEmpty)
+		})
 	})
 
 }
@@ -0,0 +1,163 @@
+package models
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/afrancoc2000/application-helper-ai/internal/models"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCatalog(t *testing.T) {
+	Convey("Catalog", t, func() {
+
+		writeCatalog := func(content string) string {
+			path := filepath.Join(t.TempDir(), "models.yaml")
+			err := os.WriteFile(path, []byte(content), 0o600)
+			So(err, ShouldBeNil)
+			return path
+		}
+
+		Convey("DefaultCatalog", func() {
+			catalog, err := models.DefaultCatalog()
+			So(err, ShouldBeNil)
+
+			model, ok := catalog.Model("gpt-4o")
+			So(ok, ShouldEqual, true)
+			So(model.ContextWindow, ShouldEqual, 128000)
+			So(model.Tokenizer, ShouldEqual, "o200k_base")
+		})
+
+		Convey("Deployment maps Azure names", func() {
+			catalog, err := models.DefaultCatalog()
+			So(err, ShouldBeNil)
+
+			deployment, err := catalog.Deployment("gpt-35-turbo-0301")
+			So(err, ShouldBeNil)
+			So(deployment.Name, ShouldEqual, "gpt-35-turbo-0301")
+			So(deployment.Model.Name, ShouldEqual, "gpt-3.5-turbo-0301")
+			So(deployment.Price, ShouldResemble, &models.Price{Prompt: 1.5, Completion: 2})
+		})
+
+		Convey("LoadCatalog prices", func() {
+			path := writeCatalog(`
+models:
+  - name: codellama
+    contextWindow: 16384
+    mode: chat
+prices:
+  gpt-4: {prompt: 20, completion: 40}
+  codellama: {prompt: 0.5, completion: 1}
+`)
+			catalog, err := models.LoadCatalog(path)
+			So(err, ShouldBeNil)
+
+			deployment, err := catalog.Deployment("gpt-4")
+			So(err, ShouldBeNil)
+			cost, ok := deployment.Cost(1000000, 500000)
+			So(ok, ShouldBeTrue)
+			So(cost, ShouldAlmostEqual, 40)
+
+			deployment, err = catalog.Deployment("codellama")
+			So(err, ShouldBeNil)
+			So(deployment.Price.Prompt, ShouldEqual, 0.5)
+
+			_, ok = models.LocalDeployment("llama2").Cost(1000, 1000)
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("LoadCatalog price of an unknown model", func() {
+			path := writeCatalog(`
+prices:
+  gpt-5: {prompt: 1, completion: 2}
+`)
+			_, err := models.LoadCatalog(path)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "prices.gpt-5")
+		})
+
+		Convey("LoadCatalog user models and deployments", func() {
+			path := writeCatalog(`
+models:
+  - name: gpt-4
+    contextWindow: 9000
+    mode: chat
+  - name: codellama
+    contextWindow: 16384
+    maxOutputTokens: 2048
+    mode: completion
+deployments:
+  team-gpt4: gpt-4
+`)
+			catalog, err := models.LoadCatalog(path)
+			So(err, ShouldBeNil)
+
+			deployment, err := catalog.Deployment("team-gpt4")
+			So(err, ShouldBeNil)
+			So(deployment.MaxTokens(), ShouldEqual, 9000)
+			So(deployment.MaxOutputTokens(), ShouldEqual, 9000)
+
+			deployment, err = catalog.Deployment("codellama")
+			So(err, ShouldBeNil)
+			So(deployment.IsChat(), ShouldEqual, false)
+			So(deployment.MaxOutputTokens(), ShouldEqual, 2048)
+			So(deployment.Tokenizer(), ShouldEqual, "cl100k_base")
+
+			_, err = catalog.Deployment("gpt-4o")
+			So(err, ShouldBeNil)
+		})
+
+		Convey("LoadCatalog invalid mode", func() {
+			path := writeCatalog(`
+models:
+  - name: codellama
+    contextWindow: 16384
+    mode: instruct
+`)
+			_, err := models.LoadCatalog(path)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "codellama")
+		})
+
+		Convey("LoadCatalog unknown tokenizer", func() {
+			path := writeCatalog(`
+models:
+  - name: codellama
+    contextWindow: 16384
+    mode: chat
+    tokenizer: llama
+`)
+			_, err := models.LoadCatalog(path)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "tokenizer must be one of")
+		})
+
+		Convey("LoadCatalog deployment to unknown model", func() {
+			path := writeCatalog(`
+deployments:
+  team-gpt5: gpt-5
+`)
+			_, err := models.LoadCatalog(path)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "deployments.team-gpt5")
+		})
+
+		Convey("LoadCatalog unknown field", func() {
+			path := writeCatalog(`
+models:
+  - name: codellama
+    contextWindowSize: 16384
+    mode: chat
+`)
+			_, err := models.LoadCatalog(path)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("LoadCatalog missing file", func() {
+			_, err := models.LoadCatalog(filepath.Join(t.TempDir(), "missing.yaml"))
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+}
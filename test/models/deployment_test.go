@@ -10,7 +10,8 @@ import (
 func TestDeployment(t *testing.T) {
 	Convey("Deployment", t, func() {
 
-		deployment := models.Gpt4_0314
+		deployment, err := models.DeploymentFromName("gpt-4-0314")
+		So(err, ShouldBeNil)
 
 		Convey("String", func() {
 			result := deployment.String()
@@ -22,15 +23,48 @@ func TestDeployment(t *testing.T) {
 			So(result, ShouldEqual, 8192)
 		})
 
+		Convey("MaxOutputTokens", func() {
+			result := deployment.MaxOutputTokens()
+			So(result, ShouldEqual, 8192)
+		})
+
 		Convey("IsChat", func() {
 			result := deployment.IsChat()
 			So(result, ShouldEqual, true)
 		})
 
-		Convey("DeploymentFromName", func() {
-			testDeployment, err := models.DeploymentFromName("gpt-4-0314")
+		Convey("Tokenizer", func() {
+			result := deployment.Tokenizer()
+			So(result, ShouldEqual, "cl100k_base")
+		})
+
+		Convey("SupportsFunctions", func() {
+			So(deployment.SupportsFunctions(), ShouldEqual, false)
+
+			functionsDeployment, err := models.DeploymentFromName("gpt-35-turbo")
 			So(err, ShouldBeNil)
-			So(testDeployment, ShouldEqual, models.Gpt4_0314)
+			So(functionsDeployment.SupportsFunctions(), ShouldEqual, true)
+			So(models.LocalDeployment("llama2").SupportsFunctions(), ShouldEqual, false)
+		})
+
+		Convey("DeploymentFromName completion model", func() {
+			testDeployment, err := models.DeploymentFromName("text-davinci-003")
+			So(err, ShouldBeNil)
+			So(testDeployment.IsChat(), ShouldEqual, false)
+			So(testDeployment.MaxTokens(), ShouldEqual, 4097)
+		})
+
+		Convey("DeploymentFromName unknown model", func() {
+			_, err := models.DeploymentFromName("gpt-5")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "gpt-4-0314")
+		})
+
+		Convey("LocalDeployment", func() {
+			testDeployment := models.LocalDeployment("llama2")
+			So(testDeployment.String(), ShouldEqual, "llama2")
+			So(testDeployment.IsChat(), ShouldEqual, true)
+			So(testDeployment.MaxTokens(), ShouldEqual, 4096)
 		})
 	})
 
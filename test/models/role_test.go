@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/afrancoc2000/application-helper-ai/internal/models"
@@ -24,6 +25,20 @@ func TestRole(t *testing.T) {
 			result := models.System.String()
 			So(result, ShouldEqual, "system")
 		})
+
+		Convey("JSON", func() {
+			content, err := json.Marshal(models.Message{Role: models.Assistant, Content: "[]"})
+			So(err, ShouldBeNil)
+			So(string(content), ShouldEqual, `{"role":"assistant","content":"[]"}`)
+
+			message := models.Message{}
+			err = json.Unmarshal(content, &message)
+			So(err, ShouldBeNil)
+			So(message.Role, ShouldEqual, models.Assistant)
+
+			err = json.Unmarshal([]byte(`{"role":"tool"}`), &message)
+			So(err, ShouldNotBeNil)
+		})
 	})
 
 }
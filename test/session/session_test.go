@@ -0,0 +1,128 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/afrancoc2000/application-helper-ai/internal/config"
+	"github.com/afrancoc2000/application-helper-ai/internal/models"
+	"github.com/afrancoc2000/application-helper-ai/internal/session"
+	"github.com/afrancoc2000/application-helper-ai/internal/usage"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSession(t *testing.T) {
+	Convey("Session", t, func() {
+
+		appConfig := config.AppConfig{
+			OpenaiApiKey:         "123456",
+			OpenaiDeploymentName: "gpt-4-0314",
+			AzureOpenaiEndpoint:  "https://devsquad-openai-lab.openai.azure.com/",
+			Temperature:          0.3,
+			ChatContext:          "You create html applications",
+			OutputDir:            "./app",
+		}
+		files := []models.AppFile{{Name: "index.html", Path: "./", Content: "<html></html>"}}
+
+		dir := t.TempDir()
+		store := session.NewStore(filepath.Join(dir, "sessions"))
+
+		Convey("New", func() {
+			current := session.New(appConfig)
+
+			So(current.ID, ShouldNotBeEmpty)
+			So(current.Config.Provider, ShouldEqual, config.AzureProvider)
+			So(current.Config.OpenaiDeploymentName, ShouldEqual, "gpt-4-0314")
+			So(current.LastTurn(), ShouldBeNil)
+			So(current.Title(), ShouldEqual, "")
+		})
+
+		Convey("AddTurn", func() {
+			current := session.New(appConfig)
+			current.AddTurn("Create a hello world page", "[]", files)
+			current.AddTurn("Add a title", "[]", files)
+
+			So(len(current.Turns), ShouldEqual, 2)
+			So(current.LastTurn().Prompt, ShouldEqual, "Add a title")
+			So(current.Title(), ShouldEqual, "Create a hello world page")
+		})
+
+		Convey("Usage", func() {
+			gpt4, _ := models.DeploymentFromName("gpt-4")
+			current := session.New(appConfig)
+			current.SetUsage(usage.NewRecord(current.ID, gpt4, 100, 10, false))
+			So(current.Usage().Turns, ShouldEqual, 0)
+
+			current.AddTurn("Create a hello world page", "[]", files)
+			current.SetUsage(usage.NewRecord(current.ID, gpt4, 1000, 500, false))
+			current.AddTurn("Add a title", "[]", files)
+			current.SetUsage(usage.NewRecord(current.ID, models.LocalDeployment("llama2"), 200, 20, true))
+
+			total := current.Usage()
+			So(total.PromptTokens, ShouldEqual, 1200)
+			So(total.CompletionTokens, ShouldEqual, 520)
+			So(total.Cost, ShouldAlmostEqual, 0.06)
+			So(total.Unpriced, ShouldBeTrue)
+			So(total.Estimated, ShouldBeTrue)
+		})
+
+		Convey("Settings", func() {
+			settings := session.ConfigFrom(appConfig).Settings()
+
+			So(settings[config.OpenaiDeploymentNameLabel], ShouldEqual, "gpt-4-0314")
+			So(settings[config.OutputDirLabel], ShouldEqual, "./app")
+			So(settings, ShouldNotContainKey, config.OpenaiApiKeyLabel)
+		})
+
+		Convey("Save and Load", func() {
+			current := session.New(appConfig)
+			current.Messages = []models.Message{{Role: models.System, Content: "context"}}
+			current.AddTurn("Create a hello world page", "[]", files)
+			err := store.Save(current)
+			So(err, ShouldBeNil)
+
+			loaded, err := store.Load(current.ID)
+			So(err, ShouldBeNil)
+			So(loaded.Messages, ShouldResemble, current.Messages)
+			So(loaded.Turns[0].Files, ShouldResemble, files)
+			So(loaded.Config, ShouldResemble, current.Config)
+
+			content, err := os.ReadFile(filepath.Join(dir, "sessions", current.ID+".json"))
+			So(err, ShouldBeNil)
+			So(string(content), ShouldNotContainSubstring, "123456")
+		})
+
+		Convey("Load missing session", func() {
+			_, err := store.Load("20230101-000000-abcdef")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "does not exist")
+		})
+
+		Convey("Load invalid ID", func() {
+			_, err := store.Load("../config")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "invalid session ID")
+		})
+
+		Convey("List", func() {
+			sessions, err := store.List()
+			So(err, ShouldBeNil)
+			So(len(sessions), ShouldEqual, 0)
+
+			older := session.New(appConfig)
+			older.UpdatedAt = time.Now().Add(-time.Hour)
+			So(store.Save(older), ShouldBeNil)
+			newer := session.New(appConfig)
+			So(store.Save(newer), ShouldBeNil)
+
+			sessions, err = store.List()
+			So(err, ShouldBeNil)
+			So(len(sessions), ShouldEqual, 2)
+			So(sessions[0].ID, ShouldEqual, newer.ID)
+			So(sessions[1].ID, ShouldEqual, older.ID)
+		})
+	})
+
+}
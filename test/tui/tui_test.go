@@ -0,0 +1,165 @@
+package tui
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	fileSystem "github.com/afrancoc2000/application-helper-ai/internal/file_system"
+	"github.com/afrancoc2000/application-helper-ai/internal/models"
+	"github.com/afrancoc2000/application-helper-ai/internal/tui"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var ansi = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+// plain returns the lines of the view without colors.
+func plain(model *tui.Model) []string {
+	return strings.Split(ansi.ReplaceAllString(model.View(), ""), "\r\n")
+}
+
+func press(model *tui.Model, input string) {
+	for _, key := range tui.ParseKeys([]byte(input)) {
+		model.Update(key)
+	}
+}
+
+func TestTui(t *testing.T) {
+	Convey("ParseKeys", t, func() {
+		keys := tui.ParseKeys([]byte("a\x1b[A\x1bOB\x1b[6~ \r\x7f\x1b\x03é\x1b[99~"))
+		So(keys, ShouldResemble, []tui.Key{
+			{Type: tui.KeyRune, Rune: 'a'},
+			{Type: tui.KeyUp},
+			{Type: tui.KeyDown},
+			{Type: tui.KeyPageDown},
+			{Type: tui.KeyRune, Rune: ' '},
+			{Type: tui.KeyEnter},
+			{Type: tui.KeyBackspace},
+			{Type: tui.KeyEscape},
+			{Type: tui.KeyCtrlC},
+			{Type: tui.KeyRune, Rune: 'é'},
+		})
+	})
+
+	Convey("Model", t, func() {
+		changes := []fileSystem.FileChange{
+			{File: models.AppFile{Name: "style.css", Path: "./", Content: "h1 {}\n"}, Status: fileSystem.NewFile},
+			{File: models.AppFile{Name: "app.js", Path: "./src/", Content: "alert(1)\n"}, Status: fileSystem.NewFile},
+			{File: models.AppFile{Name: "index.html", Path: "./", Content: "<h1>Hello</h1>\n"}, Target: "index.html", Status: fileSystem.ModifiedFile, Previous: "<h1>Bye</h1>\n"},
+		}
+		model := tui.NewModel(tui.Options{Changes: changes})
+		model.Resize(60, 10)
+
+		Convey("Shows the files as a tree with the selected one", func() {
+			view := plain(model)
+			So(view, ShouldHaveLength, 10)
+			So(view[0], ShouldContainSubstring, "3 of 3 files accepted")
+			So(view[1], ShouldStartWith, "[x] M index.html")
+			So(view[2], ShouldStartWith, "[x] N style.css")
+			So(view[3], ShouldStartWith, "src/")
+			So(view[4], ShouldStartWith, "  [x] N app.js")
+			// the first generated file is selected
+			So(view[1], ShouldEndWith, "│h1 {}"+strings.Repeat(" ", 60-20-1-len("h1 {}")))
+			So(view[8], ShouldStartWith, "./style.css (new) · content · lines 1-1 of 1")
+			for _, line := range view {
+				So([]rune(line), ShouldHaveLength, 60)
+			}
+
+			// a modified file shows its diff
+			press(model, "k")
+			view = plain(model)
+			So(strings.Join(view, "\n"), ShouldContainSubstring, "│+<h1>Hello</h1>")
+			So(strings.Join(view, "\n"), ShouldContainSubstring, "│-<h1>Bye</h1>")
+			So(view[8], ShouldStartWith, "./index.html (modified) · diff")
+
+			press(model, "d")
+			So(plain(model)[1], ShouldEndWith, "<h1>Hello</h1>"+strings.Repeat(" ", 60-20-1-len("<h1>Hello</h1>")))
+		})
+
+		Convey("Applies the accepted files", func() {
+			press(model, "j ")
+			So(plain(model)[0], ShouldContainSubstring, "2 of 3 files accepted")
+			press(model, "\r")
+
+			result, done := model.Done()
+			So(done, ShouldBeTrue)
+			So(result.Action, ShouldEqual, tui.ApplyAction)
+			So(result.Accepted, ShouldResemble, []bool{true, false, true})
+			So(result.Selected, ShouldEqual, 1)
+		})
+
+		Convey("Doesn't apply without accepted files", func() {
+			press(model, "A\r")
+			_, done := model.Done()
+			So(done, ShouldBeFalse)
+			So(plain(model)[8], ShouldStartWith, "No file is accepted")
+
+			press(model, "A")
+			So(plain(model)[0], ShouldContainSubstring, "3 of 3 files accepted")
+		})
+
+		Convey("Refines the query", func() {
+			press(model, "p\r")
+			_, done := model.Done()
+			So(done, ShouldBeFalse)
+
+			press(model, "Add a footerx\x7f\r")
+			result, done := model.Done()
+			So(done, ShouldBeTrue)
+			So(result.Action, ShouldEqual, tui.RefineAction)
+			So(result.Prompt, ShouldEqual, "Add a footer")
+		})
+
+		Convey("Regenerates the selected file", func() {
+			press(model, "G")
+			So(plain(model)[8], ShouldContainSubstring, "./src/app.js")
+			press(model, "r")
+			So(plain(model)[9], ShouldStartWith, "Regenerate ./src/app.js")
+			press(model, "Use const\r")
+
+			result, _ := model.Done()
+			So(result.Action, ShouldEqual, tui.RegenerateAction)
+			So(result.Selected, ShouldEqual, 1)
+			So(result.Prompt, ShouldEqual, "Use const")
+		})
+
+		Convey("Cancels the input with escape", func() {
+			press(model, "r")
+			press(model, "\x1b")
+			_, done := model.Done()
+			So(done, ShouldBeFalse)
+
+			press(model, "q")
+			result, _ := model.Done()
+			So(result.Action, ShouldEqual, tui.QuitAction)
+		})
+
+		Convey("Only refines or quits without files", func() {
+			empty := tui.NewModel(tui.Options{})
+			press(empty, "er d")
+			So(plain(empty)[len(plain(empty))-2], ShouldStartWith, "There are no files")
+			_, done := empty.Done()
+			So(done, ShouldBeFalse)
+
+			press(empty, "p")
+			press(empty, "Add a page\r")
+			result, done := empty.Done()
+			So(done, ShouldBeTrue)
+			So(result.Action, ShouldEqual, tui.RefineAction)
+			So(result.Prompt, ShouldEqual, "Add a page")
+		})
+
+		Convey("Keeps the state of the previous time", func() {
+			model = tui.NewModel(tui.Options{Changes: changes, Accepted: []bool{true, false, false}, Selected: 1, Status: "Couldn't edit the file"})
+			model.Resize(60, 10)
+			view := plain(model)
+			So(view[0], ShouldContainSubstring, "1 of 3 files accepted")
+			So(view[8], ShouldStartWith, "Couldn't edit the file")
+
+			press(model, "e")
+			result, _ := model.Done()
+			So(result.Action, ShouldEqual, tui.EditAction)
+			So(result.Selected, ShouldEqual, 1)
+		})
+	})
+}
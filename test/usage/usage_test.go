@@ -0,0 +1,131 @@
+package usage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/afrancoc2000/application-helper-ai/internal/models"
+	"github.com/afrancoc2000/application-helper-ai/internal/usage"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestUsage(t *testing.T) {
+	Convey("Usage", t, func() {
+
+		gpt4, _ := models.DeploymentFromName("gpt-4")
+		local := models.LocalDeployment("llama2")
+
+		Convey("NewRecord prices the tokens", func() {
+			record := usage.NewRecord("session-1", gpt4, 1000, 500, false)
+
+			So(record.Session, ShouldEqual, "session-1")
+			So(record.Model, ShouldEqual, "gpt-4")
+			So(record.Cost, ShouldNotBeNil)
+			So(*record.Cost, ShouldAlmostEqual, 0.06)
+		})
+
+		Convey("NewRecord without a price", func() {
+			record := usage.NewRecord("session-1", local, 1000, 500, true)
+			So(record.Cost, ShouldBeNil)
+
+			total := usage.Total{}
+			total.Add(record)
+			So(total.Unpriced, ShouldBeTrue)
+			So(total.FormatCost(), ShouldEqual, "$0.0000 (some models have no price, estimated)")
+		})
+
+		Convey("Summarize", func() {
+			day := time.Date(2024, 5, 1, 12, 0, 0, 0, time.Local)
+			cost := 0.5
+			records := []usage.Record{
+				{Time: day, Session: "a", Model: "gpt-4", PromptTokens: 100, CompletionTokens: 10, Cost: &cost},
+				{Time: day.Add(time.Hour), Session: "a", Model: "gpt-4", PromptTokens: 200, CompletionTokens: 20, Cost: &cost},
+				{Time: day.AddDate(0, 1, 0), Session: "b", Model: "llama2", PromptTokens: 300, CompletionTokens: 30},
+			}
+
+			Convey("By day", func() {
+				totals := usage.Summarize(records, time.Time{}, usage.ByDay)
+				So(len(totals), ShouldEqual, 2)
+				So(totals[0].Key, ShouldEqual, "2024-05-01")
+				So(totals[0].Turns, ShouldEqual, 2)
+				So(totals[0].PromptTokens, ShouldEqual, 300)
+				So(totals[0].Cost, ShouldAlmostEqual, 1.0)
+				So(totals[1].Unpriced, ShouldBeTrue)
+			})
+
+			Convey("By model", func() {
+				totals := usage.Summarize(records, time.Time{}, usage.ByModel)
+				So(totals[0].Key, ShouldEqual, "gpt-4")
+				So(totals[1].Key, ShouldEqual, "llama2")
+			})
+
+			Convey("Since", func() {
+				totals := usage.Summarize(records, day.AddDate(0, 0, 1), usage.BySession)
+				So(len(totals), ShouldEqual, 1)
+				So(totals[0].Key, ShouldEqual, "b")
+			})
+		})
+
+		Convey("ParseSince", func() {
+			now := time.Date(2024, 5, 31, 15, 30, 0, 0, time.Local)
+
+			since, err := usage.ParseSince("30d", now)
+			So(err, ShouldBeNil)
+			So(since, ShouldEqual, time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local))
+
+			since, err = usage.ParseSince("2024-04-15", now)
+			So(err, ShouldBeNil)
+			So(since, ShouldEqual, time.Date(2024, 4, 15, 0, 0, 0, 0, time.Local))
+
+			since, err = usage.ParseSince("", now)
+			So(err, ShouldBeNil)
+			So(since.IsZero(), ShouldBeTrue)
+
+			_, err = usage.ParseSince("last month", now)
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("ParseGrouping", func() {
+			grouping, err := usage.ParseGrouping("month")
+			So(err, ShouldBeNil)
+			So(grouping, ShouldEqual, usage.ByMonth)
+
+			_, err = usage.ParseGrouping("week")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Log", func() {
+			path := filepath.Join(t.TempDir(), "config", "usage.jsonl")
+			log := usage.NewLog(path)
+
+			records, err := log.Read()
+			So(err, ShouldBeNil)
+			So(records, ShouldBeEmpty)
+
+			So(log.Append(usage.NewRecord("a", gpt4, 100, 10, false)), ShouldBeNil)
+			So(log.Append(usage.NewRecord("b", local, 200, 20, true)), ShouldBeNil)
+
+			records, err = log.Read()
+			So(err, ShouldBeNil)
+			So(len(records), ShouldEqual, 2)
+			So(records[0].Session, ShouldEqual, "a")
+			So(records[1].Estimated, ShouldBeTrue)
+
+			info, err := os.Stat(path)
+			So(err, ShouldBeNil)
+			So(info.Mode().Perm(), ShouldEqual, os.FileMode(0o600))
+
+			Convey("Invalid line", func() {
+				file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+				file.WriteString("not json\n")
+				file.Close()
+
+				_, err := log.Read()
+				So(err, ShouldNotBeNil)
+				So(err.Error(), ShouldContainSubstring, "line 3")
+			})
+		})
+	})
+}